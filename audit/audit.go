@@ -0,0 +1,257 @@
+// Package audit keeps an append-only, hash-chained log of who did what.
+// Every entry commits to the one before it, so editing or deleting any
+// entry breaks verification of all later ones.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/EupravaProjekat/court/docsign"
+)
+
+// ErrConflict is returned by a Store when another writer took the sequence
+// number first.
+var ErrConflict = errors.New("audit sequence number already taken")
+
+// ErrChained is returned by a Store when the pending event was already
+// chained, by another replica.
+var ErrChained = errors.New("audit event already chained")
+
+// appendAttempts bounds retries when writers race for the next number.
+// An event that loses every race stays queued for the next flush.
+const appendAttempts = 5
+
+// pendingBatch is how many queued events a flush reads at a time.
+const pendingBatch = 100
+
+type Entry struct {
+	Seq          int64  `bson:"seq" json:"seq"`
+	Time         string `bson:"time" json:"time"`
+	Actor        string `bson:"actor" json:"actor"`   // Email of the user or ID of the service client
+	Action       string `bson:"action" json:"action"` // e.g. case.create, document.read
+	Target       string `bson:"target" json:"target"` // e.g. case/<id>
+	BeforeDigest string `bson:"beforeDigest" json:"before_digest"`
+	AfterDigest  string `bson:"afterDigest" json:"after_digest"`
+	ClientIP     string `bson:"clientIp" json:"client_ip"`
+	PrevHash     string `bson:"prevHash" json:"prev_hash"`
+	Hash         string `bson:"hash" json:"hash,omitempty"`
+}
+
+// Event is what a caller records; Before and After are digested, never
+// stored.
+type Event struct {
+	Actor    string
+	Action   string
+	Target   string
+	Before   interface{}
+	After    interface{}
+	ClientIP string
+}
+
+// Pending is an event recorded but not yet chained. Its Entry has
+// everything but its place in the chain.
+type Pending struct {
+	ID       string    `bson:"id"`
+	QueuedAt time.Time `bson:"queuedAt"`
+	Entry    Entry     `bson:"entry"`
+}
+
+// Store persists the queue and the chain. Append must store e and remove
+// the pending event in one step, failing with ErrConflict if an entry with
+// the same Seq exists and with ErrChained if the event is no longer
+// queued.
+type Store interface {
+	Enqueue(ctx context.Context, p *Pending) error
+	Pending(ctx context.Context, limit int) ([]*Pending, error) // Oldest first
+	Last(ctx context.Context) (*Entry, error)                   // nil, nil when empty
+	Append(ctx context.Context, e *Entry, pendingID string) error
+}
+
+// Log records events durably at once and chains them in the background,
+// so a request neither waits for nor contends on the head of the chain.
+type Log struct {
+	store Store
+	mu    sync.Mutex // Serialises this process's flushes
+	wake  chan struct{}
+}
+
+func New(store Store) *Log {
+	return &Log{store: store, wake: make(chan struct{}, 1)}
+}
+
+// Record queues an entry for ev. Once Record returns, the event survives
+// restarts and is chained by the next flush.
+func (l *Log) Record(ctx context.Context, ev Event) error {
+	before, err := Digest(ev.Before)
+	if err != nil {
+		return err
+	}
+	after, err := Digest(ev.After)
+	if err != nil {
+		return err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	err = l.store.Enqueue(ctx, &Pending{
+		ID:       hex.EncodeToString(id),
+		QueuedAt: now,
+		Entry: Entry{
+			Time:         now.Format(time.RFC3339Nano),
+			Actor:        ev.Actor,
+			Action:       ev.Action,
+			Target:       ev.Target,
+			BeforeDigest: before,
+			AfterDigest:  after,
+			ClientIP:     ev.ClientIP,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run flushes the queue whenever an event is recorded, and every interval
+// to pick up what other replicas or earlier failures left behind.
+func (l *Log) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := l.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Audit flush failed: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-l.wake:
+		}
+	}
+}
+
+// Flush chains every queued event in the order it was queued. It stops at
+// the first event it can't chain, leaving it and the rest queued.
+func (l *Log) Flush(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		pending, err := l.store.Pending(ctx, pendingBatch)
+		if err != nil {
+			return err
+		}
+		for _, p := range pending {
+			if err := l.chain(ctx, p); err != nil {
+				return err
+			}
+		}
+		if len(pending) < pendingBatch {
+			return nil
+		}
+	}
+}
+
+// chain appends p after the current last entry; the store's unique
+// sequence catches races with other replicas.
+func (l *Log) chain(ctx context.Context, p *Pending) error {
+	for attempt := 0; attempt < appendAttempts; attempt++ {
+		last, err := l.store.Last(ctx)
+		if err != nil {
+			return err
+		}
+		e := p.Entry
+		e.Seq, e.PrevHash = 1, ""
+		if last != nil {
+			e.Seq = last.Seq + 1
+			e.PrevHash = last.Hash
+		}
+		if e.Hash, err = Hash(&e); err != nil {
+			return err
+		}
+		err = l.store.Append(ctx, &e, p.ID)
+		if errors.Is(err, ErrChained) {
+			return nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	return ErrConflict
+}
+
+// Digest hashes the canonical JSON form of v; nil digests to "".
+func Digest(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	payload, err := docsign.Canonicalize(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Hash computes an entry's hash over all its other fields.
+func Hash(e *Entry) (string, error) {
+	unhashed := *e
+	unhashed.Hash = ""
+	return Digest(unhashed)
+}
+
+// Verifier checks entries one at a time, in sequence order, so a chain of
+// any length can be verified while streaming it.
+type Verifier struct {
+	prevHash string
+	Checked  int64
+}
+
+func (v *Verifier) Check(e *Entry) error {
+	switch {
+	case e.Seq != v.Checked+1:
+		return fmt.Errorf("entry %d: expected sequence %d, entries are missing", e.Seq, v.Checked+1)
+	case e.PrevHash != v.prevHash:
+		return fmt.Errorf("entry %d: does not link to the previous entry", e.Seq)
+	}
+	hash, err := Hash(e)
+	if err != nil {
+		return fmt.Errorf("entry %d: %w", e.Seq, err)
+	}
+	if hash != e.Hash {
+		return fmt.Errorf("entry %d: content does not match its hash", e.Seq)
+	}
+	v.prevHash = e.Hash
+	v.Checked++
+	return nil
+}
+
+// Result is the outcome of verifying a whole chain.
+type Result struct {
+	Intact   bool   `json:"intact"`
+	Checked  int64  `json:"checked"`
+	LastHash string `json:"last_hash,omitempty"` // Head of the verified chain, worth writing down
+	Problem  string `json:"problem,omitempty"`
+}
+
+// Result reports the verification so far, with err from the failing Check.
+func (v *Verifier) Result(err error) Result {
+	res := Result{Intact: err == nil, Checked: v.Checked, LastHash: v.prevHash}
+	if err != nil {
+		res.Problem = err.Error()
+	}
+	return res
+}
@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memStore keeps the queue and chain in memory. beforeAppend, if set,
+// runs ahead of each Append to simulate another replica.
+type memStore struct {
+	mu           sync.Mutex
+	pending      []*Pending
+	entries      []*Entry
+	beforeAppend func(s *memStore)
+}
+
+func (s *memStore) Enqueue(ctx context.Context, p *Pending) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, p)
+	return nil
+}
+
+func (s *memStore) Pending(ctx context.Context, limit int) ([]*Pending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) < limit {
+		limit = len(s.pending)
+	}
+	return append([]*Pending(nil), s.pending[:limit]...), nil
+}
+
+func (s *memStore) Last(ctx context.Context) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) == 0 {
+		return nil, nil
+	}
+	return s.entries[len(s.entries)-1], nil
+}
+
+func (s *memStore) Append(ctx context.Context, e *Entry, pendingID string) error {
+	if s.beforeAppend != nil {
+		s.beforeAppend(s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := 0
+	for i < len(s.pending) && s.pending[i].ID != pendingID {
+		i++
+	}
+	if i == len(s.pending) {
+		return ErrChained
+	}
+	if len(s.entries) > 0 && s.entries[len(s.entries)-1].Seq >= e.Seq {
+		return ErrConflict
+	}
+	s.pending = append(s.pending[:i], s.pending[i+1:]...)
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func verify(entries []*Entry) Result {
+	var v Verifier
+	for _, e := range entries {
+		if err := v.Check(e); err != nil {
+			return v.Result(err)
+		}
+	}
+	return v.Result(nil)
+}
+
+func recordAll(t *testing.T, l *Log, actions ...string) {
+	t.Helper()
+	for _, action := range actions {
+		err := l.Record(context.Background(), Event{Actor: "ana@sud.rs", Action: action, Target: "case/1", After: map[string]string{"a": action}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecordQueuesUntilFlushed(t *testing.T) {
+	store := &memStore{}
+	l := New(store)
+	recordAll(t, l, "case.create", "case.update", "case.read")
+	if len(store.entries) != 0 || len(store.pending) != 3 {
+		t.Fatalf("before flush: %d entries, %d pending", len(store.entries), len(store.pending))
+	}
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.pending) != 0 || len(store.entries) != 3 {
+		t.Fatalf("after flush: %d entries, %d pending", len(store.entries), len(store.pending))
+	}
+	for i, action := range []string{"case.create", "case.update", "case.read"} {
+		if e := store.entries[i]; e.Action != action || e.Seq != int64(i+1) {
+			t.Fatalf("entry %d = %+v, want %s", i, e, action)
+		}
+	}
+	res := verify(store.entries)
+	if !res.Intact || res.Checked != 3 || res.LastHash != store.entries[2].Hash {
+		t.Fatalf("verification = %+v", res)
+	}
+}
+
+func TestFlushRetriesConflicts(t *testing.T) {
+	store := &memStore{}
+	l := New(store)
+	other := New(store)
+	recordAll(t, l, "case.create")
+	// Another replica chains its own event just before this one appends
+	store.beforeAppend = func(s *memStore) {
+		s.beforeAppend = nil
+		recordAll(t, other, "case.read")
+		if err := other.Flush(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.entries) != 2 || len(store.pending) != 0 {
+		t.Fatalf("%d entries, %d pending, want 2 and 0", len(store.entries), len(store.pending))
+	}
+	if res := verify(store.entries); !res.Intact {
+		t.Fatalf("verification = %+v", res)
+	}
+}
+
+func TestFlushSkipsEventsChainedElsewhere(t *testing.T) {
+	store := &memStore{}
+	l := New(store)
+	recordAll(t, l, "case.create", "case.read")
+	// Another replica chains the first event after this one read the queue
+	store.beforeAppend = func(s *memStore) {
+		s.beforeAppend = nil
+		if err := New(s).chain(context.Background(), s.pending[0]); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := l.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.entries) != 2 {
+		t.Fatalf("%d entries, want each event chained once", len(store.entries))
+	}
+	if res := verify(store.entries); !res.Intact {
+		t.Fatalf("verification = %+v", res)
+	}
+}
+
+func TestVerifierFindsTampering(t *testing.T) {
+	chain := func() []*Entry {
+		store := &memStore{}
+		l := New(store)
+		recordAll(t, l, "case.create", "case.update", "case.read")
+		if err := l.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return store.entries
+	}
+	tests := []struct {
+		name    string
+		tamper  func([]*Entry) []*Entry
+		checked int64
+		problem string
+	}{
+		{"edited", func(es []*Entry) []*Entry { es[1].Actor = "someone@else"; return es }, 1, "content does not match"},
+		{"deleted", func(es []*Entry) []*Entry { return append(es[:1], es[2:]...) }, 1, "entries are missing"},
+		{"rehashed", func(es []*Entry) []*Entry {
+			es[1].Actor = "someone@else"
+			es[1].Hash, _ = Hash(es[1])
+			return es
+		}, 2, "does not link"},
+		{"reordered", func(es []*Entry) []*Entry { es[1].Seq, es[2].Seq = 3, 2; return []*Entry{es[0], es[2], es[1]} }, 1, "does not link"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := verify(tt.tamper(chain()))
+			if res.Intact || res.Checked != tt.checked || !strings.Contains(res.Problem, tt.problem) {
+				t.Fatalf("verification = %+v, want %q after %d entries", res, tt.problem, tt.checked)
+			}
+		})
+	}
+}
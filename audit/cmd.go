@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// RunVerify is the entry point of the "verify-audit" subcommand:
+//
+//	court verify-audit -file audit.jsonl [-head <hash>]
+//
+// where audit.jsonl is the output of GET /admin/audit/export. It needs no
+// access to the court's database.
+func RunVerify(args []string) error {
+	fs := flag.NewFlagSet("verify-audit", flag.ContinueOnError)
+	file := fs.String("file", "-", "export to verify, - for stdin")
+	head := fs.String("head", "", "hash of the last entry as recorded earlier, to detect truncation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var v Verifier
+	var err error
+	seenHead := *head == ""
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() && err == nil {
+		var e Entry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			err = fmt.Errorf("line %d: %w", v.Checked+1, err)
+			break
+		}
+		err = v.Check(&e)
+		seenHead = seenHead || e.Hash == *head
+	}
+	if err == nil {
+		err = scanner.Err()
+	}
+	if err == nil && !seenHead {
+		err = fmt.Errorf("entry with hash %s not found, the log was truncated", *head)
+	}
+
+	out, _ := json.MarshalIndent(v.Result(err), "", "  ")
+	fmt.Println(string(out))
+	if err != nil {
+		return errors.New("audit chain broken")
+	}
+	return nil
+}
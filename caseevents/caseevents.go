@@ -0,0 +1,211 @@
+// Package caseevents records every change to a case as a domain event. The
+// case document the rest of the court reads is a projection of its events,
+// so any earlier state can be rebuilt by replaying them.
+package caseevents
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+)
+
+const (
+	CaseFiled = "CaseFiled"
+	// Snapshot of a case stored before events existed, taken when it was
+	// first changed; its history starts there
+	CaseMigrated          = "CaseMigrated"
+	CaseVerified          = "CaseVerified"
+	JudgeAssigned         = "JudgeAssigned"
+	HearingScheduled      = "HearingScheduled"
+	HearingStatusChanged  = "HearingStatusChanged"
+	HearingRescheduled    = "HearingRescheduled"
+	DeadlineSet           = "DeadlineSet"
+	DeadlineStatusChanged = "DeadlineStatusChanged"
+	StatusChanged         = "StatusChanged"
+	PartyAdded            = "PartyAdded"
+	VerdictIssued         = "VerdictIssued"
+)
+
+// Party roles a PartyAdded event can carry.
+const (
+	RolePlaintiff = "plaintiff"
+	RoleDefendant = "defendant"
+	RoleLawyer    = "lawyer"
+)
+
+var ErrNotFiled = errors.New("case has no CaseFiled event")
+
+// ErrBeforeHistory is returned by AsOf for a time before a migrated case's
+// history starts, where its state isn't known.
+var ErrBeforeHistory = errors.New("case history starts later, when the case was migrated")
+
+type Party struct {
+	Role       string `bson:"role" json:"role"`
+	Name       string `bson:"name,omitempty" json:"name,omitempty"`
+	Email      string `bson:"email,omitempty" json:"email,omitempty"`
+	NationalID string `bson:"nationalId,omitempty" json:"national_id,omitempty"`
+}
+
+// Event is one change to a case. Only the payload field matching Type is
+// set.
+type Event struct {
+	CaseID string `bson:"caseId" json:"case_id"`
+	Seq    int    `bson:"seq" json:"seq"`
+	Type   string `bson:"type" json:"type"`
+	Time   string `bson:"time" json:"time"` // RFC 3339, UTC
+	Actor  string `bson:"actor" json:"actor"`
+
+	Case     *Models.Case     `bson:"case,omitempty" json:"case,omitempty"`         // CaseFiled, CaseMigrated
+	Judge    string           `bson:"judge,omitempty" json:"judge,omitempty"`       // JudgeAssigned
+	Hearing  *Models.Hearing  `bson:"hearing,omitempty" json:"hearing,omitempty"`   // HearingScheduled, HearingStatusChanged, HearingRescheduled
+	Status   string           `bson:"status,omitempty" json:"status,omitempty"`     // StatusChanged
+	Party    *Party           `bson:"party,omitempty" json:"party,omitempty"`       // PartyAdded
+	Verdict  *Models.Verdict  `bson:"verdict,omitempty" json:"verdict,omitempty"`   // VerdictIssued
+	Deadline *Models.Deadline `bson:"deadline,omitempty" json:"deadline,omitempty"` // DeadlineSet, DeadlineStatusChanged
+	Emails   []string         `bson:"emails,omitempty" json:"emails,omitempty"`     // CaseVerified: the case's addresses staff confirmed
+}
+
+// Apply returns c with e applied. c may be nil only for CaseFiled and
+// CaseMigrated.
+func Apply(c *Models.Case, e *Event) (*Models.Case, error) {
+	if e.Type == CaseFiled || e.Type == CaseMigrated {
+		filed := *e.Case
+		filed.Hearings = append([]Models.Hearing(nil), e.Case.Hearings...)
+		filed.Deadlines = append([]Models.Deadline(nil), e.Case.Deadlines...)
+		filed.Version = e.Seq
+		return &filed, nil
+	}
+	if c == nil {
+		return nil, ErrNotFiled
+	}
+	next := *c
+	next.Hearings = append([]Models.Hearing(nil), c.Hearings...)
+	next.Deadlines = append([]Models.Deadline(nil), c.Deadlines...)
+	switch e.Type {
+	case JudgeAssigned:
+		next.Judge = e.Judge
+	case HearingScheduled:
+		replaced := false
+		for i := range next.Hearings {
+			if next.Hearings[i].ID == e.Hearing.ID {
+				next.Hearings[i] = *e.Hearing
+				replaced = true
+			}
+		}
+		if !replaced {
+			next.Hearings = append(next.Hearings, *e.Hearing)
+		}
+	case HearingStatusChanged:
+		for i := range next.Hearings {
+			if next.Hearings[i].ID == e.Hearing.ID {
+				next.Hearings[i].Status = e.Hearing.Status
+				next.Hearings[i].Note = e.Hearing.Note
+			}
+		}
+	case HearingRescheduled:
+		for i := range next.Hearings {
+			if next.Hearings[i].ID == e.Hearing.ID {
+				next.Hearings[i].Date = e.Hearing.Date
+				next.Hearings[i].Courtroom = e.Hearing.Courtroom
+				next.Hearings[i].Status = e.Hearing.Status
+				next.Hearings[i].Note = e.Hearing.Note
+			}
+		}
+	case DeadlineSet:
+		replaced := false
+		for i := range next.Deadlines {
+			if next.Deadlines[i].ID == e.Deadline.ID {
+				next.Deadlines[i] = *e.Deadline
+				replaced = true
+			}
+		}
+		if !replaced {
+			next.Deadlines = append(next.Deadlines, *e.Deadline)
+		}
+	case DeadlineStatusChanged:
+		for i := range next.Deadlines {
+			if next.Deadlines[i].ID == e.Deadline.ID {
+				next.Deadlines[i].Status = e.Deadline.Status
+			}
+		}
+	case CaseVerified:
+		next.Unverified = false
+		next.ConfirmedEmails = confirm(next.ConfirmedEmails, e.Emails...)
+	case StatusChanged:
+		next.Status = e.Status
+	case PartyAdded:
+		// Parties are added by court staff, who vouch for the address
+		if e.Party.Email != "" {
+			next.ConfirmedEmails = confirm(next.ConfirmedEmails, e.Party.Email)
+		}
+		switch e.Party.Role {
+		case RolePlaintiff:
+			next.Plaintiff, next.PlaintiffEmail = e.Party.Name, e.Party.Email
+		case RoleDefendant:
+			next.Defendant, next.DefendantEmail, next.DefendantNationalID = e.Party.Name, e.Party.Email, e.Party.NationalID
+		case RoleLawyer:
+			lawyers := []string{}
+			if next.Lawyers != "" {
+				lawyers = append(lawyers, next.Lawyers)
+			}
+			next.Lawyers = strings.Join(append(lawyers, e.Party.Name), ", ")
+			if e.Party.Email != "" {
+				next.LawyerEmails = append(append([]string(nil), next.LawyerEmails...), e.Party.Email)
+			}
+		}
+	case VerdictIssued:
+		verdict := *e.Verdict
+		next.Verdict = &verdict
+	}
+	next.Version = e.Seq
+	return &next, nil
+}
+
+// confirm returns confirmed with emails added, without changing it.
+func confirm(confirmed []string, emails ...string) []string {
+	next := append([]string(nil), confirmed...)
+	for _, email := range emails {
+		known := false
+		for _, c := range next {
+			known = known || c == email
+		}
+		if !known {
+			next = append(next, email)
+		}
+	}
+	return next
+}
+
+// Replay rebuilds a case from its events, in sequence order.
+func Replay(events []*Event) (*Models.Case, error) {
+	var c *Models.Case
+	var err error
+	for _, e := range events {
+		if c, err = Apply(c, e); err != nil {
+			return nil, err
+		}
+	}
+	if c == nil {
+		return nil, ErrNotFiled
+	}
+	return c, nil
+}
+
+// AsOf rebuilds the case as it was at t, from the events recorded up to
+// then.
+func AsOf(events []*Event, t time.Time) (*Models.Case, error) {
+	var upTo []*Event
+	for _, e := range events {
+		at, err := time.Parse(time.RFC3339Nano, e.Time)
+		if err != nil || at.After(t) {
+			break
+		}
+		upTo = append(upTo, e)
+	}
+	if len(upTo) == 0 && len(events) > 0 && events[0].Type == CaseMigrated {
+		return nil, ErrBeforeHistory
+	}
+	return Replay(upTo)
+}
@@ -0,0 +1,154 @@
+package caseevents
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+)
+
+func history() []*Event {
+	return []*Event{
+		{Seq: 1, Type: CaseFiled, Time: "2024-03-01T09:00:00Z", Case: &Models.Case{ID: "c1", Status: "Open", Unverified: true}},
+		{Seq: 2, Type: CaseVerified, Time: "2024-03-02T09:00:00Z", Emails: []string{"tuzeni@example.com"}},
+		{Seq: 3, Type: JudgeAssigned, Time: "2024-03-03T09:00:00Z", Judge: "Judge Jovanović"},
+		{Seq: 4, Type: HearingScheduled, Time: "2024-03-04T09:00:00Z", Hearing: &Models.Hearing{ID: "h1", Date: "2024-04-01T10:00:00Z", Status: "scheduled"}},
+		{Seq: 5, Type: HearingRescheduled, Time: "2024-03-05T09:00:00Z", Hearing: &Models.Hearing{ID: "h1", Date: "2024-04-08T10:00:00Z", Courtroom: "3", Status: "scheduled"}},
+		{Seq: 6, Type: PartyAdded, Time: "2024-03-06T09:00:00Z", Party: &Party{Role: RoleLawyer, Name: "Adv. Petrović", Email: "petrovic@adv.rs"}},
+		{Seq: 7, Type: PartyAdded, Time: "2024-03-06T10:00:00Z", Party: &Party{Role: RoleLawyer, Name: "Adv. Marić"}},
+		{Seq: 8, Type: DeadlineSet, Time: "2024-03-07T09:00:00Z", Deadline: &Models.Deadline{ID: "d1", Due: "2024-03-20T00:00:00Z"}},
+		{Seq: 9, Type: HearingStatusChanged, Time: "2024-04-08T12:00:00Z", Hearing: &Models.Hearing{ID: "h1", Status: "finished", Note: "Closing arguments heard"}},
+		{Seq: 10, Type: VerdictIssued, Time: "2024-04-15T09:00:00Z", Verdict: &Models.Verdict{Outcome: "Convicted"}},
+		{Seq: 11, Type: StatusChanged, Time: "2024-04-15T09:00:01Z", Status: "Closed"},
+	}
+}
+
+func TestReplay(t *testing.T) {
+	c, err := Replay(history())
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case c.ID != "c1" || c.Version != 11 || c.Unverified:
+		t.Fatalf("case = %+v", c)
+	case c.Judge != "Judge Jovanović" || c.Status != "Closed" || c.Verdict == nil || c.Verdict.Outcome != "Convicted":
+		t.Fatalf("case = %+v", c)
+	case c.Lawyers != "Adv. Petrović, Adv. Marić" || len(c.LawyerEmails) != 1:
+		t.Fatalf("lawyers = %q %v", c.Lawyers, c.LawyerEmails)
+	case len(c.ConfirmedEmails) != 2 || c.ConfirmedEmails[0] != "tuzeni@example.com" || c.ConfirmedEmails[1] != "petrovic@adv.rs":
+		t.Fatalf("confirmed emails = %v", c.ConfirmedEmails)
+	case len(c.Deadlines) != 1 || c.Deadlines[0].ID != "d1":
+		t.Fatalf("deadlines = %+v", c.Deadlines)
+	}
+	h := c.Hearings
+	if len(h) != 1 || h[0].Date != "2024-04-08T10:00:00Z" || h[0].Courtroom != "3" || h[0].Status != "finished" || h[0].Note != "Closing arguments heard" {
+		t.Fatalf("hearings = %+v", h)
+	}
+}
+
+func TestApplyLeavesItsInputAlone(t *testing.T) {
+	events := history()
+	before, err := Replay(events[:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := Apply(before, events[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Hearings[0].Date != "2024-04-01T10:00:00Z" || before.Version != 4 {
+		t.Fatalf("Apply changed its input: %+v", before)
+	}
+	if after.Hearings[0].Date != "2024-04-08T10:00:00Z" || after.Version != 5 {
+		t.Fatalf("Apply() = %+v", after)
+	}
+	// Nor may the case a CaseFiled event carries change with the projection
+	filed, _ := Apply(nil, events[0])
+	filed.Status = "Closed"
+	if events[0].Case.Status != "Open" {
+		t.Fatal("CaseFiled projection shares the event's case")
+	}
+}
+
+func TestDeadlineStatusChanged(t *testing.T) {
+	c, err := Replay(history()[:8])
+	if err != nil {
+		t.Fatal(err)
+	}
+	met, err := Apply(c, &Event{Seq: 9, Type: DeadlineStatusChanged, Deadline: &Models.Deadline{ID: "d1", Status: "met"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := met.Deadlines[0]; d.Status != "met" || d.Due != "2024-03-20T00:00:00Z" {
+		t.Fatalf("deadline = %+v, want met and still due when it was", d)
+	}
+}
+
+func TestApplyNeedsCaseFiled(t *testing.T) {
+	if _, err := Apply(nil, history()[2]); !errors.Is(err, ErrNotFiled) {
+		t.Fatalf("Apply(nil, JudgeAssigned) = %v, want ErrNotFiled", err)
+	}
+	if _, err := Replay(nil); !errors.Is(err, ErrNotFiled) {
+		t.Fatalf("Replay(nil) = %v, want ErrNotFiled", err)
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	at := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+	tests := []struct {
+		at      string
+		version int
+		judge   string
+	}{
+		{"2024-03-03T08:59:59Z", 2, ""},
+		{"2024-03-03T09:00:00Z", 3, "Judge Jovanović"}, // Events at exactly t count
+		{"2030-01-01T00:00:00Z", 11, "Judge Jovanović"},
+	}
+	for _, tt := range tests {
+		c, err := AsOf(history(), at(tt.at))
+		if err != nil || c.Version != tt.version || c.Judge != tt.judge {
+			t.Fatalf("AsOf(%s) = %+v, %v, want version %d", tt.at, c, err, tt.version)
+		}
+	}
+	if _, err := AsOf(history(), at("2024-02-01T00:00:00Z")); !errors.Is(err, ErrNotFiled) {
+		t.Fatalf("AsOf before filing = %v, want ErrNotFiled", err)
+	}
+
+	// An event with an unreadable time ends the replay there
+	events := history()
+	events[3].Time = "yesterday"
+	if c, err := AsOf(events, at("2030-01-01T00:00:00Z")); err != nil || c.Version != 3 {
+		t.Fatalf("AsOf() past a bad time = %+v, %v, want version 3", c, err)
+	}
+}
+
+func TestAsOfMigratedCase(t *testing.T) {
+	at := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+	// Filed in January, stored before events existed and first changed in
+	// May, when its January state was long gone
+	legacy := &Models.Case{ID: "c1", Status: "Open", FilingDate: "2024-01-10T09:00:00Z", Judge: "Judge Jovanović",
+		Hearings: []Models.Hearing{{ID: "h1", Date: "2024-04-08T10:00:00Z", Status: "finished"}}}
+	events := []*Event{
+		{Seq: 1, Type: CaseMigrated, Time: "2024-05-01T08:00:00Z", Case: legacy},
+		{Seq: 2, Type: StatusChanged, Time: "2024-05-01T08:00:00Z", Status: "Closed"},
+	}
+	for _, when := range []string{"2024-01-10T09:00:00Z", "2024-04-30T23:59:59Z"} {
+		if c, err := AsOf(events, at(when)); !errors.Is(err, ErrBeforeHistory) {
+			t.Errorf("AsOf(%s) = %+v, %v, want ErrBeforeHistory", when, c, err)
+		}
+	}
+	c, err := AsOf(events, at("2024-05-01T08:00:00Z"))
+	if err != nil || c.Version != 2 || c.Status != "Closed" || c.Judge != "Judge Jovanović" || len(c.Hearings) != 1 {
+		t.Fatalf("AsOf() after migration = %+v, %v", c, err)
+	}
+	if c, err := Replay(events); err != nil || c.Version != 2 {
+		t.Fatalf("Replay() = %+v, %v, want version 2", c, err)
+	}
+}
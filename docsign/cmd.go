@@ -0,0 +1,43 @@
+package docsign
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// RunVerify is the entry point of the "verify-document" subcommand:
+//
+//	court verify-document -keys signing-keys.json certificate.json
+//
+// where signing-keys.json is the output of GET /signing-keys.
+func RunVerify(args []string) error {
+	fs := flag.NewFlagSet("verify-document", flag.ContinueOnError)
+	keysPath := fs.String("keys", "", "JSON file with the court's published public keys")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *keysPath == "" || fs.NArg() != 1 {
+		return errors.New("usage: verify-document -keys keys.json document.json")
+	}
+	rawKeys, err := os.ReadFile(*keysPath)
+	if err != nil {
+		return err
+	}
+	var keys []PublicKey
+	if err := json.Unmarshal(rawKeys, &keys); err != nil {
+		return err
+	}
+	document, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	sig, err := VerifyDocument(keys, document)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("valid: signed with key %s\n", sig.KeyID)
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package docsign signs court documents with Ed25519 over their RFC 8785
+// canonical JSON form and verifies them, online or offline, against the
+// court's published public keys. Private keys live in files outside the
+// database; see LoadKeyDir.
+package docsign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const Algorithm = "Ed25519"
+
+// signatureField is the JSON field a signed document carries its signature in.
+const signatureField = "signature"
+
+var (
+	ErrUnsigned     = errors.New("document is not signed")
+	ErrUnknownKey   = errors.New("document signed with an unknown key")
+	ErrBadSignature = errors.New("document signature does not match its content")
+)
+
+type Signature struct {
+	KeyID            string `bson:"keyId" json:"key_id"`
+	Algorithm        string `bson:"algorithm" json:"algorithm"`
+	Canonicalization string `bson:"canonicalization,omitempty" json:"canonicalization,omitempty"` // CanonicalizationJCS, or empty for Canonicalize
+	Value            string `bson:"value" json:"value"`                                           // Base64 of the signature over the canonical payload
+}
+
+// PublicKey is the published half of a signing key. Retired keys stay
+// published so documents signed before a rotation keep verifying.
+type PublicKey struct {
+	KeyID     string `bson:"keyId" json:"key_id"`
+	Algorithm string `bson:"algorithm" json:"algorithm"`
+	PublicKey string `bson:"publicKey" json:"public_key"` // Base64
+	CreatedAt string `bson:"createdAt" json:"created_at"`
+	RetiredAt string `bson:"retiredAt,omitempty" json:"retired_at,omitempty"`
+}
+
+// Key is a signing key with its private half.
+type Key struct {
+	PublicKey
+	Private ed25519.PrivateKey
+}
+
+// GenerateKey creates a new key identified by keyID.
+func GenerateKey(keyID string) (*Key, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{
+		PublicKey: PublicKey{
+			KeyID:     keyID,
+			Algorithm: Algorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(pub),
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		},
+		Private: priv,
+	}, nil
+}
+
+// Canonicalize returns v as Go's encoding/json writes it, with the top
+// level "signature" field removed: no whitespace, object keys sorted by
+// their UTF-8 bytes, numbers exactly as they appear in the input, and <, >,
+// &, U+2028 and U+2029 escaped as \u003c, \u003e, \u0026, \u2028 and
+// \u2029. It is not RFC 8785; documents signed before CanonicalizeJCS, and
+// the audit log's hash chain, use it.
+func Canonicalize(v interface{}) ([]byte, error) {
+	generic, err := decodeGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	// encoding/json writes map keys in sorted order
+	return json.Marshal(generic)
+}
+
+// canonicalize picks the form a signature was made over.
+func canonicalize(canonicalization string, v interface{}) ([]byte, error) {
+	switch canonicalization {
+	case CanonicalizationJCS:
+		return CanonicalizeJCS(v)
+	case "":
+		return Canonicalize(v)
+	}
+	return nil, ErrBadSignature
+}
+
+// Sign signs the RFC 8785 canonical form of v.
+func Sign(key *Key, v interface{}) (*Signature, error) {
+	payload, err := CanonicalizeJCS(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		KeyID:            key.KeyID,
+		Algorithm:        Algorithm,
+		Canonicalization: CanonicalizationJCS,
+		Value:            base64.StdEncoding.EncodeToString(ed25519.Sign(key.Private, payload)),
+	}, nil
+}
+
+// VerifyPayload checks sig over the canonical form of v it names.
+func VerifyPayload(keys []PublicKey, v interface{}, sig Signature) error {
+	var pub *PublicKey
+	for i := range keys {
+		if keys[i].KeyID == sig.KeyID {
+			pub = &keys[i]
+			break
+		}
+	}
+	if pub == nil || pub.Algorithm != sig.Algorithm || sig.Algorithm != Algorithm {
+		return ErrUnknownKey
+	}
+	rawPub, err := base64.StdEncoding.DecodeString(pub.PublicKey)
+	if err != nil || len(rawPub) != ed25519.PublicKeySize {
+		return ErrUnknownKey
+	}
+	rawSig, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return ErrBadSignature
+	}
+	payload, err := canonicalize(sig.Canonicalization, v)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(rawPub, payload, rawSig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// VerifyDocument verifies a signed JSON document as issued by the court,
+// with its signature embedded in the "signature" field. It needs nothing
+// but the published public keys.
+func VerifyDocument(keys []PublicKey, document []byte) (*Signature, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(document, &envelope); err != nil {
+		return nil, err
+	}
+	rawSig, ok := envelope[signatureField]
+	if !ok {
+		return nil, ErrUnsigned
+	}
+	var sig Signature
+	if err := json.Unmarshal(rawSig, &sig); err != nil {
+		return nil, ErrUnsigned
+	}
+	return &sig, VerifyPayload(keys, document, sig)
+}
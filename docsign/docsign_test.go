@@ -0,0 +1,145 @@
+package docsign
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type document struct {
+	Number    string     `json:"number"`
+	Holder    string     `json:"holder"`
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+func signValue(key *Key, payload []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key.Private, payload))
+}
+
+func signed(t *testing.T, key *Key, d document) []byte {
+	t.Helper()
+	sig, err := Sign(key, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Signature = sig
+	raw, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestSignAndVerify(t *testing.T) {
+	key, err := GenerateKey("k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := GenerateKey("k2")
+	keys := []PublicKey{key.PublicKey}
+	doc := signed(t, key, document{Number: "UV-1", Holder: "Ana <Anić> & co"})
+
+	if sig, err := VerifyDocument(keys, doc); err != nil || sig.KeyID != "k1" || sig.Canonicalization != CanonicalizationJCS {
+		t.Fatalf("VerifyDocument() = %+v, %v", sig, err)
+	}
+
+	// Re-encoding, here with indentation and another key order, keeps it valid
+	var generic map[string]interface{}
+	json.Unmarshal(doc, &generic)
+	reencoded, _ := json.MarshalIndent(generic, "", "  ")
+	if _, err := VerifyDocument(keys, reencoded); err != nil {
+		t.Fatalf("re-encoded document: %v", err)
+	}
+
+	generic["holder"] = "Someone else"
+	tampered, _ := json.Marshal(generic)
+	if _, err := VerifyDocument(keys, tampered); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("tampered document: %v, want ErrBadSignature", err)
+	}
+	if _, err := VerifyDocument([]PublicKey{other.PublicKey}, doc); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("unknown key: %v, want ErrUnknownKey", err)
+	}
+	unsigned, _ := json.Marshal(document{Number: "UV-1"})
+	if _, err := VerifyDocument(keys, unsigned); !errors.Is(err, ErrUnsigned) {
+		t.Fatalf("unsigned document: %v, want ErrUnsigned", err)
+	}
+}
+
+func TestLegacySignaturesVerify(t *testing.T) {
+	key, _ := GenerateKey("old")
+	doc := document{Number: "UV-1", Holder: "A & B"}
+	payload, err := Canonicalize(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Signed the way documents were before JCS: no canonicalization named
+	sig := &Signature{KeyID: key.KeyID, Algorithm: Algorithm, Value: signValue(key, payload)}
+	if err := VerifyPayload([]PublicKey{key.PublicKey}, doc, *sig); err != nil {
+		t.Fatalf("legacy signature: %v", err)
+	}
+	sig.Canonicalization = "something new"
+	if err := VerifyPayload([]PublicKey{key.PublicKey}, doc, *sig); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("unknown canonicalization: %v, want ErrBadSignature", err)
+	}
+}
+
+func TestCanonicalizeJCS(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		// RFC 8785, section 3.2.2
+		{"rfc example",
+			`{"numbers":[333333333.33333329,1E30,4.50,2e-3,0.000000000000000000000000001],"string":"\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/","literals":[null,true,false]}`,
+			`{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`},
+		// RFC 8785, section 3.2.3: UTF-16 order puts the emoji before U+FB33
+		{"key order",
+			`{"\u20ac":1,"\r":2,"\ufb33":3,"1":4,"\ud83d\ude00":5,"\u0080":6,"\u00f6":7}`,
+			"{\"\\r\":2,\"1\":4,\"\u0080\":6,\"\u00f6\":7,\"\u20ac\":1,\"\U0001F600\":5,\"\ufb33\":3}"},
+		{"no html escaping", `{"a":"<b> & \u2028"}`, "{\"a\":\"<b> & \u2028\"}"},
+		{"numbers", `[0,-0,1e21,1e20,1e-7,0.000001,5e-324,9007199254740992,-1.5]`,
+			`[0,0,1e+21,100000000000000000000,1e-7,0.000001,5e-324,9007199254740992,-1.5]`},
+		{"signature dropped", `{"b":1,"signature":{"x":1},"a":{"signature":2}}`, `{"a":{"signature":2},"b":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalizeJCS([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("CanonicalizeJCS() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyDir(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := GenerateKey("court-1")
+	if err := WriteKeyFile(dir, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteKeyFile(dir, key); err == nil {
+		t.Fatal("WriteKeyFile() overwrote an existing key")
+	}
+	if info, _ := os.Stat(filepath.Join(dir, "court-1.pem")); info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file mode = %v", info.Mode())
+	}
+	keys, err := LoadKeyDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := keys["court-1"]
+	if loaded == nil || loaded.PublicKey.PublicKey != key.PublicKey.PublicKey || !loaded.Private.Equal(key.Private) {
+		t.Fatalf("LoadKeyDir() = %+v", keys)
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("nope"), 0o600)
+	if _, err := LoadKeyDir(dir); err == nil {
+		t.Fatal("LoadKeyDir() accepted a broken key file")
+	}
+}
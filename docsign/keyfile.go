@@ -0,0 +1,116 @@
+package docsign
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// keyFileExt names the files LoadKeyDir reads: one PKCS #8 PEM private key
+// per file, named after its key ID.
+const keyFileExt = ".pem"
+
+// LoadKeyDir reads the signing keys in dir, typically a mounted secret.
+// Only their public halves are ever stored elsewhere.
+func LoadKeyDir(dir string) (map[string]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*Key, len(paths))
+	for _, path := range paths {
+		key, err := readKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys[key.KeyID] = key
+	}
+	return keys, nil
+}
+
+func readKeyFile(path string) (*Key, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("not a PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 key")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{
+		PublicKey: PublicKey{
+			KeyID:     strings.TrimSuffix(filepath.Base(path), keyFileExt),
+			Algorithm: Algorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(private.Public().(ed25519.PublicKey)),
+			CreatedAt: info.ModTime().UTC().Format(time.RFC3339),
+		},
+		Private: private,
+	}, nil
+}
+
+// WriteKeyFile stores key in dir, readable by its owner only.
+func WriteKeyFile(dir string, key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, key.KeyID+keyFileExt)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RunGenerateKey is the entry point of the "generate-signing-key"
+// subcommand:
+//
+//	court generate-signing-key -dir /run/secrets/signing-keys court-2024-01
+//
+// The key is then put to use with POST /admin/signing-keys/rotate.
+func RunGenerateKey(args []string) error {
+	fs := flag.NewFlagSet("generate-signing-key", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory the court loads its signing keys from")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" || fs.NArg() != 1 {
+		return errors.New("usage: generate-signing-key -dir keys/ key-id")
+	}
+	if strings.ContainsAny(fs.Arg(0), `/\`) || strings.HasPrefix(fs.Arg(0), ".") {
+		return errors.New("key id can't be a path")
+	}
+	key, err := GenerateKey(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := WriteKeyFile(*dir, key); err != nil {
+		return err
+	}
+	fmt.Printf("generated %s\n", key.KeyID)
+	return nil
+}
@@ -0,0 +1,162 @@
+// Package eventstream fans the outbox out to live subscribers, such as
+// Server-Sent Events connections. It tails the outbox by Seq, so every
+// replica sees every message and a subscriber that fell behind can resume
+// from the last Seq it saw.
+package eventstream
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/EupravaProjekat/court/outbox"
+)
+
+// pageSize bounds how many messages one read of the store returns.
+const pageSize = 500
+
+// Store reads the outbox in Seq order.
+type Store interface {
+	// MessagesAfter returns up to limit messages with Seq above seq, oldest
+	// first.
+	MessagesAfter(ctx context.Context, seq int64, limit int64) ([]*outbox.Message, error)
+	// LastSeq is the highest Seq committed so far, 0 when there is none.
+	LastSeq(ctx context.Context) (int64, error)
+}
+
+// Subscription receives messages committed after it was taken. C is
+// closed when the subscriber falls too far behind; it should then resume
+// from the last Seq it handled.
+type Subscription struct {
+	C <-chan *outbox.Message
+	c chan *outbox.Message
+}
+
+type Hub struct {
+	store  Store
+	poll   time.Duration
+	buffer int
+	logger *log.Logger
+
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	last    int64 // Seq of the newest message seen
+	started bool
+	wake    chan struct{}
+}
+
+// NewHub returns a hub polling the store every poll interval, and sooner
+// when notified of a local commit.
+func NewHub(store Store, poll time.Duration, logger *log.Logger) *Hub {
+	return &Hub{
+		store:  store,
+		poll:   poll,
+		buffer: 256,
+		logger: logger,
+		subs:   map[*Subscription]struct{}{},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func (h *Hub) Subscribe() *Subscription {
+	c := make(chan *outbox.Message, h.buffer)
+	s := &Subscription{C: c, c: c}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
+
+// Notify makes the hub look for new messages now.
+func (h *Hub) Notify() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Replay hands fn every message with Seq above after, oldest first.
+func (h *Hub) Replay(ctx context.Context, after int64, fn func(m *outbox.Message) error) error {
+	for {
+		messages, err := h.store.MessagesAfter(ctx, after, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, m := range messages {
+			if err := fn(m); err != nil {
+				return err
+			}
+			after = m.Seq
+		}
+		if len(messages) < pageSize {
+			return nil
+		}
+	}
+}
+
+// Run tails the outbox until ctx is done. Messages committed before Run
+// starts are left to Replay.
+func (h *Hub) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.poll)
+	defer ticker.Stop()
+	for {
+		if err := h.tail(ctx); err != nil && ctx.Err() == nil {
+			h.logger.Printf("eventstream: reading outbox failed: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-h.wake:
+		}
+	}
+}
+
+func (h *Hub) tail(ctx context.Context) error {
+	h.mu.Lock()
+	idle, started, last := len(h.subs) == 0, h.started, h.last
+	h.mu.Unlock()
+	if idle || !started {
+		// Nobody to send to: just keep up with the head
+		seq, err := h.store.LastSeq(ctx)
+		if err != nil {
+			return err
+		}
+		h.mu.Lock()
+		if seq > h.last {
+			h.last = seq
+		}
+		h.started = true
+		h.mu.Unlock()
+		return nil
+	}
+	return h.Replay(ctx, last, func(m *outbox.Message) error {
+		h.broadcast(m)
+		return nil
+	})
+}
+
+func (h *Hub) broadcast(m *outbox.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		select {
+		case s.c <- m:
+		default:
+			// Too far behind; it resumes from the store
+			delete(h.subs, s)
+			close(s.c)
+		}
+	}
+	h.last = m.Seq
+}
@@ -8,11 +8,15 @@ require (
 	github.com/MihajloJankovic/accommodation-service v0.0.0-20240209074912-fc2628245d07
 	github.com/MihajloJankovic/profile-service v0.0.0-20231217093457-6b8b822e74ae
 	github.com/MihajloJankovic/reservation-service v0.0.0-20240209123025-24a373438000
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/golang-jwt/jwt/v5 v5.2.0
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/handlers v1.5.2
 	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	go.mongodb.org/mongo-driver v1.13.1
+	golang.org/x/image v0.15.0
 )
 
 require (
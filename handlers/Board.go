@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	boardPingInterval = 30 * time.Second
+	boardWriteTimeout = 10 * time.Second
+)
+
+// boardEvents are the case changes that can alter what a board shows.
+var boardEvents = map[string]bool{
+	caseevents.CaseFiled:            true,
+	caseevents.CaseVerified:         true,
+	caseevents.JudgeAssigned:        true,
+	caseevents.HearingScheduled:     true,
+	caseevents.HearingStatusChanged: true,
+	caseevents.HearingRescheduled:   true,
+	caseevents.PartyAdded:           true,
+}
+
+// The board only sends and authenticates with a token rather than a
+// cookie, so any origin may connect.
+var boardUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+type boardHearing struct {
+	HearingID string `json:"hearing_id"`
+	Docket    string `json:"docket"`
+	Time      string `json:"time"`
+	Status    string `json:"status"`
+	Note      string `json:"note,omitempty"`
+	CaseType  string `json:"case_type,omitempty"`
+	Judge     string `json:"judge,omitempty"`
+	Plaintiff string `json:"plaintiff,omitempty"`
+	Defendant string `json:"defendant,omitempty"`
+	Redacted  bool   `json:"redacted,omitempty"` // Party names withheld
+}
+type boardCourtroom struct {
+	Courtroom string         `json:"courtroom"`
+	Hearings  []boardHearing `json:"hearings"`
+}
+type courtBoard struct {
+	Date       string           `json:"date"`
+	Courtrooms []boardCourtroom `json:"courtrooms"`
+}
+
+// buildBoard lists the day's hearings by courtroom and time. The public
+// board leaves out party names of confidential cases.
+func (h *Courthandler) buildBoard(day, courtroom string, public bool) (*courtBoard, error) {
+	start, err := time.ParseInLocation("2006-01-02", day, h.cfg.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	// Hearing dates carry their own offsets, so look a day either side
+	// and keep those falling on the local day
+	cases, err := h.repo.GetCasesWithHearingsBetween(
+		start.AddDate(0, 0, -1).Format("2006-01-02"),
+		start.AddDate(0, 0, 2).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	rooms := map[string][]boardHearing{}
+	for _, c := range cases {
+		for _, hearing := range c.Hearings {
+			at, err := time.Parse(time.RFC3339, hearing.Date)
+			if err != nil || at.In(h.cfg.TimeZone).Format("2006-01-02") != day {
+				continue
+			}
+			if courtroom != "" && hearing.Courtroom != courtroom {
+				continue
+			}
+			entry := boardEntry(c, hearing, at.In(h.cfg.TimeZone), public)
+			rooms[hearing.Courtroom] = append(rooms[hearing.Courtroom], entry)
+		}
+	}
+	board := &courtBoard{Date: day, Courtrooms: []boardCourtroom{}}
+	for name, hearings := range rooms {
+		sort.Slice(hearings, func(i, j int) bool { return hearings[i].Time < hearings[j].Time })
+		board.Courtrooms = append(board.Courtrooms, boardCourtroom{Courtroom: name, Hearings: hearings})
+	}
+	sort.Slice(board.Courtrooms, func(i, j int) bool { return board.Courtrooms[i].Courtroom < board.Courtrooms[j].Courtroom })
+	return board, nil
+}
+
+// boardEntry shows a hearing at local time at. The public board leaves
+// out the parties of confidential cases and the hearing's note, which may
+// name them.
+func boardEntry(c *Models.Case, hearing Models.Hearing, at time.Time, public bool) boardHearing {
+	entry := boardHearing{
+		HearingID: hearing.ID,
+		Docket:    c.ID,
+		Time:      at.Format("15:04"),
+		Status:    hearing.Status,
+		Note:      hearing.Note,
+		CaseType:  c.Type,
+		Judge:     c.Judge,
+		Plaintiff: c.Plaintiff,
+		Defendant: c.Defendant,
+	}
+	if public && c.Visibility == CaseVisibilityConfidential {
+		entry.Plaintiff, entry.Defendant, entry.Note, entry.Redacted = "", "", "", true
+	}
+	return entry
+}
+
+// CourtroomBoard pushes the day's hearing schedule to court staff over a
+// WebSocket, and again whenever it changes. Browsers can't set headers on
+// it, so they connect with a ticket from IssueStreamTicket. The socket is
+// closed when the session ends.
+func (h *Courthandler) CourtroomBoard(w http.ResponseWriter, r *http.Request) {
+	session := h.streamAuth(r)
+	if session == nil || !isStaff(session.user) {
+		http.Error(w, "user doesnt exist", http.StatusForbidden)
+		return
+	}
+	h.serveBoard(w, r, session)
+}
+
+// PublicCourtroomBoard is the lobby board: read-only, unauthenticated, and
+// without party names of confidential cases.
+func (h *Courthandler) PublicCourtroomBoard(w http.ResponseWriter, r *http.Request) {
+	h.serveBoard(w, r, nil)
+}
+
+// serveBoard shows the date query parameter's day, or today, optionally
+// for one courtroom. Without a date the board follows the calendar past
+// midnight. Without a session it is the public board.
+func (h *Courthandler) serveBoard(w http.ResponseWriter, r *http.Request, session *streamSession) {
+	query := r.URL.Query()
+	key := boardKey{date: query.Get("date"), courtroom: query.Get("courtroom"), public: session == nil}
+	if key.date != "" {
+		if _, err := time.Parse("2006-01-02", key.date); err != nil {
+			http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	screen, leave, err := h.watchBoard(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer leave()
+
+	conn, err := boardUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered already
+		return
+	}
+	defer conn.Close()
+
+	// The board only sends; reading keeps pongs and the close handshake
+	// flowing and notices when the screen goes away.
+	gone := make(chan struct{})
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * boardPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * boardPingInterval))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Staff boards end with their session; nil channels never fire
+	var expiry, check <-chan time.Time
+	if session != nil {
+		timer := time.NewTimer(time.Until(session.expires))
+		defer timer.Stop()
+		ticker := time.NewTicker(sessionCheckInterval)
+		defer ticker.Stop()
+		expiry, check = timer.C, ticker.C
+	}
+	expired := func() {
+		msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session expired")
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(boardWriteTimeout))
+	}
+
+	ping := time.NewTicker(boardPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case <-expiry:
+			expired()
+			return
+		case <-check:
+			if !h.sessionValid(session) {
+				expired()
+				return
+			}
+		case <-ping.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(boardWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case data := <-screen:
+			_ = conn.SetWriteDeadline(time.Now().Add(boardWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// boardKey is what a board shows; an empty date follows today.
+type boardKey struct {
+	date, courtroom string
+	public          bool
+}
+
+// boardFeed builds one board for every screen showing it.
+type boardFeed struct {
+	screens map[chan []byte]bool
+	latest  []byte // Last board sent, as JSON
+	stop    context.CancelFunc
+}
+
+// boardFeeds shares board builds between screens and counts the public
+// ones, which anyone can open.
+type boardFeeds struct {
+	mu     sync.Mutex
+	feeds  map[boardKey]*boardFeed
+	public int
+}
+
+var errBoardsFull = errors.New("too many public boards are open")
+
+// watchBoard adds a screen to key's feed, starting the feed for the first
+// one. The screen gets every changed board, or only the latest if it falls
+// behind; leave removes it and stops the feed after the last.
+func (h *Courthandler) watchBoard(key boardKey) (screen chan []byte, leave func(), err error) {
+	b := h.boards
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if key.public {
+		if b.public >= h.cfg.MaxPublicBoards {
+			return nil, nil, errBoardsFull
+		}
+		b.public++
+	}
+	feed := b.feeds[key]
+	if feed == nil {
+		ctx, stop := context.WithCancel(context.Background())
+		feed = &boardFeed{screens: map[chan []byte]bool{}, stop: stop}
+		b.feeds[key] = feed
+		go h.runBoardFeed(ctx, key, feed)
+	}
+	screen = make(chan []byte, 1)
+	if feed.latest != nil {
+		screen <- feed.latest
+	}
+	feed.screens[screen] = true
+	leave = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(feed.screens, screen)
+		if key.public {
+			b.public--
+		}
+		if len(feed.screens) == 0 && b.feeds[key] == feed {
+			feed.stop()
+			delete(b.feeds, key)
+		}
+	}
+	return screen, leave, nil
+}
+
+// runBoardFeed rebuilds the board once per relevant change and when the
+// day it follows turns over.
+func (h *Courthandler) runBoardFeed(ctx context.Context, key boardKey, feed *boardFeed) {
+	sub := h.stream.Subscribe()
+	defer func() { h.stream.Unsubscribe(sub) }()
+
+	today := func() string {
+		if key.date != "" {
+			return key.date
+		}
+		return time.Now().In(h.cfg.TimeZone).Format("2006-01-02")
+	}
+	day := today()
+	built := false
+	build := func() {
+		board, err := h.buildBoard(day, key.courtroom, key.public)
+		if err != nil {
+			log.Printf("Operation Failed: %v\n", err)
+			built = false
+			return
+		}
+		data, err := json.Marshal(board)
+		if err != nil {
+			log.Printf("Operation Failed: %v\n", err)
+			built = false
+			return
+		}
+		h.publishBoard(feed, data)
+		built = true
+	}
+	build()
+
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			// Picks up the next day once midnight has passed, or retries
+			// a failed build
+			if next := today(); next != day || !built {
+				day = next
+				build()
+			}
+		case m, ok := <-sub.C:
+			if !ok {
+				// Fell behind; catch up from the current state
+				sub = h.stream.Subscribe()
+				build()
+				continue
+			}
+			if m.AggregateType == "case" && boardEvents[m.Type] {
+				build()
+			}
+		}
+	}
+}
+
+// publishBoard sends data to the feed's screens unless it is unchanged.
+// Only the feed sends to its screens, so after dropping an unread board
+// the send can't block.
+func (h *Courthandler) publishBoard(feed *boardFeed, data []byte) {
+	b := h.boards
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if bytes.Equal(data, feed.latest) {
+		return
+	}
+	feed.latest = data
+	for screen := range feed.screens {
+		select {
+		case <-screen:
+		default:
+		}
+		screen <- data
+	}
+}
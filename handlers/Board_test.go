@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+)
+
+func TestPublishBoard(t *testing.T) {
+	h := &Courthandler{boards: &boardFeeds{feeds: map[boardKey]*boardFeed{}}}
+	feed := &boardFeed{screens: map[chan []byte]bool{}}
+	slow, fast := make(chan []byte, 1), make(chan []byte, 1)
+	feed.screens[slow], feed.screens[fast] = true, true
+
+	h.publishBoard(feed, []byte("a"))
+	if got := string(<-fast); got != "a" {
+		t.Fatalf("fast screen got %q, want a", got)
+	}
+	h.publishBoard(feed, []byte("a"))
+	select {
+	case got := <-fast:
+		t.Fatalf("unchanged board sent again: %q", got)
+	default:
+	}
+	// The slow screen never read a; it skips to the latest board
+	h.publishBoard(feed, []byte("b"))
+	if got := string(<-slow); got != "b" {
+		t.Fatalf("slow screen got %q, want b", got)
+	}
+	if got := string(<-fast); got != "b" {
+		t.Fatalf("fast screen got %q, want b", got)
+	}
+}
+
+func TestBoardEntryRedactsConfidentialCases(t *testing.T) {
+	hearing := Models.Hearing{ID: "h1", Courtroom: "3", Status: HearingDelayed, Note: "Witness Marković is ill"}
+	open := &Models.Case{ID: "c1", Type: "Civil", Plaintiff: "Ana Anić", Defendant: "Marko Marković"}
+	confidential := *open
+	confidential.Visibility = CaseVisibilityConfidential
+	at := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		c          *Models.Case
+		public     bool
+		wantShown  bool
+		wantHidden bool
+	}{
+		{"staff board, confidential case", &confidential, false, true, false},
+		{"public board, open case", open, true, true, false},
+		{"public board, confidential case", &confidential, true, false, true},
+	}
+	for _, tt := range tests {
+		e := boardEntry(tt.c, hearing, at, tt.public)
+		shown := e.Plaintiff != "" && e.Defendant != "" && e.Note != ""
+		hidden := e.Plaintiff == "" && e.Defendant == "" && e.Note == "" && e.Redacted
+		if shown != tt.wantShown || hidden != tt.wantHidden {
+			t.Errorf("%s: got %+v", tt.name, e)
+		}
+		if e.Time != "10:30" || e.Status != HearingDelayed || e.Docket != "c1" {
+			t.Errorf("%s: schedule details lost: %+v", tt.name, e)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"hash"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CaseVisibilityPublic       = "public"
+	CaseVisibilityConfidential = "confidential"
+
+	ConfidentialityPublic  = "public"
+	ConfidentialityParties = "parties"
+	ConfidentialitySealed  = "sealed"
+
+	PartyCourt     = "court"
+	PartyPlaintiff = "plaintiff"
+	PartyDefendant = "defendant"
+)
+
+var documentTypes = map[string]bool{"filing": true, "evidence": true, "minutes": true, "judgment": true, "other": true}
+
+// allowedContentTypes are the sniffed types accepted for case documents.
+var allowedContentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"text/plain":      true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
+}
+
+// partyOf returns which side of the case the user is on, if any.
+func partyOf(u *Models.User, c *Models.Case) string {
+	switch {
+	case u.Email == "":
+		return ""
+	case c.Unverified && u.Email != c.PlaintiffEmail:
+		// Until staff confirm a citizen's filing only the filer is a party
+		return ""
+	case u.Email == c.PlaintiffEmail:
+		return PartyPlaintiff
+	case u.Email == c.DefendantEmail:
+		return PartyDefendant
+	}
+	return ""
+}
+
+// canSeeDocument applies the document's confidentiality on top of the
+// case's visibility: sealed documents are for staff only, parties see the
+// rest, and others see public documents of public cases.
+func canSeeDocument(u *Models.User, c *Models.Case, d *Models.CaseDocument) bool {
+	switch {
+	case isStaff(u):
+		return true
+	case d.Confidentiality == ConfidentialitySealed:
+		return false
+	case partyOf(u, c) != "":
+		return true
+	}
+	return c.Visibility != CaseVisibilityConfidential && d.Confidentiality == ConfidentialityPublic
+}
+
+// caseForDocuments loads the route's case if the caller may see at least
+// some of its documents.
+func (h *Courthandler) caseForDocuments(w http.ResponseWriter, r *http.Request) (*Models.User, *Models.Case) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, nil
+	}
+	c, err := h.repo.GetCase(mux.Vars(r)["id"])
+	if err != nil || (c.Visibility == CaseVisibilityConfidential && !canAccessCase(user, c)) {
+		http.Error(w, "Case not found", http.StatusNotFound)
+		return nil, nil
+	}
+	return user, c
+}
+
+// sniffContentType trusts the content over the client's claim. Word
+// documents sniff as zip, so the extension decides for those.
+func sniffContentType(head []byte, filename string) string {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if contentType == "application/zip" && strings.EqualFold(filepath.Ext(filename), ".docx") {
+		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	}
+	return contentType
+}
+
+type countingHash struct {
+	hash.Hash
+	n int64
+}
+
+func (c *countingHash) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return c.Hash.Write(p)
+}
+
+// UploadCaseDocument streams a multipart upload into GridFS. The form
+// fields doc_type, confidentiality and (for staff) party must come before
+// the file part.
+func (h *Courthandler) UploadCaseDocument(w http.ResponseWriter, r *http.Request) {
+	user, c := h.caseForDocuments(w, r)
+	if user == nil {
+		return
+	}
+	party := partyOf(user, c)
+	if !isStaff(user) && party == "" {
+		http.Error(w, "only court staff and parties can file documents", http.StatusForbidden)
+		return
+	}
+	doc := Models.CaseDocument{
+		ID:              uuid.New().String(),
+		Version:         1,
+		CaseID:          c.ID,
+		Uploader:        user.Email,
+		Party:           party,
+		DocType:         "other",
+		Confidentiality: ConfidentialityParties,
+	}
+	h.receiveCaseDocument(w, r, user, &doc)
+}
+
+// receiveCaseDocument reads the multipart form into doc, whose fields hold
+// the defaults, and stores the file part. A new version keeps its
+// predecessor's confidentiality unless court staff change it.
+func (h *Courthandler) receiveCaseDocument(w http.ResponseWriter, r *http.Request, user *Models.User, doc *Models.CaseDocument) {
+	previous := doc.Confidentiality
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "expect multipart/form-data", http.StatusBadRequest)
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			http.Error(w, "file part missing", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			value, _ := io.ReadAll(io.LimitReader(part, 256))
+			switch part.FormName() {
+			case "doc_type":
+				doc.DocType = string(value)
+			case "confidentiality":
+				doc.Confidentiality = string(value)
+			case "party":
+				if isStaff(user) {
+					doc.Party = string(value)
+				}
+			}
+			continue
+		}
+
+		if !documentTypes[doc.DocType] {
+			http.Error(w, "unknown doc_type", http.StatusBadRequest)
+			return
+		}
+		switch doc.Confidentiality {
+		case ConfidentialityPublic, ConfidentialityParties:
+		case ConfidentialitySealed:
+			if !isStaff(user) {
+				http.Error(w, "only court staff can seal documents", http.StatusForbidden)
+				return
+			}
+		default:
+			http.Error(w, "unknown confidentiality", http.StatusBadRequest)
+			return
+		}
+		if doc.Version > 1 && doc.Confidentiality != previous && !isStaff(user) {
+			http.Error(w, "only court staff can change a document's confidentiality", http.StatusForbidden)
+			return
+		}
+		if doc.Party == "" {
+			doc.Party = PartyCourt
+		}
+		doc.Filename = filepath.Base(part.FileName())
+		h.storeCaseDocument(w, r, part, doc)
+		return
+	}
+}
+func (h *Courthandler) storeCaseDocument(w http.ResponseWriter, r *http.Request, content io.Reader, doc *Models.CaseDocument) {
+	br := bufio.NewReaderSize(content, 512)
+	head, _ := br.Peek(512)
+	doc.ContentType = sniffContentType(head, doc.Filename)
+	if !allowedContentTypes[doc.ContentType] {
+		http.Error(w, "content type "+doc.ContentType+" not allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Hash and count while streaming; one byte over the limit is enough to
+	// know the upload is too large.
+	sum := &countingHash{Hash: sha256.New()}
+	limited := io.TeeReader(io.LimitReader(br, h.cfg.MaxCaseDocumentSize+1), sum)
+	metadata := bson.M{"caseId": doc.CaseID, "documentId": doc.ID, "version": doc.Version}
+	fileID, err := h.repo.UploadCaseFile(doc.Filename, limited, metadata)
+	if err != nil {
+		http.Error(w, "Failed to store the document", http.StatusInternalServerError)
+		return
+	}
+	if sum.n > h.cfg.MaxCaseDocumentSize {
+		_ = h.repo.DeleteCaseFile(fileID)
+		http.Error(w, "document too large, max "+strconv.FormatInt(h.cfg.MaxCaseDocumentSize, 10)+" bytes", http.StatusRequestEntityTooLarge)
+		return
+	}
+	doc.FileID = fileID
+	doc.Size = sum.n
+	doc.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	doc.UploadedAt = time.Now().Format(time.RFC3339)
+	doc.ChainHash = documentChainHash(doc)
+	err = h.repo.NewCaseDocument(doc)
+	if err != nil {
+		_ = h.repo.DeleteCaseFile(fileID)
+		if Repo.IsDuplicate(err) {
+			http.Error(w, "A newer version was uploaded meanwhile", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to store the document", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, doc.Uploader, "document.upload", documentTarget(doc), nil, doc)
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, doc)
+}
+func (h *Courthandler) GetCaseDocuments(w http.ResponseWriter, r *http.Request) {
+	user, c := h.caseForDocuments(w, r)
+	if user == nil {
+		return
+	}
+	docs, err := h.repo.GetCaseDocuments(c.ID)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Documents not found", http.StatusInternalServerError)
+		return
+	}
+	// List each document once, as its latest version, and only if the
+	// caller may see that version: an older visible version must not stand
+	// in for a newer sealed one.
+	index := map[string]int{}
+	latest := []*Models.CaseDocument{}
+	for _, d := range docs {
+		if i, ok := index[d.ID]; ok {
+			if d.Version > latest[i].Version {
+				latest[i] = d
+			}
+			continue
+		}
+		index[d.ID] = len(latest)
+		latest = append(latest, d)
+	}
+	visible := []*Models.CaseDocument{}
+	for _, d := range latest {
+		if canSeeDocument(user, c, d) {
+			visible = append(visible, d)
+		}
+	}
+	RenderJSON(w, visible)
+}
+
+// DownloadCaseDocument streams the latest version of a document.
+func (h *Courthandler) DownloadCaseDocument(w http.ResponseWriter, r *http.Request) {
+	user, c := h.caseForDocuments(w, r)
+	if user == nil {
+		return
+	}
+	doc, err := h.repo.GetCaseDocument(c.ID, mux.Vars(r)["docId"])
+	if err != nil || !canSeeDocument(user, c, doc) {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	h.serveCaseDocument(w, r, user, doc)
+}
+
+// documentTarget names a document version in the audit log.
+func documentTarget(d *Models.CaseDocument) string {
+	return "case/" + d.CaseID + "/document/" + d.ID + "/" + strconv.Itoa(d.Version)
+}
+
+// serveCaseDocument streams a document version, honouring a single byte
+// Range. Reads of anything but public documents are audited.
+func (h *Courthandler) serveCaseDocument(w http.ResponseWriter, r *http.Request, user *Models.User, doc *Models.CaseDocument) {
+	stream, err := h.repo.OpenCaseFile(doc.FileID)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Document content missing", http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	size := stream.GetFile().Length
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Type", doc.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": doc.Filename}))
+	w.Header().Set("ETag", `"`+doc.SHA256+`"`)
+
+	start, end, ok := parseRange(r.Header.Get("Range"), size)
+	if !ok {
+		w.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		http.Error(w, "invalid range", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if doc.Confidentiality != ConfidentialityPublic {
+		h.record(r, user.Email, "document.read", documentTarget(doc), nil, nil)
+	}
+	length := end - start + 1
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if length != size {
+		if _, err := stream.Skip(start); err != nil {
+			http.Error(w, "Failed to read document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10)+"/"+strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	if _, err := io.CopyN(w, stream, length); err != nil {
+		log.Printf("Download of %v interrupted: %v\n", doc.ID, err)
+	}
+}
+
+// parseRange resolves a "bytes=" Range header to inclusive offsets. An
+// empty or multi-range header selects the whole content.
+func parseRange(header string, size int64) (int64, int64, bool) {
+	if header == "" || strings.Contains(header, ",") || size == 0 {
+		return 0, size - 1, true
+	}
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		size       int64
+		start, end int64
+		ok         bool
+	}{
+		{"", 100, 0, 99, true},
+		{"bytes=0-9", 100, 0, 9, true},
+		{"bytes=90-", 100, 90, 99, true},
+		{"bytes=90-500", 100, 90, 99, true},
+		{"bytes=-10", 100, 90, 99, true},
+		{"bytes=-500", 100, 0, 99, true},
+		{"bytes=0-0", 100, 0, 0, true},
+		// Multiple ranges fall back to the whole content
+		{"bytes=0-1,5-6", 100, 0, 99, true},
+		{"bytes=100-", 100, 0, 0, false},
+		{"bytes=10-5", 100, 0, 0, false},
+		{"bytes=-0", 100, 0, 0, false},
+		{"bytes=a-b", 100, 0, 0, false},
+		{"bytes=5", 100, 0, 0, false},
+		{"items=0-9", 100, 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := parseRange(tt.header, tt.size)
+		if ok != tt.ok || (ok && (start != tt.start || end != tt.end)) {
+			t.Errorf("parseRange(%q, %d) = %d, %d, %v, want %d, %d, %v", tt.header, tt.size, start, end, ok, tt.start, tt.end, tt.ok)
+		}
+	}
+}
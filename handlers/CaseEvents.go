@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/outbox"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	HearingScheduled = "scheduled"
+	HearingStarted   = "started"
+	HearingDelayed   = "delayed"
+	HearingAdjourned = "adjourned"
+	HearingFinished  = "finished"
+	HearingCancelled = "cancelled"
+	// Recorded before hearings had live statuses; means finished
+	HearingHeld = "held"
+)
+
+// hearingOver tells whether a hearing can no longer change status.
+func hearingOver(status string) bool {
+	switch status {
+	case HearingAdjourned, HearingFinished, HearingCancelled, HearingHeld:
+		return true
+	}
+	return false
+}
+
+// commitCaseEvents appends events to the case's history and, in the same
+// transaction, stores the resulting projection and queues the events for
+// other services. c is nil for a new case, whose first event must be
+// CaseFiled. Cases stored before events existed get a CaseMigrated
+// snapshot of their current state first, dated now since that is only
+// known to be their state from now on. The snapshot isn't published, as
+// nothing about the case changed.
+func (h *Courthandler) commitCaseEvents(actor string, c *Models.Case, events ...*caseevents.Event) (*Models.Case, *httpError) {
+	stored := c != nil
+	if c != nil && c.Unverified && (len(events) == 0 || events[0].Type != caseevents.CaseVerified) {
+		return nil, &httpError{http.StatusConflict, "Case must be verified by the court first"}
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if c != nil && c.Version == 0 {
+		snapshot := *c
+		migrated := caseevents.Event{Type: caseevents.CaseMigrated, Case: &snapshot, Actor: "system"}
+		events = append([]*caseevents.Event{&migrated}, events...)
+		c = nil
+	}
+	version := 0
+	if c != nil {
+		version = c.Version
+	}
+	next := c
+	for _, e := range events {
+		version++
+		e.Seq = version
+		if e.Time == "" {
+			e.Time = now
+		}
+		if e.Actor == "" {
+			e.Actor = actor
+		}
+		if e.Type == caseevents.CaseFiled || e.Type == caseevents.CaseMigrated {
+			e.CaseID = e.Case.ID
+		} else {
+			e.CaseID = next.ID
+		}
+		var err error
+		if next, err = caseevents.Apply(next, e); err != nil {
+			return nil, &httpError{http.StatusInternalServerError, err.Error()}
+		}
+	}
+
+	var messages []*outbox.Message
+	for _, e := range events {
+		if e.Type == caseevents.CaseMigrated {
+			continue
+		}
+		m, err := h.outbox.NewMessage(e.Type, "case", e.CaseID, e)
+		if err != nil {
+			return nil, &httpError{http.StatusInternalServerError, err.Error()}
+		}
+		messages = append(messages, m)
+	}
+	err := h.repo.CommitCaseEvents(events, next, !stored, messages)
+	if err != nil {
+		if Repo.IsDuplicate(err) {
+			return nil, &httpError{http.StatusConflict, "Case was changed meanwhile, try again"}
+		}
+		return nil, &httpError{http.StatusInternalServerError, "Failed to save the case"}
+	}
+	h.committed()
+	return next, nil
+}
+
+// changeCase loads the route's case for a staff member and commits the
+// events built from it.
+func (h *Courthandler) changeCase(w http.ResponseWriter, r *http.Request, build func(c *Models.Case) ([]*caseevents.Event, *httpError)) {
+	user := RequireRole(w, r, h.repo, RoleJudge, RoleOperator, RoleAdmin)
+	if user == nil {
+		return
+	}
+	c, err := h.repo.GetCase(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Case not found", http.StatusNotFound)
+		return
+	}
+	events, herr := build(c)
+	if herr != nil {
+		http.Error(w, herr.message, herr.status)
+		return
+	}
+	updated, herr := h.commitCaseEvents(user.Email, c, events...)
+	if herr != nil {
+		http.Error(w, herr.message, herr.status)
+		return
+	}
+	// Any change may touch what the registers say about the defendant
+	h.invalidatePerson(r.Context(), c.DefendantEmail, c.DefendantNationalID)
+	h.invalidatePerson(r.Context(), updated.DefendantEmail, updated.DefendantNationalID)
+	for _, e := range events {
+		h.record(r, user.Email, "case."+e.Type, "case/"+c.ID, c, updated)
+	}
+	RenderJSON(w, updated)
+}
+func (h *Courthandler) AssignJudge(w http.ResponseWriter, r *http.Request) {
+	h.changeCase(w, r, func(c *Models.Case) ([]*caseevents.Event, *httpError) {
+		var req struct {
+			Judge string `json:"judge"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Judge == "" {
+			return nil, &httpError{http.StatusBadRequest, "Invalid request payload"}
+		}
+		return []*caseevents.Event{{Type: caseevents.JudgeAssigned, Judge: req.Judge}}, nil
+	})
+}
+
+// VerifyCase confirms a case a citizen filed, after which it is handled
+// like any other. The optional confirmed_emails lists the case's addresses
+// staff have checked; until then people without a court profile aren't
+// emailed at them.
+func (h *Courthandler) VerifyCase(w http.ResponseWriter, r *http.Request) {
+	h.changeCase(w, r, func(c *Models.Case) ([]*caseevents.Event, *httpError) {
+		if !c.Unverified {
+			return nil, &httpError{http.StatusConflict, "Case is already verified"}
+		}
+		var req struct {
+			ConfirmedEmails []string `json:"confirmed_emails"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			return nil, &httpError{http.StatusBadRequest, "Invalid request payload"}
+		}
+		for _, email := range req.ConfirmedEmails {
+			if !caseAddress(c, email) {
+				return nil, &httpError{http.StatusBadRequest, "confirmed_emails must be addresses on the case"}
+			}
+		}
+		return []*caseevents.Event{{Type: caseevents.CaseVerified, Emails: req.ConfirmedEmails}}, nil
+	})
+}
+
+// caseAddress tells whether email is one of the case's parties' addresses.
+func caseAddress(c *Models.Case, email string) bool {
+	if email == "" {
+		return false
+	}
+	for _, a := range append([]string{c.PlaintiffEmail, c.DefendantEmail}, c.LawyerEmails...) {
+		if a == email {
+			return true
+		}
+	}
+	return false
+}
+func (h *Courthandler) ScheduleHearing(w http.ResponseWriter, r *http.Request) {
+	h.changeCase(w, r, func(c *Models.Case) ([]*caseevents.Event, *httpError) {
+		var hearing Models.Hearing
+		if err := json.NewDecoder(r.Body).Decode(&hearing); err != nil {
+			return nil, &httpError{http.StatusBadRequest, "Invalid request payload"}
+		}
+		if _, err := time.Parse(time.RFC3339, hearing.Date); err != nil {
+			return nil, &httpError{http.StatusBadRequest, "date must be an RFC 3339 time"}
+		}
+		hearing.ID = uuid.New().String()
+		hearing.Status = HearingScheduled
+		return []*caseevents.Event{{Type: caseevents.HearingScheduled, Hearing: &hearing}}, nil
+	})
+}
+
+// ChangeHearingStatus records how a hearing is going: started, delayed,
+// adjourned, finished or cancelled, with an optional note for the board.
+func (h *Courthandler) ChangeHearingStatus(w http.ResponseWriter, r *http.Request) {
+	h.changeCase(w, r, func(c *Models.Case) ([]*caseevents.Event, *httpError) {
+		var req struct {
+			Status string `json:"status"`
+			Note   string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, &httpError{http.StatusBadRequest, "Invalid request payload"}
+		}
+		switch req.Status {
+		case HearingStarted, HearingDelayed, HearingAdjourned, HearingFinished, HearingCancelled:
+		default:
+			return nil, &httpError{http.StatusBadRequest, "status must be started, delayed, adjourned, finished or cancelled"}
+		}
+		id := mux.Vars(r)["hearingId"]
+		for _, hearing := range c.Hearings {
+			if hearing.ID != id {
+				continue
+			}
+			if hearingOver(hearing.Status) {
+				return nil, &httpError{http.StatusConflict, "Hearing is already over"}
+			}
+			changed := Models.Hearing{ID: id, Status: req.Status, Note: req.Note}
+			return []*caseevents.Event{{Type: caseevents.HearingStatusChanged, Hearing: &changed}}, nil
+		}
+		return nil, &httpError{http.StatusNotFound, "Hearing not found"}
+	})
+}
+
+// RescheduleHearing moves a hearing to a new date and, optionally, another
+// courtroom. Reminders for the old date are cancelled.
+func (h *Courthandler) RescheduleHearing(w http.ResponseWriter, r *http.Request) {
+	h.changeCase(w, r, func(c *Models.Case) ([]*caseevents.Event, *httpError) {
+		var req struct {
+			Date      string `json:"date"`
+			Courtroom string `json:"courtroom"`
+			Note      string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, &httpError{http.StatusBadRequest, "Invalid request payload"}
+		}
+		if _, err := time.Parse(time.RFC3339, req.Date); err != nil {
+			return nil, &httpError{http.StatusBadRequest, "date must be an RFC 3339 time"}
+		}
+		id := mux.Vars(r)["hearingId"]
+		for _, hearing := range c.Hearings {
+			if hearing.ID != id {
+				continue
+			}
+			if hearingOver(hearing.Status) {
+				return nil, &httpError{http.StatusConflict, "Hearing is already over"}
+			}
+			moved := Models.Hearing{ID: id, Date: req.Date, Courtroom: hearing.Courtroom, Status: HearingScheduled, Note: req.Note}
+			if req.Courtroom != "" {
+				moved.Courtroom = req.Courtroom
+			}
+			return []*caseevents.Event{{Type: caseevents.HearingRescheduled, Hearing: &moved}}, nil
+		}
+		return nil, &httpError{http.StatusNotFound, "Hearing not found"}
+	})
+}
+func (h *Courthandler) ChangeCaseStatus(w http.ResponseWriter, r *http.Request) {
+	h.changeCase(w, r, func(c *Models.Case) ([]*caseevents.Event, *httpError) {
+		var req struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, &httpError{http.StatusBadRequest, "Invalid request payload"}
+		}
+		switch req.Status {
+		case CaseStatusOpen, CaseStatusDecided, CaseStatusClosed:
+		default:
+			return nil, &httpError{http.StatusBadRequest, "status must be Open, Decided or Closed"}
+		}
+		if req.Status == c.Status {
+			return nil, &httpError{http.StatusConflict, "Case already has that status"}
+		}
+		return []*caseevents.Event{{Type: caseevents.StatusChanged, Status: req.Status}}, nil
+	})
+}
+func (h *Courthandler) AddParty(w http.ResponseWriter, r *http.Request) {
+	h.changeCase(w, r, func(c *Models.Case) ([]*caseevents.Event, *httpError) {
+		var party caseevents.Party
+		if err := json.NewDecoder(r.Body).Decode(&party); err != nil || party.Name == "" {
+			return nil, &httpError{http.StatusBadRequest, "Invalid request payload"}
+		}
+		switch party.Role {
+		case caseevents.RolePlaintiff, caseevents.RoleDefendant, caseevents.RoleLawyer:
+		default:
+			return nil, &httpError{http.StatusBadRequest, "role must be plaintiff, defendant or lawyer"}
+		}
+		return []*caseevents.Event{{Type: caseevents.PartyAdded, Party: &party}}, nil
+	})
+}
+
+// GetCaseHistory returns the case's timeline of events.
+func (h *Courthandler) GetCaseHistory(w http.ResponseWriter, r *http.Request) {
+	user, c := h.caseForUser(w, r)
+	if c == nil {
+		return
+	}
+	events, err := h.repo.GetCaseEvents(c.ID)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "History not found", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, user.Email, "case.history", "case/"+c.ID, nil, nil)
+	RenderJSON(w, events)
+}
+
+// GetCaseAsOf rebuilds the case as it stood at the "at" query parameter,
+// an RFC 3339 time or a date meaning the end of that day.
+func (h *Courthandler) GetCaseAsOf(w http.ResponseWriter, r *http.Request) {
+	user, c := h.caseForUser(w, r)
+	if c == nil {
+		return
+	}
+	at, err := parseAsOf(r.URL.Query().Get("at"), h.cfg.TimeZone)
+	if err != nil {
+		http.Error(w, "at must be an RFC 3339 time or a YYYY-MM-DD date", http.StatusBadRequest)
+		return
+	}
+	events, err := h.repo.GetCaseEvents(c.ID)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "History not found", http.StatusInternalServerError)
+		return
+	}
+	past, err := caseevents.AsOf(events, at)
+	if errors.Is(err, caseevents.ErrBeforeHistory) {
+		http.Error(w, "Case history starts at "+events[0].Time, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Case did not exist yet", http.StatusNotFound)
+		return
+	}
+	h.record(r, user.Email, "case.asof", "case/"+c.ID, nil, nil)
+	RenderJSON(w, past)
+}
+
+// parseAsOf reads an RFC 3339 time, or a date meaning the end of that day
+// in the court's time zone.
+func parseAsOf(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", s, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
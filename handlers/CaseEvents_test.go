@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAsOf(t *testing.T) {
+	belgrade, err := time.LoadLocation("Europe/Belgrade")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{"2024-03-01T10:00:00Z", "2024-03-01T10:00:00Z"},
+		// The end of the court's day, not the server's
+		{"2024-03-01", "2024-03-01T22:59:59.999999999Z"},
+		{"2024-07-01", "2024-07-01T21:59:59.999999999Z"},
+	}
+	for _, tt := range tests {
+		got, err := parseAsOf(tt.in, belgrade)
+		if err != nil || got.UTC().Format(time.RFC3339Nano) != tt.want {
+			t.Errorf("parseAsOf(%q) = %v, %v, want %s", tt.in, got.UTC(), err, tt.want)
+		}
+	}
+	if _, err := parseAsOf("March 1st", belgrade); err == nil {
+		t.Error("parseAsOf() accepted a malformed time")
+	}
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	CertificateNoCriminalProceedings = "NoCriminalProceedings"
+	RequestTypeCertificate           = "CertificateNoCriminalProceedings"
+	RequestTypeCertificateRevoked    = "CertificateRevoked"
+
+	resultNoProceedings = "Protiv lica se ne vodi krivični postupak"
+	resultProceedings   = "Protiv lica se vodi krivični postupak"
+)
+
+// httpError is a failure that already knows how it should be answered.
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+// issueCertificate checks the holder against the court and prosecution
+// registers, then numbers, signs and stores the certificate. holder carries
+// the holder fields, the request ID and, for a re-issue, Replaces.
+func (h *Courthandler) issueCertificate(ctx context.Context, holder Models.Certificate) (*Models.Certificate, *httpError) {
+	// A certificate must reflect the registers as they are now, so the
+	// lookup bypasses the cache and a missing external answer is fatal.
+	status, err := h.prosecutionStatus(ctx, personQuery{Email: holder.HolderEmail, NationalID: holder.HolderNationalID})
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		return nil, &httpError{http.StatusInternalServerError, "Failed to check prosecution status"}
+	}
+	if status.ExternalError != "" {
+		return nil, &httpError{http.StatusServiceUnavailable, "Prosecution service unavailable, try again later"}
+	}
+
+	now := time.Now()
+	certificate := Models.Certificate{
+		ID:                   uuid.New().String(),
+		Type:                 CertificateNoCriminalProceedings,
+		RequestID:            holder.RequestID,
+		HolderEmail:          holder.HolderEmail,
+		HolderName:           holder.HolderName,
+		HolderNationalID:     holder.HolderNationalID,
+		ProceedingsConducted: status.Prosecuted,
+		Result:               resultNoProceedings,
+		Sources:              status.Sources,
+		IssueDate:            now.Format(time.RFC3339),
+		ValidUntil:           now.Add(h.cfg.CertificateValidity).Format(time.RFC3339),
+		IssuingCourt:         h.cfg.CourtName,
+		Replaces:             holder.Replaces,
+	}
+	if status.Prosecuted {
+		certificate.Result = resultProceedings
+	}
+	// Numbers are random, so in the rare case one is taken draw again
+	for attempt := 0; ; attempt++ {
+		certificate.Number, err = newCertificateNumber(now)
+		if err == nil {
+			certificate.ShortCode, err = newShortCode()
+		}
+		if err != nil {
+			return nil, &httpError{http.StatusInternalServerError, "Failed to number the certificate"}
+		}
+		certificate.Signature = nil
+		certificate.Signature, err = h.sign(certificate)
+		if err != nil {
+			log.Printf("Operation Failed: %v\n", err)
+			return nil, &httpError{http.StatusInternalServerError, "Failed to sign the certificate"}
+		}
+		err = h.repo.NewCertificate(&certificate)
+		if err == nil {
+			return &certificate, nil
+		}
+		if !Repo.IsDuplicate(err) || attempt == 2 {
+			return nil, &httpError{http.StatusInternalServerError, "Failed to save the certificate"}
+		}
+	}
+}
+
+// NewCertificate issues the caller a certificate of (no) criminal
+// proceedings, in the name the identity provider vouches for. Details in
+// the body are only checked against it.
+func (h *Courthandler) NewCertificate(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		http.Error(w, "User doesn't exist", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		FullName   string `json:"full_name"`
+		NationalID string `json:"national_id"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	name, nationalID := verifiedIdentity(r, h.repo, user)
+	if name == "" || nationalID == "" {
+		http.Error(w, "Your identity isn't verified, log in through the identity provider", http.StatusForbidden)
+		return
+	}
+	if !sameIdentity(req.FullName, req.NationalID, name, nationalID) {
+		http.Error(w, "Details don't match your verified identity", http.StatusForbidden)
+		return
+	}
+
+	certificate, herr := h.issueCertificate(r.Context(), Models.Certificate{
+		RequestID:        uuid.New().String(),
+		HolderEmail:      user.Email,
+		HolderName:       name,
+		HolderNationalID: nationalID,
+	})
+	if herr != nil {
+		http.Error(w, herr.message, herr.status)
+		return
+	}
+
+	// Record the request on the citizen's profile
+	request := Models.Request{
+		ID:          certificate.RequestID,
+		Type:        RequestTypeCertificate,
+		Status:      "resolved",
+		Certificate: certificate.Number,
+		Description: "Certificate " + certificate.Number + " issued",
+		CreatedAt:   certificate.IssueDate,
+	}
+	user.Requests = append(user.Requests, request)
+	err = h.commitRequest(user, RequestCreated, request)
+	if err != nil {
+		log.Printf("Failed to update user data: %v\n", err)
+	}
+	h.record(r, user.Email, "certificate.issue", "certificate/"+certificate.Number, nil, certificate)
+
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, certificate)
+}
+
+// RevokeCertificate withdraws a certificate issued on wrong data and, if
+// asked, issues a corrected replacement linked to it. The holder is told
+// through a request on their profile. If the replacement fails the
+// revocation stands and ReissueCertificate can issue it later.
+func (h *Courthandler) RevokeCertificate(w http.ResponseWriter, r *http.Request) {
+	operator := RequireRole(w, r, h.repo, RoleOperator, RoleAdmin)
+	if operator == nil {
+		return
+	}
+	var req struct {
+		Reason  string `json:"reason"`
+		Reissue bool   `json:"reissue"`
+		reissueRequest
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Reason == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	original, err := h.repo.GetCertificate(mux.Vars(r)["number"])
+	if err != nil {
+		http.Error(w, "Certificate not found", http.StatusNotFound)
+		return
+	}
+	var corrected Models.Certificate
+	if req.Reissue {
+		var herr *httpError
+		if corrected, herr = h.correctedCertificate(original, req.reissueRequest); herr != nil {
+			http.Error(w, herr.message, herr.status)
+			return
+		}
+	}
+
+	revocation := Models.Revocation{
+		DocumentNumber: original.Number,
+		Reason:         req.Reason,
+		RevokedBy:      operator.Email,
+		RevokedAt:      time.Now().Format(time.RFC3339),
+	}
+	err = h.repo.NewRevocation(&revocation)
+	if err != nil {
+		if Repo.IsDuplicate(err) {
+			http.Error(w, "Certificate already revoked", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to revoke the certificate", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, operator.Email, "certificate.revoke", "certificate/"+original.Number, original, revocation)
+
+	var replacement *Models.Certificate
+	if req.Reissue {
+		var herr *httpError
+		replacement, herr = h.reissueCertificate(r, operator, original, corrected)
+		if herr != nil {
+			h.notifyCertificateRevoked(original, &revocation)
+			http.Error(w, "Certificate revoked, but re-issuing failed: "+herr.message+"; retry with POST /admin/certificates/"+original.Number+"/reissue", herr.status)
+			return
+		}
+		revocation.ReplacedBy = replacement.Number
+	}
+	h.notifyCertificateRevoked(original, &revocation)
+
+	response := struct {
+		Revocation  Models.Revocation   `json:"revocation"`
+		Replacement *Models.Certificate `json:"replacement,omitempty"`
+	}{revocation, replacement}
+	RenderJSON(w, response)
+}
+
+// ReissueCertificate issues the replacement of a revoked certificate that
+// has none yet, e.g. because issuing it failed at revocation.
+func (h *Courthandler) ReissueCertificate(w http.ResponseWriter, r *http.Request) {
+	operator := RequireRole(w, r, h.repo, RoleOperator, RoleAdmin)
+	if operator == nil {
+		return
+	}
+	var req reissueRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	original, err := h.repo.GetCertificate(mux.Vars(r)["number"])
+	if err != nil {
+		http.Error(w, "Certificate not found", http.StatusNotFound)
+		return
+	}
+	revocation, err := h.repo.GetRevocation(original.Number)
+	if err != nil {
+		http.Error(w, "Failed to read the revocation", http.StatusInternalServerError)
+		return
+	}
+	if revocation == nil {
+		http.Error(w, "Certificate isn't revoked", http.StatusConflict)
+		return
+	}
+	if revocation.ReplacedBy != "" {
+		http.Error(w, "Certificate was already re-issued as "+revocation.ReplacedBy, http.StatusConflict)
+		return
+	}
+	corrected, herr := h.correctedCertificate(original, req)
+	if herr != nil {
+		http.Error(w, herr.message, herr.status)
+		return
+	}
+	replacement, herr := h.reissueCertificate(r, operator, original, corrected)
+	if herr != nil {
+		http.Error(w, herr.message, herr.status)
+		return
+	}
+	revocation.ReplacedBy = replacement.Number
+	h.notifyCertificateRevoked(original, revocation)
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, replacement)
+}
+
+// reissueRequest carries the corrected details an operator expects a
+// replacement to show.
+type reissueRequest struct {
+	FullName   string `json:"full_name"`
+	NationalID string `json:"national_id"`
+}
+
+// correctedCertificate prepares the replacement of original. It is issued
+// to the identity the holder last logged in with; an operator can't type
+// in a different one.
+func (h *Courthandler) correctedCertificate(original *Models.Certificate, req reissueRequest) (Models.Certificate, *httpError) {
+	holder, err := h.repo.GetByEmail(original.HolderEmail)
+	if err != nil {
+		return Models.Certificate{}, &httpError{http.StatusNotFound, "Holder not found"}
+	}
+	corrected := Models.Certificate{
+		RequestID:        original.RequestID,
+		HolderEmail:      original.HolderEmail,
+		HolderName:       holder.FullName,
+		HolderNationalID: holder.NationalID,
+		Replaces:         original.Number,
+	}
+	if corrected.HolderName == "" || corrected.HolderNationalID == "" {
+		return Models.Certificate{}, &httpError{http.StatusConflict, "Holder's identity isn't verified, they need to log in through the identity provider"}
+	}
+	if !sameIdentity(req.FullName, req.NationalID, corrected.HolderName, corrected.HolderNationalID) {
+		return Models.Certificate{}, &httpError{http.StatusConflict, "Corrections don't match the holder's verified identity"}
+	}
+	return corrected, nil
+}
+
+// reissueCertificate issues the replacement and links it to the revocation
+// of original. Of two concurrent re-issues only one is kept.
+func (h *Courthandler) reissueCertificate(r *http.Request, operator *Models.User, original *Models.Certificate, corrected Models.Certificate) (*Models.Certificate, *httpError) {
+	replacement, herr := h.issueCertificate(r.Context(), corrected)
+	if herr != nil {
+		return nil, herr
+	}
+	err := h.repo.SetRevocationReplacement(original.Number, replacement.Number)
+	if err != nil {
+		// Nobody has seen the replacement yet, so it can simply go
+		if err := h.repo.DeleteCertificate(replacement.Number); err != nil {
+			log.Printf("Operation Failed: %v\n", err)
+		}
+		if Repo.IsNotFound(err) {
+			return nil, &httpError{http.StatusConflict, "Certificate was re-issued meanwhile"}
+		}
+		return nil, &httpError{http.StatusInternalServerError, "Failed to link the replacement"}
+	}
+	h.record(r, operator.Email, "certificate.issue", "certificate/"+replacement.Number, nil, replacement)
+	return replacement, nil
+}
+
+// notifyCertificateRevoked records the revocation on the holder's profile.
+func (h *Courthandler) notifyCertificateRevoked(c *Models.Certificate, revocation *Models.Revocation) {
+	holder, err := h.repo.GetByEmail(c.HolderEmail)
+	if err != nil {
+		log.Printf("Couldn't notify holder of %v: %v\n", c.Number, err)
+		return
+	}
+	description := "Certificate " + c.Number + " was revoked: " + revocation.Reason
+	if revocation.ReplacedBy != "" {
+		description += ". Replaced by " + revocation.ReplacedBy
+	}
+	request := Models.Request{
+		ID:          uuid.New().String(),
+		Type:        RequestTypeCertificateRevoked,
+		Status:      "resolved",
+		Certificate: c.Number,
+		Description: description,
+		CreatedAt:   revocation.RevokedAt,
+	}
+	holder.Requests = append(holder.Requests, request)
+	err = h.commitRequest(holder, RequestCreated, request)
+	if err != nil {
+		log.Printf("Couldn't notify holder of %v: %v\n", c.Number, err)
+	}
+}
+func (h *Courthandler) GetMyCertificates(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	response, err := h.repo.GetCertificatesByHolder(user.Email)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Certificates not found", http.StatusNotFound)
+		return
+	}
+	RenderJSON(w, response)
+}
+func (h *Courthandler) GetCertificate(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	certificate, err := h.repo.GetCertificate(mux.Vars(r)["number"])
+	if err != nil || (certificate.HolderEmail != user.Email && !isStaff(user)) {
+		http.Error(w, "Certificate not found", http.StatusNotFound)
+		return
+	}
+	h.record(r, user.Email, "certificate.read", "certificate/"+certificate.Number, nil, nil)
+	RenderJSON(w, certificate)
+}
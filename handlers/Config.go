@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/EupravaProjekat/court/lookupcache"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the handlers' settings, read once at startup.
+type Config struct {
+	CourtName           string        // Printed on every document the service issues
+	PublicBaseURL       string        // Where citizens reach the court API, for links printed on documents
+	TrustedProxyHops    int           // Proxies in front of the service that append to X-Forwarded-For
+	MaxBatchSize        int           // Identifiers per prosecution batch call
+	CertificateValidity time.Duration // How long an issued certificate is valid
+	MaxCaseDocumentSize int64         // Bytes per uploaded case document
+	AnswerTimeout       time.Duration // How long a request waits for the prosecution service's answer
+	SigningKeyDir       string        // Holds the court's private signing keys, one PEM file each
+	Cache               lookupcache.Config
+	SharedCache         bool           // Share prosecution lookups between replicas through Mongo
+	TimeZone            *time.Location // The court's local time, for hearing times and the board's day
+	MaxPublicBoards     int            // Public board connections open at once
+}
+
+// ConfigFromEnv reads COURT_NAME, PUBLIC_BASE_URL, TRUSTED_PROXY_HOPS,
+// PROSECUTION_BATCH_MAX, CERTIFICATE_VALIDITY, CASE_DOCUMENT_MAX_SIZE,
+// PROSECUTION_ANSWER_TIMEOUT, SIGNING_KEY_DIR, PROSECUTION_CACHE_TTL,
+// PROSECUTION_CACHE_STALE_TTL, PROSECUTION_CACHE_SIZE,
+// PROSECUTION_CACHE_SHARED, PUBLIC_BOARD_MAX_CONNECTIONS and
+// COURT_TIMEZONE, an IANA name such as "Europe/Belgrade", defaulting the
+// rest.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		CourtName:           "Osnovni sud",
+		PublicBaseURL:       "http://localhost:9198",
+		MaxBatchSize:        500,
+		CertificateValidity: 180 * 24 * time.Hour,
+		MaxCaseDocumentSize: 25 << 20,
+		AnswerTimeout:       15 * time.Minute,
+		SigningKeyDir:       "signing-keys",
+		Cache: lookupcache.Config{
+			Size:     10000,
+			TTL:      5 * time.Minute,
+			StaleTTL: time.Hour,
+			LocalTTL: 30 * time.Second,
+		},
+		SharedCache:     os.Getenv("PROSECUTION_CACHE_SHARED") == "mongo",
+		TimeZone:        time.Local,
+		MaxPublicBoards: 200,
+	}
+	if n, err := strconv.Atoi(os.Getenv("TRUSTED_PROXY_HOPS")); err == nil && n > 0 {
+		cfg.TrustedProxyHops = n
+	} else if os.Getenv("TRUST_PROXY") == "true" {
+		// The older switch meant a single proxy
+		cfg.TrustedProxyHops = 1
+	}
+	if v := os.Getenv("COURT_NAME"); v != "" {
+		cfg.CourtName = v
+	}
+	if v := os.Getenv("PUBLIC_BASE_URL"); v != "" {
+		cfg.PublicBaseURL = strings.TrimRight(v, "/")
+	}
+	if n, err := strconv.Atoi(os.Getenv("PROSECUTION_BATCH_MAX")); err == nil && n > 0 {
+		cfg.MaxBatchSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("CERTIFICATE_VALIDITY")); err == nil && d > 0 {
+		cfg.CertificateValidity = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("CASE_DOCUMENT_MAX_SIZE"), 10, 64); err == nil && n > 0 {
+		cfg.MaxCaseDocumentSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("PROSECUTION_ANSWER_TIMEOUT")); err == nil && d > 0 {
+		cfg.AnswerTimeout = d
+	}
+	if v := os.Getenv("SIGNING_KEY_DIR"); v != "" {
+		cfg.SigningKeyDir = v
+	}
+	if d, err := time.ParseDuration(os.Getenv("PROSECUTION_CACHE_TTL")); err == nil {
+		cfg.Cache.TTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("PROSECUTION_CACHE_STALE_TTL")); err == nil {
+		cfg.Cache.StaleTTL = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("PROSECUTION_CACHE_SIZE")); err == nil {
+		cfg.Cache.Size = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PUBLIC_BOARD_MAX_CONNECTIONS")); err == nil && n > 0 {
+		cfg.MaxPublicBoards = n
+	}
+	if v := os.Getenv("COURT_TIMEZONE"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return cfg, fmt.Errorf("COURT_TIMEZONE: %w", err)
+		}
+		cfg.TimeZone = loc
+	}
+	return cfg, nil
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DeadlineOpen      = "open"
+	DeadlineMet       = "met"
+	DeadlineCancelled = "cancelled"
+)
+
+// SetDeadline adds a procedural deadline to a case. Party, when set, is
+// the one side that must act; only they and the lawyers are reminded.
+func (h *Courthandler) SetDeadline(w http.ResponseWriter, r *http.Request) {
+	h.changeCase(w, r, func(c *Models.Case) ([]*caseevents.Event, *httpError) {
+		var deadline Models.Deadline
+		if err := json.NewDecoder(r.Body).Decode(&deadline); err != nil || deadline.Title == "" {
+			return nil, &httpError{http.StatusBadRequest, "Invalid request payload"}
+		}
+		if _, err := time.Parse(time.RFC3339, deadline.Due); err != nil {
+			return nil, &httpError{http.StatusBadRequest, "due must be an RFC 3339 time"}
+		}
+		switch deadline.Party {
+		case "", caseevents.RolePlaintiff, caseevents.RoleDefendant:
+		default:
+			return nil, &httpError{http.StatusBadRequest, "party must be plaintiff or defendant"}
+		}
+		deadline.ID = uuid.New().String()
+		deadline.Status = DeadlineOpen
+		return []*caseevents.Event{{Type: caseevents.DeadlineSet, Deadline: &deadline}}, nil
+	})
+}
+
+// ChangeDeadlineStatus closes an open deadline as met or cancelled, which
+// stops its reminders.
+func (h *Courthandler) ChangeDeadlineStatus(w http.ResponseWriter, r *http.Request) {
+	h.changeCase(w, r, func(c *Models.Case) ([]*caseevents.Event, *httpError) {
+		var req struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, &httpError{http.StatusBadRequest, "Invalid request payload"}
+		}
+		if req.Status != DeadlineMet && req.Status != DeadlineCancelled {
+			return nil, &httpError{http.StatusBadRequest, "status must be met or cancelled"}
+		}
+		id := mux.Vars(r)["deadlineId"]
+		for _, deadline := range c.Deadlines {
+			if deadline.ID != id {
+				continue
+			}
+			if deadline.Status != DeadlineOpen {
+				return nil, &httpError{http.StatusConflict, "Deadline is already closed"}
+			}
+			closed := Models.Deadline{ID: deadline.ID, Status: req.Status}
+			return []*caseevents.Event{{Type: caseevents.DeadlineStatusChanged, Deadline: &closed}}, nil
+		}
+		return nil, &httpError{http.StatusNotFound, "Deadline not found"}
+	})
+}
+
+// GetReminders lists scheduled reminders, soonest first, optionally only
+// those of ?case_id= or with ?status=.
+func (h *Courthandler) GetReminders(w http.ResponseWriter, r *http.Request) {
+	if RequireRole(w, r, h.repo, RoleAdmin) == nil {
+		return
+	}
+	query := r.URL.Query()
+	limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	jobs, err := h.repo.GetReminders(query.Get("case_id"), query.Get("status"), limit)
+	if err != nil {
+		http.Error(w, "Reminders not found", http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, jobs)
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// documentFields lists the metadata a version's chain hash commits to, in
+// a fixed order. The GridFS file ID is a storage detail and left out; the
+// content is covered by its SHA-256.
+func documentFields(d *Models.CaseDocument) [][2]string {
+	return [][2]string{
+		{"id", d.ID},
+		{"version", strconv.Itoa(d.Version)},
+		{"case_id", d.CaseID},
+		{"filename", d.Filename},
+		{"doc_type", d.DocType},
+		{"uploader", d.Uploader},
+		{"party", d.Party},
+		{"confidentiality", d.Confidentiality},
+		{"content_type", d.ContentType},
+		{"size", strconv.FormatInt(d.Size, 10)},
+		{"sha256", d.SHA256},
+		{"uploaded_at", d.UploadedAt},
+	}
+}
+
+// documentChainHash links a version to its predecessor, so rewriting or
+// dropping any earlier version breaks every later hash.
+func documentChainHash(d *Models.CaseDocument) string {
+	var b strings.Builder
+	for _, f := range documentFields(d) {
+		b.WriteString(f[0] + "=" + f[1] + "\n")
+	}
+	b.WriteString("prev_hash=" + d.PrevHash + "\n")
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// documentForVersions loads the route's document with every version of it
+// and marks which versions the caller may see, each judged on its own
+// confidentiality. A document none of whose versions are visible is not
+// found.
+func (h *Courthandler) documentForVersions(w http.ResponseWriter, r *http.Request) (*Models.User, *Models.Case, []*Models.CaseDocument, []bool) {
+	user, c := h.caseForDocuments(w, r)
+	if user == nil {
+		return nil, nil, nil, nil
+	}
+	versions, err := h.repo.GetCaseDocumentVersions(c.ID, mux.Vars(r)["docId"])
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Versions not found", http.StatusInternalServerError)
+		return nil, nil, nil, nil
+	}
+	visible := make([]bool, len(versions))
+	found := false
+	for i, v := range versions {
+		visible[i] = canSeeDocument(user, c, v)
+		found = found || visible[i]
+	}
+	if !found {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return nil, nil, nil, nil
+	}
+	return user, c, versions, visible
+}
+
+// UploadDocumentVersion files a new version of a document. Earlier versions
+// stay untouched; metadata not given in the form carries over.
+func (h *Courthandler) UploadDocumentVersion(w http.ResponseWriter, r *http.Request) {
+	user, c, versions, visible := h.documentForVersions(w, r)
+	if user == nil {
+		return
+	}
+	latest := versions[len(versions)-1]
+	if !visible[len(versions)-1] {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+	if !isStaff(user) && partyOf(user, c) != latest.Party {
+		http.Error(w, "only court staff and the filing party can replace a document", http.StatusForbidden)
+		return
+	}
+	doc := Models.CaseDocument{
+		ID:              latest.ID,
+		Version:         latest.Version + 1,
+		CaseID:          c.ID,
+		Uploader:        user.Email,
+		Party:           latest.Party,
+		DocType:         latest.DocType,
+		Confidentiality: latest.Confidentiality,
+		PrevHash:        latest.ChainHash,
+	}
+	h.receiveCaseDocument(w, r, user, &doc)
+}
+
+// GetDocumentVersions returns the versions the caller may see.
+func (h *Courthandler) GetDocumentVersions(w http.ResponseWriter, r *http.Request) {
+	user, _, versions, visible := h.documentForVersions(w, r)
+	if user == nil {
+		return
+	}
+	shown := []*Models.CaseDocument{}
+	for i, v := range versions {
+		if visible[i] {
+			shown = append(shown, v)
+		}
+	}
+	RenderJSON(w, shown)
+}
+
+// documentVersion picks the visible version named by the route or a query
+// parameter.
+func documentVersion(w http.ResponseWriter, versions []*Models.CaseDocument, visible []bool, version string) *Models.CaseDocument {
+	n, err := strconv.Atoi(version)
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return nil
+	}
+	for i, v := range versions {
+		if v.Version == n && visible[i] {
+			return v
+		}
+	}
+	http.Error(w, "Version not found", http.StatusNotFound)
+	return nil
+}
+func (h *Courthandler) DownloadDocumentVersion(w http.ResponseWriter, r *http.Request) {
+	user, _, versions, visible := h.documentForVersions(w, r)
+	if user == nil {
+		return
+	}
+	doc := documentVersion(w, versions, visible, mux.Vars(r)["version"])
+	if doc == nil {
+		return
+	}
+	h.serveCaseDocument(w, r, user, doc)
+}
+
+// DiffDocumentVersions lists the metadata that changed between the versions
+// given by the from and to query parameters.
+func (h *Courthandler) DiffDocumentVersions(w http.ResponseWriter, r *http.Request) {
+	user, _, versions, visible := h.documentForVersions(w, r)
+	if user == nil {
+		return
+	}
+	from := documentVersion(w, versions, visible, r.URL.Query().Get("from"))
+	if from == nil {
+		return
+	}
+	to := documentVersion(w, versions, visible, r.URL.Query().Get("to"))
+	if to == nil {
+		return
+	}
+	changes := []Models.MetadataChange{}
+	toFields := documentFields(to)
+	for i, f := range documentFields(from) {
+		if f[1] != toFields[i][1] {
+			changes = append(changes, Models.MetadataChange{Field: f[0], From: f[1], To: toFields[i][1]})
+		}
+	}
+	RenderJSON(w, changes)
+}
+
+// VerifyCaseDocument re-reads every version from GridFS and recomputes its
+// content hash and chain hash, proving storage was not altered. Versions
+// the caller can't see count towards Intact but aren't itemised.
+func (h *Courthandler) VerifyCaseDocument(w http.ResponseWriter, r *http.Request) {
+	user, _, versions, visible := h.documentForVersions(w, r)
+	if user == nil {
+		return
+	}
+	result := Models.DocumentIntegrity{DocumentID: versions[0].ID, Intact: true}
+	prevHash := ""
+	for i, v := range versions {
+		check := Models.DocumentVersionCheck{Version: v.Version}
+		switch {
+		case v.Version != i+1:
+			check.Problem = "version missing from the chain"
+		case v.PrevHash != prevHash:
+			check.Problem = "previous hash does not match"
+		case v.ChainHash != documentChainHash(v):
+			check.Problem = "metadata does not match chain hash"
+		default:
+			check.ChainOK = true
+		}
+		if problem := h.checkDocumentContent(v); problem != "" {
+			if check.Problem == "" {
+				check.Problem = problem
+			}
+		} else {
+			check.ContentOK = true
+		}
+		result.Intact = result.Intact && check.ChainOK && check.ContentOK
+		// The whole chain is checked, but only visible versions are listed
+		if visible[i] {
+			result.Versions = append(result.Versions, check)
+		}
+		prevHash = v.ChainHash
+	}
+	RenderJSON(w, result)
+}
+
+// checkDocumentContent hashes the stored content and reports any mismatch.
+func (h *Courthandler) checkDocumentContent(doc *Models.CaseDocument) string {
+	stream, err := h.repo.OpenCaseFile(doc.FileID)
+	if err != nil {
+		return "content missing from storage"
+	}
+	defer stream.Close()
+	sum := sha256.New()
+	n, err := io.Copy(sum, stream)
+	switch {
+	case err != nil:
+		return "content could not be read"
+	case n != doc.Size:
+		return "content size does not match"
+	case hex.EncodeToString(sum.Sum(nil)) != doc.SHA256:
+		return "content hash does not match"
+	}
+	return ""
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/pdfdoc"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+// verifyURL links to the public verification of a certificate, through its
+// short code when it has one since that makes a smaller QR code.
+func (h *Courthandler) verifyURL(c *Models.Certificate) string {
+	if c.ShortCode != "" {
+		return h.cfg.PublicBaseURL + "/v/" + c.ShortCode
+	}
+	return h.cfg.PublicBaseURL + "/verify/" + c.Number
+}
+
+// canAccessCase lets court staff see every case and parties see their own.
+func canAccessCase(u *Models.User, c *Models.Case) bool {
+	return isStaff(u) || partyOf(u, c) != ""
+}
+
+// renderPDF renders the document fully before writing so a rendering error,
+// or err from laying it out, can still be reported with a proper status.
+func renderPDF(w http.ResponseWriter, filename string, doc pdfdoc.Document, err error) {
+	var buf bytes.Buffer
+	if err == nil {
+		err = pdfdoc.Render(&buf, doc)
+	}
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Failed to render document", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`.pdf"`)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// caseForUser loads the case from the route and checks the caller may see it.
+func (h *Courthandler) caseForUser(w http.ResponseWriter, r *http.Request) (*Models.User, *Models.Case) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, nil
+	}
+	c, err := h.repo.GetCase(mux.Vars(r)["id"])
+	if err != nil || !canAccessCase(user, c) {
+		http.Error(w, "Case not found", http.StatusNotFound)
+		return nil, nil
+	}
+	return user, c
+}
+func (h *Courthandler) GetCertificatePDF(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	certificate, err := h.repo.GetCertificate(mux.Vars(r)["number"])
+	if err != nil || (certificate.HolderEmail != user.Email && !isStaff(user)) {
+		http.Error(w, "Certificate not found", http.StatusNotFound)
+		return
+	}
+	h.record(r, user.Email, "certificate.read", "certificate/"+certificate.Number, nil, nil)
+	doc, err := pdfdoc.Certificate(certificate, h.verifyURL(certificate))
+	renderPDF(w, certificate.Number, doc, err)
+}
+func (h *Courthandler) GetSummonsPDF(w http.ResponseWriter, r *http.Request) {
+	_, c := h.caseForUser(w, r)
+	if c == nil {
+		return
+	}
+	party := c.Defendant
+	if r.URL.Query().Get("party") == "plaintiff" {
+		party = c.Plaintiff
+	}
+	if party == "" {
+		http.Error(w, "party is required", http.StatusBadRequest)
+		return
+	}
+	hearing := hearingForDocument(w, r, c)
+	if hearing == nil {
+		return
+	}
+	doc, err := pdfdoc.Summons(h.cfg.CourtName, h.cfg.TimeZone, c, party, hearing)
+	renderPDF(w, "poziv-"+c.ID, doc, err)
+}
+func (h *Courthandler) GetHearingNoticePDF(w http.ResponseWriter, r *http.Request) {
+	_, c := h.caseForUser(w, r)
+	if c == nil {
+		return
+	}
+	hearing := hearingForDocument(w, r, c)
+	if hearing == nil {
+		return
+	}
+	doc, err := pdfdoc.HearingNotice(h.cfg.CourtName, h.cfg.TimeZone, c, hearing)
+	renderPDF(w, "rociste-"+c.ID, doc, err)
+}
+func (h *Courthandler) GetDecisionPDF(w http.ResponseWriter, r *http.Request) {
+	_, c := h.caseForUser(w, r)
+	if c == nil {
+		return
+	}
+	if c.Verdict == nil {
+		http.Error(w, "No decision in this case yet", http.StatusNotFound)
+		return
+	}
+	doc, err := pdfdoc.Decision(h.cfg.CourtName, c)
+	renderPDF(w, "presuda-"+c.ID, doc, err)
+}
+
+// hearingForDocument finds the case hearing named by the hearing query
+// parameter, which must still be ahead, writing the error response itself
+// when there is none.
+func hearingForDocument(w http.ResponseWriter, r *http.Request, c *Models.Case) *Models.Hearing {
+	id := r.URL.Query().Get("hearing")
+	if id == "" {
+		http.Error(w, "hearing is required", http.StatusBadRequest)
+		return nil
+	}
+	for i := range c.Hearings {
+		if c.Hearings[i].ID != id {
+			continue
+		}
+		if hearingOver(c.Hearings[i].Status) {
+			http.Error(w, "Hearing is over", http.StatusConflict)
+			return nil
+		}
+		return &c.Hearings[i]
+	}
+	http.Error(w, "Hearing not found", http.StatusNotFound)
+	return nil
+}
@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/docsign"
+	"github.com/EupravaProjekat/court/pdfdoc"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	EvidencePhysical = "physical"
+	EvidenceDigital  = "digital"
+
+	CustodyReceived    = "received"
+	CustodyTransferred = "transferred"
+	CustodyReturned    = "returned"
+	CustodyDestroyed   = "destroyed"
+
+	EvidenceRegistered = "registered"
+	EvidenceInCustody  = "in_custody"
+	EvidenceDestroyed  = "destroyed"
+)
+
+// custodyClockSkew is how far in the future a custody entry may be dated.
+const custodyClockSkew = 5 * time.Minute
+
+// keyChallengeTTL is how long a signing key challenge can be answered.
+const keyChallengeTTL = 5 * time.Minute
+
+// keyChallengeMessage is what a user signs to register a key: the
+// challenge bound to their account and the key itself.
+func keyChallengeMessage(email, publicKey, challenge string) []byte {
+	return []byte("court custody signing key\n" + email + "\n" + publicKey + "\n" + challenge)
+}
+
+// NewSigningKeyChallenge issues the nonce RegisterSigningKey expects to be
+// signed with the new key.
+func (h *Courthandler) NewSigningKeyChallenge(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	nonce, err := randomCode(32)
+	if err != nil {
+		http.Error(w, "Failed to issue a challenge", http.StatusInternalServerError)
+		return
+	}
+	challenge := Models.KeyChallenge{
+		Email:     user.Email,
+		Challenge: nonce,
+		ExpiresAt: time.Now().Add(keyChallengeTTL),
+	}
+	err = h.repo.NewKeyChallenge(&challenge)
+	if err != nil {
+		http.Error(w, "Failed to issue a challenge", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, challenge)
+}
+
+// RegisterSigningKey sets the Ed25519 public key the caller signs custody
+// entries with. The caller proves they hold the private key by signing
+// keyChallengeMessage for a challenge from NewSigningKeyChallenge. Earlier
+// keys are retired but kept, so entries they signed keep verifying.
+func (h *Courthandler) RegisterSigningKey(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	var req struct {
+		PublicKey string `json:"public_key"` // Base64 of the raw 32 byte key
+		Challenge string `json:"challenge"`
+		Signature string `json:"signature"` // Base64 signature of keyChallengeMessage
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(req.PublicKey)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		http.Error(w, "public_key must be a base64 Ed25519 public key", http.StatusBadRequest)
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil || !ed25519.Verify(raw, keyChallengeMessage(user.Email, req.PublicKey, req.Challenge), sig) {
+		http.Error(w, "signature must sign the challenge with the new key", http.StatusBadRequest)
+		return
+	}
+	if err := h.repo.TakeKeyChallenge(user.Email, req.Challenge); err != nil {
+		if Repo.IsNotFound(err) {
+			http.Error(w, "challenge unknown or expired, request a new one", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to check the challenge", http.StatusInternalServerError)
+		return
+	}
+	fingerprint := sha256.Sum256(raw)
+	key := docsign.PublicKey{
+		KeyID:     user.Email + "#" + hex.EncodeToString(fingerprint[:8]),
+		Algorithm: docsign.Algorithm,
+		PublicKey: req.PublicKey,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	keys := user.SigningKeys
+	for i := range keys {
+		if keys[i].KeyID == key.KeyID && keys[i].RetiredAt == "" {
+			RenderJSON(w, keys[i])
+			return
+		}
+		if keys[i].RetiredAt == "" {
+			keys[i].RetiredAt = key.CreatedAt
+		}
+	}
+	keys = append(keys, key)
+	err = h.repo.SetUserSigningKeys(user.Uuid, keys)
+	if err != nil {
+		http.Error(w, "Failed to save the key", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, user.Email, "signing_key.register", "user/"+user.Uuid, nil, key)
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, key)
+}
+
+// currentSigningKey is the key new entries must be signed with.
+func currentSigningKey(u *Models.User) *docsign.PublicKey {
+	for i := len(u.SigningKeys) - 1; i >= 0; i-- {
+		if u.SigningKeys[i].RetiredAt == "" {
+			return &u.SigningKeys[i]
+		}
+	}
+	return nil
+}
+
+// keysAt returns the keys that were in use at t: registered by then and
+// not yet retired.
+func keysAt(keys []docsign.PublicKey, t time.Time) []docsign.PublicKey {
+	valid := []docsign.PublicKey{}
+	for _, k := range keys {
+		created, err := time.Parse(time.RFC3339, k.CreatedAt)
+		if err != nil || t.Before(created) {
+			continue
+		}
+		if retired, err := time.Parse(time.RFC3339, k.RetiredAt); err == nil && !t.Before(retired) {
+			continue
+		}
+		valid = append(valid, k)
+	}
+	return valid
+}
+
+// custodyHash chains an entry: the claim carries the previous hash, and the
+// signature is included so it can't be swapped afterwards.
+func custodyHash(claim Models.CustodyClaim, sig docsign.Signature) (string, error) {
+	payload, err := docsign.Canonicalize(claim)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append(append(payload, '\n'), sig.Value...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (h *Courthandler) NewEvidence(w http.ResponseWriter, r *http.Request) {
+	user := RequireRole(w, r, h.repo, RoleOperator, RoleJudge, RoleAdmin)
+	if user == nil {
+		return
+	}
+	c, err := h.repo.GetCase(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Case not found", http.StatusNotFound)
+		return
+	}
+	var payload Models.Evidence
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil || payload.Description == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if payload.Type != EvidencePhysical && payload.Type != EvidenceDigital {
+		http.Error(w, "type must be physical or digital", http.StatusBadRequest)
+		return
+	}
+	if payload.DocumentID != "" {
+		if _, err := h.repo.GetCaseDocument(c.ID, payload.DocumentID); err != nil {
+			http.Error(w, "Document not found", http.StatusBadRequest)
+			return
+		}
+	}
+	evidence := Models.Evidence{
+		ID:              uuid.New().String(),
+		CaseID:          c.ID,
+		Description:     payload.Description,
+		Type:            payload.Type,
+		DocumentID:      payload.DocumentID,
+		StorageLocation: payload.StorageLocation,
+		SealNumber:      payload.SealNumber,
+		Status:          EvidenceRegistered,
+		RegisteredBy:    user.Email,
+		RegisteredAt:    time.Now().Format(time.RFC3339),
+	}
+	err = h.repo.NewEvidence(&evidence)
+	if err != nil {
+		http.Error(w, "Failed to save the evidence", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, user.Email, "evidence.create", "evidence/"+evidence.ID, nil, evidence)
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, evidence)
+}
+func (h *Courthandler) GetCaseEvidence(w http.ResponseWriter, r *http.Request) {
+	user, c := h.caseForUser(w, r)
+	if c == nil {
+		return
+	}
+	items, err := h.repo.GetCaseEvidence(c.ID)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Evidence not found", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, user.Email, "evidence.list", "case/"+c.ID, nil, nil)
+	RenderJSON(w, items)
+}
+
+// evidenceForUser loads the route's evidence item if the caller may see
+// its case.
+func (h *Courthandler) evidenceForUser(w http.ResponseWriter, r *http.Request) (*Models.User, *Models.Evidence) {
+	user, c := h.caseForUser(w, r)
+	if c == nil {
+		return nil, nil
+	}
+	evidence, err := h.repo.GetEvidence(c.ID, mux.Vars(r)["evidenceId"])
+	if err != nil {
+		http.Error(w, "Evidence not found", http.StatusNotFound)
+		return nil, nil
+	}
+	return user, evidence
+}
+func (h *Courthandler) GetEvidence(w http.ResponseWriter, r *http.Request) {
+	user, evidence := h.evidenceForUser(w, r)
+	if evidence == nil {
+		return
+	}
+	h.record(r, user.Email, "evidence.read", "evidence/"+evidence.ID, nil, nil)
+	RenderJSON(w, evidence)
+}
+
+// AddCustodyEntry appends a signed hand-off to the custody log. The client
+// signs the claim with the key registered on its profile; the claim must
+// name the next sequence number and the last entry's hash.
+func (h *Courthandler) AddCustodyEntry(w http.ResponseWriter, r *http.Request) {
+	user := RequireRole(w, r, h.repo, RoleOperator, RoleJudge, RoleAdmin)
+	if user == nil {
+		return
+	}
+	key := currentSigningKey(user)
+	if key == nil {
+		http.Error(w, "register a signing key before recording custody", http.StatusPreconditionFailed)
+		return
+	}
+	evidence, err := h.repo.GetEvidence(mux.Vars(r)["id"], mux.Vars(r)["evidenceId"])
+	if err != nil {
+		http.Error(w, "Evidence not found", http.StatusNotFound)
+		return
+	}
+	if evidence.Status == EvidenceDestroyed {
+		http.Error(w, "evidence was destroyed", http.StatusConflict)
+		return
+	}
+	var req struct {
+		Models.CustodyClaim
+		Signature docsign.Signature `json:"signature"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	entries, err := h.repo.GetCustodyLog(evidence.ID)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Failed to read the custody log", http.StatusInternalServerError)
+		return
+	}
+	// The log, not the evidence record, says who holds the item and when
+	// it last changed hands
+	prevHash, holder, lastActed := "", "", time.Time{}
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		prevHash, holder = last.Hash, last.ToHolder
+		lastActed, _ = time.Parse(time.RFC3339, last.ActedAt)
+	}
+
+	claim := req.CustodyClaim
+	actedAt, err := time.Parse(time.RFC3339, claim.ActedAt)
+	switch {
+	case claim.CaseID != evidence.CaseID || claim.EvidenceID != evidence.ID:
+		err = errors.New("claim names another evidence item")
+	case claim.ActedBy != user.Email:
+		err = errors.New("acted_by must be the signing user")
+	case err != nil || actedAt.After(time.Now().Add(custodyClockSkew)):
+		err = errors.New("acted_at must be an RFC 3339 time, not in the future")
+	case actedAt.Before(lastActed):
+		err = errors.New("acted_at can't be before the previous entry")
+	case len(keysAt([]docsign.PublicKey{*key}, actedAt)) == 0:
+		err = errors.New("acted_at can't be before the signing key was registered")
+	case len(entries) == 0 && claim.Action != CustodyReceived:
+		err = errors.New("the first entry must be " + CustodyReceived)
+	case len(entries) > 0 && claim.Action != CustodyTransferred && claim.Action != CustodyReturned && claim.Action != CustodyDestroyed:
+		err = errors.New("action must be transferred, returned or destroyed")
+	case claim.Action != CustodyDestroyed && claim.ToHolder == "":
+		err = errors.New("to_holder is required")
+	case claim.FromHolder != holder:
+		err = errors.New("from_holder must be the current holder " + holder)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if claim.Seq != len(entries)+1 || claim.PrevHash != prevHash {
+		http.Error(w, "claim is not for the end of the log, fetch it and sign again", http.StatusConflict)
+		return
+	}
+	if err := docsign.VerifyPayload([]docsign.PublicKey{*key}, claim, req.Signature); err != nil {
+		http.Error(w, "signature: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry := Models.CustodyEntry{
+		CustodyClaim: claim,
+		Signature:    req.Signature,
+		RecordedAt:   time.Now().Format(time.RFC3339),
+	}
+	entry.Hash, err = custodyHash(claim, req.Signature)
+	if err != nil {
+		http.Error(w, "Failed to record the entry", http.StatusInternalServerError)
+		return
+	}
+	status, location, seal := EvidenceInCustody, evidence.StorageLocation, evidence.SealNumber
+	if claim.Action == CustodyDestroyed {
+		status = EvidenceDestroyed
+	}
+	if claim.Location != "" {
+		location = claim.Location
+	}
+	if claim.SealNumber != "" {
+		seal = claim.SealNumber
+	}
+	err = h.repo.AppendCustodyEntry(&entry, claim.ToHolder, location, seal, status)
+	if err != nil {
+		if Repo.IsDuplicate(err) {
+			http.Error(w, "another entry was recorded meanwhile, fetch the log and sign again", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to record the entry", http.StatusInternalServerError)
+		return
+	}
+
+	h.record(r, user.Email, "evidence.custody", "evidence/"+evidence.ID, evidence, entry)
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, entry)
+}
+
+type custodyEntryCheck struct {
+	*Models.CustodyEntry
+	SignatureValid bool `json:"signature_valid"`
+	ChainValid     bool `json:"chain_valid"`
+}
+
+// checkCustodyLog re-verifies each entry's signature against the keys its
+// signer had in use when they acted, and its place in the hash chain. An
+// entry dated before its predecessor breaks the chain.
+func (h *Courthandler) checkCustodyLog(entries []*Models.CustodyEntry) []custodyEntryCheck {
+	signers := map[string][]docsign.PublicKey{}
+	checks := make([]custodyEntryCheck, len(entries))
+	prevHash, prevActed := "", time.Time{}
+	for i, entry := range entries {
+		keys, ok := signers[entry.ActedBy]
+		if !ok {
+			if signer, err := h.repo.GetByEmail(entry.ActedBy); err == nil && signer != nil {
+				keys = signer.SigningKeys
+			}
+			signers[entry.ActedBy] = keys
+		}
+		actedAt, timeErr := time.Parse(time.RFC3339, entry.ActedAt)
+		hash, err := custodyHash(entry.CustodyClaim, entry.Signature)
+		checks[i] = custodyEntryCheck{
+			CustodyEntry:   entry,
+			SignatureValid: timeErr == nil && docsign.VerifyPayload(keysAt(keys, actedAt), entry.CustodyClaim, entry.Signature) == nil,
+			ChainValid: err == nil && timeErr == nil && hash == entry.Hash && entry.PrevHash == prevHash && entry.Seq == i+1 &&
+				!actedAt.Before(prevActed),
+		}
+		prevHash, prevActed = entry.Hash, actedAt
+	}
+	return checks
+}
+func (h *Courthandler) GetCustodyLog(w http.ResponseWriter, r *http.Request) {
+	user, evidence := h.evidenceForUser(w, r)
+	if evidence == nil {
+		return
+	}
+	entries, err := h.repo.GetCustodyLog(evidence.ID)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Failed to read the custody log", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, user.Email, "evidence.custody_read", "evidence/"+evidence.ID, nil, nil)
+	RenderJSON(w, h.checkCustodyLog(entries))
+}
+
+// GetCustodyReport prints the full custody chain for court, marking any
+// entry whose signature or chain link no longer verifies.
+func (h *Courthandler) GetCustodyReport(w http.ResponseWriter, r *http.Request) {
+	user, evidence := h.evidenceForUser(w, r)
+	if evidence == nil {
+		return
+	}
+	entries, err := h.repo.GetCustodyLog(evidence.ID)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Failed to read the custody log", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, user.Email, "evidence.custody_report", "evidence/"+evidence.ID, nil, nil)
+	valid := make([]bool, len(entries))
+	for i, check := range h.checkCustodyLog(entries) {
+		valid[i] = check.SignatureValid && check.ChainValid
+	}
+	doc, err := pdfdoc.CustodyReport(h.cfg.CourtName, h.cfg.TimeZone, evidence, entries, valid)
+	renderPDF(w, "lanac-cuvanja-"+evidence.ID, doc, err)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"github.com/EupravaProjekat/court/docsign"
+	"testing"
+	"time"
+)
+
+func TestKeysAt(t *testing.T) {
+	keys := []docsign.PublicKey{
+		{KeyID: "old", CreatedAt: "2024-01-01T00:00:00Z", RetiredAt: "2024-06-01T00:00:00Z"},
+		{KeyID: "new", CreatedAt: "2024-06-01T00:00:00Z"},
+	}
+	tests := []struct {
+		at   string
+		want string
+	}{
+		{"2023-12-31T23:59:59Z", ""},
+		{"2024-01-01T00:00:00Z", "old"},
+		{"2024-05-31T23:59:59Z", "old"},
+		{"2024-06-01T00:00:00Z", "new"},
+		{"2030-01-01T00:00:00Z", "new"},
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse(time.RFC3339, tt.at)
+		got := ""
+		for _, k := range keysAt(keys, at) {
+			got += k.KeyID
+		}
+		if got != tt.want {
+			t.Errorf("keysAt(%s) = %q, want %q", tt.at, got, tt.want)
+		}
+	}
+}
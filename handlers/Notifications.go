@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/notify"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GetNotifications returns the caller's inbox, newest first, with the
+// number still unread. ?unread=true lists only those.
+func (h *Courthandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		http.Error(w, "User doesn't exist", http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	notifications, err := h.repo.GetNotifications(user.Email, query.Get("unread") == "true", limit)
+	if err != nil {
+		http.Error(w, "Notifications not found", http.StatusInternalServerError)
+		return
+	}
+	unread, err := h.repo.CountUnreadNotifications(user.Email)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Notifications not found", http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, struct {
+		Unread        int64                  `json:"unread"`
+		Notifications []*notify.Notification `json:"notifications"`
+	}{unread, notifications})
+}
+func (h *Courthandler) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		http.Error(w, "User doesn't exist", http.StatusForbidden)
+		return
+	}
+	changed, err := h.repo.MarkNotificationsRead(user.Email, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Couldn't update the notification", http.StatusInternalServerError)
+		return
+	}
+	if changed == 0 {
+		http.Error(w, "No unread notification with that id", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (h *Courthandler) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		http.Error(w, "User doesn't exist", http.StatusForbidden)
+		return
+	}
+	_, err := h.repo.MarkNotificationsRead(user.Email, "")
+	if err != nil {
+		http.Error(w, "Couldn't update the notifications", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (h *Courthandler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		http.Error(w, "User doesn't exist", http.StatusForbidden)
+		return
+	}
+	RenderJSON(w, user.Notifications)
+}
+
+// UpdateNotificationPreferences replaces the caller's language, disabled
+// channels and muted notification kinds.
+func (h *Courthandler) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user := ValidateJwt(r, h.repo)
+	if user == nil {
+		http.Error(w, "User doesn't exist", http.StatusForbidden)
+		return
+	}
+	var prefs Models.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	switch prefs.Language {
+	case "", notify.LanguageSerbian, notify.LanguageEnglish:
+	default:
+		http.Error(w, "language must be sr or en", http.StatusBadRequest)
+		return
+	}
+	for _, channel := range prefs.Disabled {
+		if channel != notify.ChannelInApp && channel != notify.ChannelEmail {
+			http.Error(w, "disabled channels must be inapp or email", http.StatusBadRequest)
+			return
+		}
+	}
+	err := h.repo.SetNotificationPreferences(user.Email, prefs)
+	if err != nil {
+		http.Error(w, "Couldn't save the preferences", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, user.Email, "notifications.preferences", "user/"+user.Email, user.Notifications, prefs)
+	RenderJSON(w, prefs)
+}
+
+// GetNotificationDeliveries lists notifications by the state of their
+// delivery over a channel, by default email deliveries that failed.
+func (h *Courthandler) GetNotificationDeliveries(w http.ResponseWriter, r *http.Request) {
+	if RequireRole(w, r, h.repo, RoleAdmin) == nil {
+		return
+	}
+	query := r.URL.Query()
+	channel, status := query.Get("channel"), query.Get("status")
+	if channel == "" {
+		channel = notify.ChannelEmail
+	}
+	if status == "" {
+		status = notify.StatusFailed
+	}
+	limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	notifications, err := h.repo.GetNotificationDeliveries(channel, status, limit)
+	if err != nil {
+		http.Error(w, "Notifications not found", http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, notifications)
+}
+
+// RetryNotification sends a failed notification again over the channel
+// query parameter, email by default.
+func (h *Courthandler) RetryNotification(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	channel := r.URL.Query().Get("channel")
+	if channel == "" {
+		channel = notify.ChannelEmail
+	}
+	err := h.repo.RetryNotification(id, channel)
+	if err != nil {
+		if Repo.IsNotFound(err) {
+			http.Error(w, "No failed notification with that id", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Couldn't retry the notification", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, admin.Email, "notification.retry", "notification/"+id, nil, nil)
+	h.notifier.Notify()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/outbox"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GetOutboxMessages lists outbox messages, newest first. With sink and
+// status it lists only deliveries in that state, e.g. ?sink=http&status=dead.
+func (h *Courthandler) GetOutboxMessages(w http.ResponseWriter, r *http.Request) {
+	if RequireRole(w, r, h.repo, RoleAdmin) == nil {
+		return
+	}
+	query := r.URL.Query()
+	limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	messages, err := h.repo.GetOutboxMessages(query.Get("sink"), query.Get("status"), limit)
+	if err != nil {
+		http.Error(w, "Outbox not available", http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, messages)
+}
+
+// GetOutboxStats counts deliveries by sink and status.
+func (h *Courthandler) GetOutboxStats(w http.ResponseWriter, r *http.Request) {
+	if RequireRole(w, r, h.repo, RoleAdmin) == nil {
+		return
+	}
+	stats := map[string]map[string]int64{}
+	for _, sink := range h.outbox.Sinks() {
+		stats[sink] = map[string]int64{}
+		for _, status := range []string{outbox.StatusPending, outbox.StatusDelivered, outbox.StatusDead} {
+			n, err := h.repo.CountOutboxMessages(sink, status)
+			if err != nil {
+				log.Printf("Operation Failed: %v\n", err)
+				http.Error(w, "Outbox not available", http.StatusInternalServerError)
+				return
+			}
+			stats[sink][status] = n
+		}
+	}
+	RenderJSON(w, stats)
+}
+
+// RetryOutboxMessage re-queues a message's delivery to the sink given by
+// the sink query parameter, or to every sink it has not reached.
+func (h *Courthandler) RetryOutboxMessage(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	sinks := h.outbox.Sinks()
+	if sink := r.URL.Query().Get("sink"); sink != "" {
+		sinks = []string{sink}
+	}
+	retried := 0
+	for _, sink := range sinks {
+		err := h.repo.RetryOutboxMessage(id, sink)
+		if err == nil {
+			retried++
+		} else if !Repo.IsNotFound(err) {
+			http.Error(w, "Couldn't retry the message", http.StatusInternalServerError)
+			return
+		}
+	}
+	if retried == 0 {
+		http.Error(w, "No undelivered message with that id", http.StatusNotFound)
+		return
+	}
+	h.record(r, admin.Email, "outbox.retry", "outbox/"+id, nil, nil)
+	h.outbox.Notify()
+	w.WriteHeader(http.StatusNoContent)
+}
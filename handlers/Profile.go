@@ -1,30 +1,60 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"github.com/EupravaProjekat/court/Models"
 	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/audit"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/eventstream"
+	"github.com/EupravaProjekat/court/lookupcache"
+	"github.com/EupravaProjekat/court/notify"
+	"github.com/EupravaProjekat/court/outbox"
+	"github.com/EupravaProjekat/court/prosecution"
+	"github.com/EupravaProjekat/court/serviceauth"
+	"github.com/EupravaProjekat/court/webhooks"
 	protos "github.com/MihajloJankovic/profile-service/protos/main"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"io"
 	"log"
 	"mime"
 	"net/http"
-	"strconv"
 	"time"
 )
 
 type Courthandler struct {
-	l    *log.Logger
-	repo *Repo.Repo
+	l           *log.Logger
+	repo        *Repo.Repo
+	replay      serviceauth.ReplayStore
+	prosecution *prosecution.Client
+	cache       *lookupcache.Cache
+	signer      *docSigner
+	audit       *audit.Log
+	outbox      *outbox.Dispatcher
+	webhooks    *webhooks.Worker
+	stream      *eventstream.Hub
+	notifier    *notify.Service
+	cfg         Config
+	boards      *boardFeeds
 }
 
-func NewCourthandler(l *log.Logger, r *Repo.Repo) *Courthandler {
-	return &Courthandler{l, r}
-
+func NewCourthandler(l *log.Logger, r *Repo.Repo, cfg Config, p *prosecution.Client, o *outbox.Dispatcher, wh *webhooks.Worker, st *eventstream.Hub, n *notify.Service) *Courthandler {
+	return &Courthandler{
+		l:           l,
+		repo:        r,
+		replay:      r.ReplayStore(),
+		prosecution: p,
+		cache:       newProsecutionCache(r, cfg),
+		signer:      &docSigner{dir: cfg.SigningKeyDir},
+		audit:       audit.New(r.AuditStore()),
+		outbox:      o,
+		webhooks:    wh,
+		stream:      st,
+		notifier:    n,
+		cfg:         cfg,
+		boards:      &boardFeeds{feeds: map[boardKey]*boardFeed{}},
+	}
 }
 
 func (h *Courthandler) CheckIfUserExists(w http.ResponseWriter, r *http.Request) {
@@ -64,7 +94,7 @@ func (h *Courthandler) NewUser(w http.ResponseWriter, r *http.Request) {
 	}
 	newUUID := uuid.New().String()
 	rt.Uuid = newUUID
-	rt.Role = "Guest"
+	rt.Role = RoleGuest
 	err = h.repo.NewUser(rt)
 	if err != nil {
 		log.Printf("Operation Failed: %v\n", err)
@@ -75,8 +105,14 @@ func (h *Courthandler) NewUser(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	h.record(r, rt.Email, "user.create", "user/"+rt.Uuid, nil, rt)
 	w.WriteHeader(http.StatusOK)
 }
+
+// NewCase files a case. Court staff file cases directly; a citizen files
+// one as its plaintiff, and it stays unverified until staff confirm it
+// with VerifyCase. Until then it counts for nothing: no prosecution
+// record, no notifications, and only the filer sees it.
 func (h *Courthandler) NewCase(w http.ResponseWriter, r *http.Request) {
 	// Parse the JSON body of the request
 	var payload Models.Case
@@ -98,15 +134,34 @@ func (h *Courthandler) NewCase(w http.ResponseWriter, r *http.Request) {
 
 	// Create a new Case instance
 	newCase := Models.Case{
-		ID:           caseID,
-		Type:         payload.Type,
-		Status:       "Open",                          // Default status is "Open"
-		FilingDate:   time.Now().Format(time.RFC3339), // Set the filing date to the current time
-		HearingDates: payload.HearingDates,            // Use the provided hearing dates
-		Judge:        payload.Judge,
-		Plaintiff:    payload.Plaintiff,
-		Defendant:    payload.Defendant,
-		Lawyers:      payload.Lawyers,
+		ID:                  caseID,
+		Type:                payload.Type,
+		Status:              CaseStatusOpen,                  // Default status is "Open"
+		FilingDate:          time.Now().Format(time.RFC3339), // Set the filing date to the current time
+		HearingDates:        payload.HearingDates,            // Use the provided hearing dates
+		Judge:               payload.Judge,
+		Plaintiff:           payload.Plaintiff,
+		Defendant:           payload.Defendant,
+		Lawyers:             payload.Lawyers,
+		PlaintiffEmail:      payload.PlaintiffEmail,
+		DefendantEmail:      payload.DefendantEmail,
+		DefendantNationalID: payload.DefendantNationalID,
+		Visibility:          CaseVisibilityPublic,
+	}
+	if payload.Visibility == CaseVisibilityConfidential {
+		newCase.Visibility = CaseVisibilityConfidential
+	}
+	if !isStaff(user) {
+		newCase.Unverified = true
+		newCase.Judge = ""
+		newCase.PlaintiffEmail = user.Email
+	} else {
+		// Staff entered these addresses themselves
+		for _, email := range []string{newCase.PlaintiffEmail, newCase.DefendantEmail} {
+			if email != "" {
+				newCase.ConfirmedEmails = append(newCase.ConfirmedEmails, email)
+			}
+		}
 	}
 
 	// Create a new Request instance to associate the case with the user
@@ -119,11 +174,19 @@ func (h *Courthandler) NewCase(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:   time.Now().Format(time.RFC3339), // Set the creation time
 	}
 
+	// Persist the new case so the court's own registers can find it
+	filed, herr := h.commitCaseEvents(user.Email, nil, &caseevents.Event{Type: caseevents.CaseFiled, Case: &newCase})
+	if herr != nil {
+		http.Error(w, herr.message, herr.status)
+		return
+	}
+	newCase = *filed
+	h.invalidatePerson(r.Context(), newCase.DefendantEmail, newCase.DefendantNationalID)
+	h.record(r, user.Email, "case.create", "case/"+newCase.ID, nil, newCase)
+
 	// Append the new request to the user's Requests slice
 	user.Requests = append(user.Requests, newRequest)
-
-	// Persist the new case in the database (optional, depending on your repo implementation)
-	err = h.repo.Update(user)
+	err = h.commitRequest(user, RequestCreated, newRequest)
 	if err != nil {
 		http.Error(w, "Failed to save the case", http.StatusInternalServerError)
 		return
@@ -133,20 +196,21 @@ func (h *Courthandler) NewCase(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(newCase)
 }
-func (h *Courthandler) GetAllCases(w http.ResponseWriter, r *http.Request) {
 
-	//res := ValidateJwt(r, h.repo)
-	//if res == nil {
-	//	err := errors.New("user doesnt exist")
-	//	http.Error(w, err.Error(), http.StatusForbidden)
-	//	return
-	//}
-	//if res.Role != "Operator" {
-	//	err := errors.New("role error")
-	//	http.Error(w, err.Error(), http.StatusForbidden)
-	//	return
-	//}
-	response, err := h.repo.GetAllCases()
+// GetAllCases lists every case to court staff and their own cases to
+// everyone else.
+func (h *Courthandler) GetAllCases(w http.ResponseWriter, r *http.Request) {
+	res := RequireRole(w, r, h.repo, RoleGuest, RoleOperator, RoleJudge, RoleAdmin)
+	if res == nil {
+		return
+	}
+	var response []*Models.Case
+	var err error
+	if isStaff(res) {
+		response, err = h.repo.GetAllCases()
+	} else {
+		response, err = h.repo.GetCasesOfParty(res.Email)
+	}
 	if err != nil {
 		log.Printf("Operation Failed: %v\n", err)
 		w.WriteHeader(http.StatusNotFound)
@@ -156,22 +220,23 @@ func (h *Courthandler) GetAllCases(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	visible := []*Models.Case{}
+	for _, c := range response {
+		if canAccessCase(res, c) {
+			visible = append(visible, c)
+		}
+	}
+	response = visible
+	h.record(r, res.Email, "case.list", "cases", nil, nil)
 	w.WriteHeader(http.StatusOK)
 	RenderJSON(w, response)
 }
 func (h *Courthandler) GetallRequests(w http.ResponseWriter, r *http.Request) {
 
-	//res := ValidateJwt(r, h.repo)
-	//if res == nil {
-	//	err := errors.New("user doesnt exist")
-	//	http.Error(w, err.Error(), http.StatusForbidden)
-	//	return
-	//}
-	//if res.Role != "Operator" {
-	//	err := errors.New("role error")
-	//	http.Error(w, err.Error(), http.StatusForbidden)
-	//	return
-	//}
+	res := RequireRole(w, r, h.repo, RoleOperator, RoleJudge, RoleAdmin)
+	if res == nil {
+		return
+	}
 	response, err := h.repo.GetAllRequest()
 	if err != nil {
 		log.Printf("Operation Failed: %v\n", err)
@@ -182,6 +247,7 @@ func (h *Courthandler) GetallRequests(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	h.record(r, res.Email, "request.list", "requests", nil, nil)
 	w.WriteHeader(http.StatusOK)
 	RenderJSON(w, response)
 }
@@ -206,6 +272,7 @@ func (h *Courthandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	h.record(r, res.Email, "profile.read", "user/"+response.Uuid, nil, nil)
 	w.WriteHeader(http.StatusOK)
 	RenderJSON(w, response)
 }
@@ -232,58 +299,6 @@ func (h *Courthandler) NewRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Assign a new UUID to the request and set status
-	newUUID := uuid.New().String()
-	rt := Models.Request{
-		ID:     newUUID,
-		Status: "received",
-		Case:   req.Uuid, // Assuming the case information comes from the UUID
-	}
-
-	// Prepare data to send to the external service (e.g., case-checking service)
-	userData := []byte(`{"case_id":"` + req.Uuid + `"}`)
-
-	// Placeholders for external service URL and secret
-	apiUrl := "YOUR_EXTERNAL_SERVICE_URL" ///////////////////////////
-	secretCode := "prosecution-service-secret-code"
-
-	// Create a new HTTP POST request
-	externalReq, err := http.NewRequest("POST", apiUrl, bytes.NewBuffer(userData))
-	if err != nil {
-		http.Error(w, "Failed to create external request", http.StatusInternalServerError)
-		return
-	}
-	externalReq.Header.Set("Content-Type", "application/json; charset=utf-8")
-	externalReq.Header.Set("jwt", r.Header.Get("jwt")) // Forward JWT from the original request
-	externalReq.Header.Set("secret", secretCode)
-
-	// Send the request to the external service
-	client := &http.Client{}
-	externalResp, err := client.Do(externalReq)
-	if err != nil {
-		http.Error(w, "Error in external service communication", http.StatusInternalServerError)
-		return
-	}
-	defer externalResp.Body.Close()
-
-	// Read the response body
-	responseBody, err := io.ReadAll(externalResp.Body)
-	if err != nil {
-		http.Error(w, "Failed to read response from external service", http.StatusInternalServerError)
-		return
-	}
-
-	// Unmarshal response into a Response struct
-	var resp Models.Response
-	err = json.Unmarshal(responseBody, &resp)
-	if err != nil {
-		http.Error(w, "Error parsing external service response", http.StatusInternalServerError)
-		return
-	}
-
-	// Update the request's `CaseStatus` field based on external response
-	rt.Description = "Case status: " + strconv.FormatBool(resp.CaseStatus)
-
 	// Validate user (you may have a function like `ValidateJwt`)
 	user := ValidateJwt(r, h.repo)
 	if user == nil {
@@ -291,18 +306,39 @@ func (h *Courthandler) NewRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update user with the new request
+	// The request waits for the prosecution service's callback
+	rt := Models.Request{
+		ID:          uuid.New().String(),
+		Status:      RequestPending,
+		Case:        req.Uuid, // Assuming the case information comes from the UUID
+		Description: "Waiting for the prosecution service",
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
 	user.Requests = append(user.Requests, rt)
-	err = h.repo.Update(user)
+	err = h.commitRequest(user, RequestCreated, rt)
 	if err != nil {
 		log.Printf("Failed to update user data: %v\n", err)
 		http.Error(w, "Couldn't add request", http.StatusInternalServerError)
 		return
 	}
+	h.record(r, user.Email, "request.create", "request/"+rt.ID, nil, rt)
 
-	// Return success response
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte("Request successfully processed"))
+	// Ask the prosecution service for the case status
+	err = h.prosecution.SubmitCaseStatus(prosecution.WithCallerToken(r.Context(), r.Header.Get("jwt")), req.Uuid, rt.ID)
+	if err != nil {
+		log.Printf("Prosecution service call failed: %v\n", err)
+		failed := rt
+		failed.Status = RequestFailed
+		failed.Description = "Prosecution service unavailable"
+		if err := h.updateRequest(user.Email, failed, RequestPending); err != nil {
+			log.Printf("Failed to update user data: %v\n", err)
+		}
+		http.Error(w, "Error in external service communication", prosecutionErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	RenderJSON(w, rt)
 }
 func (h *Courthandler) GetRequest(w http.ResponseWriter, r *http.Request) {
 
@@ -322,12 +358,10 @@ func (h *Courthandler) GetRequest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	//res := ValidateJwt(r, h.repo)
-	//if res == nil {
-	//	err := errors.New("user doesnt exist")
-	//	http.Error(w, err.Error(), http.StatusForbidden)
-	//	return
-	//}
+	res := RequireRole(w, r, h.repo, RoleOperator, RoleJudge, RoleAdmin)
+	if res == nil {
+		return
+	}
 	respon, err := h.repo.GetRequest(rt.Uuid)
 	if err != nil {
 		log.Printf("Operation failed: %v\n", err)
@@ -338,56 +372,34 @@ func (h *Courthandler) GetRequest(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	h.record(r, res.Email, "request.read", "request/"+rt.Uuid, nil, nil)
 	RenderJSON(w, respon)
 	w.WriteHeader(http.StatusOK)
 }
 func (h *Courthandler) CheckIfPersonIsProsecuted(w http.ResponseWriter, r *http.Request) {
-	// Parse the incoming request body to get the email or UUID
-	var req struct {
-		Email string `json:"email"`
-	}
+	// Parse the incoming request body to get the email or national ID
+	var req personQuery
 	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil || req.Email == "" {
+	if err != nil || (req.Email == "" && req.NationalID == "") {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	// Prepare the request payload to send to the external /prosecution service
-	payload, err := json.Marshal(map[string]string{"email": req.Email})
+	status, err := h.cachedProsecutionStatus(r.Context(), req)
 	if err != nil {
-		http.Error(w, "Failed to prepare request", http.StatusInternalServerError)
-		return
-	}
-
-	// Define the external service URL (this is where you call the external API)
-	externalServiceUrl := "http://localhost:9199/prosecute"
-
-	// Create the POST request to the external service
-	externalReq, err := http.NewRequest("POST", externalServiceUrl, bytes.NewBuffer(payload))
-	if err != nil {
-		http.Error(w, "Failed to create request to external service", http.StatusInternalServerError)
-		return
-	}
-	externalReq.Header.Set("Content-Type", "application/json")
-
-	// Send the request to the external service
-	client := &http.Client{}
-	resp, err := client.Do(externalReq)
-	if err != nil {
-		http.Error(w, "Failed to communicate with external service", http.StatusInternalServerError)
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Failed to check prosecution status", http.StatusInternalServerError)
 		return
 	}
-	defer resp.Body.Close()
+	h.record(r, serviceauth.IdentityFrom(r.Context()).ClientID, "prosecution.check", personTarget(req), nil, nil)
+	RenderJSON(w, status)
+}
 
-	// Read the response from the external service
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "Failed to read response from external service", http.StatusInternalServerError)
-		return
+// prosecutionErrorStatus maps prosecution client errors to the status we
+// answer with: unavailable while the circuit is open, bad gateway otherwise.
+func prosecutionErrorStatus(err error) int {
+	if errors.Is(err, prosecution.ErrCircuitOpen) {
+		return http.StatusServiceUnavailable
 	}
-
-	// Forward the response back to the client
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(resp.StatusCode) // Use the same status code from the external service
-	w.Write(body)                  // Write the external response back to the client
+	return http.StatusBadGateway
 }
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/lookupcache"
+	"github.com/EupravaProjekat/court/serviceauth"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Verdict outcomes and the case statuses they lead to.
+const (
+	VerdictConvicted = "Convicted"
+	VerdictAcquitted = "Acquitted"
+	VerdictDismissed = "Dismissed"
+
+	CaseStatusOpen    = "Open"
+	CaseStatusDecided = "Decided"
+	CaseStatusClosed  = "Closed"
+
+	sourceCourt       = "court"
+	sourceProsecution = "prosecution-service"
+
+	// batchConcurrency bounds parallel lookups of one batch request
+	batchConcurrency = 8
+)
+
+var errExternalUnavailable = errors.New("prosecution service unavailable")
+
+// newProsecutionCache shares entries between replicas through Mongo when
+// cfg.SharedCache is set.
+func newProsecutionCache(r *Repo.Repo, cfg Config) *lookupcache.Cache {
+	var shared lookupcache.Backend
+	if cfg.SharedCache {
+		shared = r.CacheBackend()
+	}
+	return lookupcache.New(cfg.Cache, shared)
+}
+
+// personTags are the cache tags a lookup of q can be invalidated by.
+func personTags(email, nationalID string) []string {
+	var tags []string
+	if email != "" {
+		tags = append(tags, "email:"+email)
+	}
+	if nationalID != "" {
+		tags = append(tags, "nid:"+nationalID)
+	}
+	return tags
+}
+
+// personTarget names a looked up person in the audit log.
+func personTarget(q personQuery) string {
+	return "person/" + strings.Join(personTags(q.Email, q.NationalID), ",")
+}
+
+// invalidatePerson drops cached answers for a defendant after the court
+// records something about them.
+func (h *Courthandler) invalidatePerson(ctx context.Context, email, nationalID string) {
+	for _, tag := range personTags(email, nationalID) {
+		h.cache.Invalidate(ctx, tag)
+	}
+}
+
+// cachedProsecutionStatus serves prosecutionStatus through the cache. Only
+// answers that include the external service are cached; during an outage a
+// stale answer is preferred over a court-only one.
+func (h *Courthandler) cachedProsecutionStatus(ctx context.Context, q personQuery) (*Models.ProsecutionStatus, error) {
+	var partial *Models.ProsecutionStatus
+	key := "q:" + q.Email + "|" + q.NationalID
+	data, result, err := h.cache.Get(ctx, key, func(ctx context.Context) ([]byte, []string, error) {
+		status, err := h.prosecutionStatus(ctx, q)
+		if err != nil {
+			return nil, nil, err
+		}
+		if status.ExternalError != "" && q.Email != "" {
+			partial = status
+			return nil, nil, errExternalUnavailable
+		}
+		data, err := json.Marshal(status)
+		return data, personTags(q.Email, q.NationalID), err
+	})
+	if err != nil {
+		if partial != nil {
+			return partial, nil
+		}
+		return nil, err
+	}
+	var status Models.ProsecutionStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+	status.Stale = result == lookupcache.Stale
+	return &status, nil
+}
+
+func (h *Courthandler) GetProsecutionCacheMetrics(w http.ResponseWriter, r *http.Request) {
+	if RequireRole(w, r, h.repo, RoleAdmin) == nil {
+		return
+	}
+	metrics := struct {
+		lookupcache.Metrics
+		Breaker string `json:"breaker"`
+	}{h.cache.Metrics(), h.prosecution.BreakerState()}
+	RenderJSON(w, metrics)
+}
+
+type personQuery struct {
+	Email      string `json:"email"`
+	NationalID string `json:"national_id"`
+}
+
+// prosecutionStatus answers from the court's own criminal cases and merges
+// the external prosecution service's answer when it can be reached. The
+// court's answer stands on its own if the external call fails.
+func (h *Courthandler) prosecutionStatus(ctx context.Context, q personQuery) (*Models.ProsecutionStatus, error) {
+	cases, err := h.repo.FindCasesByDefendant(q.Email, q.NationalID)
+	if err != nil {
+		return nil, err
+	}
+	status := &Models.ProsecutionStatus{Sources: []string{sourceCourt}}
+	for _, c := range cases {
+		if !strings.EqualFold(c.Type, "Criminal") {
+			continue
+		}
+		pc := Models.ProsecutionCase{ID: c.ID, Type: c.Type, Status: c.Status}
+		switch {
+		case c.Verdict == nil && c.Status != CaseStatusClosed:
+			status.Prosecuted = true
+		case c.Verdict != nil && c.Verdict.Outcome == VerdictConvicted:
+			status.Convicted = true
+			pc.Verdict = c.Verdict.Outcome
+		default:
+			continue
+		}
+		status.Cases = append(status.Cases, pc)
+	}
+
+	// The prosecution service only knows people by email
+	if q.Email != "" {
+		ext, err := h.prosecution.CheckPerson(ctx, q.Email)
+		if err != nil {
+			log.Printf("Prosecution service call failed: %v\n", err)
+			status.ExternalError = err.Error()
+		} else {
+			status.Sources = append(status.Sources, sourceProsecution)
+			status.Prosecuted = status.Prosecuted || ext.Prosecuted
+		}
+	}
+	return status, nil
+}
+
+// CheckIfPeopleAreProsecuted checks many people at once. Duplicates are
+// checked once, lookups run in parallel, and a failure for one person is
+// reported in its result without failing the batch.
+func (h *Courthandler) CheckIfPeopleAreProsecuted(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		People []personQuery `json:"people"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.People) == 0 {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Deduplicate while keeping the order of first appearance
+	seen := make(map[personQuery]bool)
+	var people []personQuery
+	for _, p := range req.People {
+		p.Email = strings.TrimSpace(p.Email)
+		p.NationalID = strings.TrimSpace(p.NationalID)
+		if p.Email == "" && p.NationalID == "" {
+			http.Error(w, "every person needs an email or national_id", http.StatusBadRequest)
+			return
+		}
+		if !seen[p] {
+			seen[p] = true
+			people = append(people, p)
+		}
+	}
+	if len(people) > h.cfg.MaxBatchSize {
+		http.Error(w, "too many people in one batch, max "+strconv.Itoa(h.cfg.MaxBatchSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := make([]Models.ProsecutionCheckResult, len(people))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, p := range people {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p personQuery) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			status, err := h.cachedProsecutionStatus(r.Context(), p)
+			results[i] = checkResult(p, status, err)
+		}(i, p)
+	}
+	wg.Wait()
+
+	client := serviceauth.IdentityFrom(r.Context()).ClientID
+	for _, p := range people {
+		h.record(r, client, "prosecution.check", personTarget(p), nil, nil)
+	}
+
+	response := Models.ProsecutionBatchResponse{Results: results}
+	for _, res := range results {
+		switch {
+		case res.Error != "":
+			response.Failed++
+		case res.Incomplete:
+			response.Checked++
+			response.Incomplete++
+		default:
+			response.Checked++
+		}
+	}
+	RenderJSON(w, response)
+}
+
+// checkResult reports one person's batch check. A person the prosecution
+// service couldn't be reached about counts as failed, since the court's
+// own answer alone would read as a clean record. One it can't be asked
+// about at all, having no email, gets the court's answer marked
+// incomplete.
+func checkResult(p personQuery, status *Models.ProsecutionStatus, err error) Models.ProsecutionCheckResult {
+	res := Models.ProsecutionCheckResult{Email: p.Email, NationalID: p.NationalID}
+	switch {
+	case err != nil:
+		res.Error = err.Error()
+	case status.ExternalError != "":
+		res.Error = errExternalUnavailable.Error() + ": " + status.ExternalError
+	default:
+		res.Status = status
+		res.Incomplete = p.Email == ""
+	}
+	return res
+}
+func (h *Courthandler) IssueVerdict(w http.ResponseWriter, r *http.Request) {
+	user := RequireRole(w, r, h.repo, RoleJudge, RoleOperator, RoleAdmin)
+	if user == nil {
+		return
+	}
+	var verdict Models.Verdict
+	err := json.NewDecoder(r.Body).Decode(&verdict)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	switch verdict.Outcome {
+	case VerdictConvicted, VerdictAcquitted, VerdictDismissed:
+	default:
+		http.Error(w, "outcome must be Convicted, Acquitted or Dismissed", http.StatusBadRequest)
+		return
+	}
+	verdict.Signature = nil
+	verdict.Date = time.Now().Format(time.RFC3339)
+	if verdict.Judge == "" {
+		verdict.Judge = user.Email
+	}
+	caseID := mux.Vars(r)["id"]
+	c, err := h.repo.GetCase(caseID)
+	if err != nil {
+		http.Error(w, "Case not found", http.StatusNotFound)
+		return
+	}
+	if c.Verdict != nil {
+		http.Error(w, "Case already has a verdict", http.StatusConflict)
+		return
+	}
+	verdict.CaseID = caseID
+	verdict.Signature, err = h.sign(verdict)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Failed to sign the verdict", http.StatusInternalServerError)
+		return
+	}
+	decided, herr := h.commitCaseEvents(user.Email, c,
+		&caseevents.Event{Type: caseevents.VerdictIssued, Verdict: &verdict},
+		&caseevents.Event{Type: caseevents.StatusChanged, Status: CaseStatusDecided},
+	)
+	if herr != nil {
+		http.Error(w, herr.message, herr.status)
+		return
+	}
+	h.invalidatePerson(r.Context(), c.DefendantEmail, c.DefendantNationalID)
+	h.record(r, user.Email, "case."+caseevents.VerdictIssued, "case/"+caseID, c, decided)
+	RenderJSON(w, verdict)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/audit"
+	"github.com/EupravaProjekat/court/prosecution"
+	"github.com/EupravaProjekat/court/serviceauth"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Statuses of a case status request answered by the prosecution service.
+const (
+	RequestPending  = "pending"
+	RequestResolved = "resolved"
+	RequestFailed   = "failed"
+	RequestTimedOut = "timed_out"
+)
+
+// ProsecutionCallback takes the prosecution service's answer to a pending
+// request. A late answer still replaces a timed out or failed request.
+func (h *Courthandler) ProsecutionCallback(w http.ResponseWriter, r *http.Request) {
+	var answer prosecution.Callback
+	err := json.NewDecoder(r.Body).Decode(&answer)
+	if err != nil || answer.RequestID == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	user, err := h.repo.GetUserByRequestID(answer.RequestID)
+	if err != nil {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+	var current Models.Request
+	for _, request := range user.Requests {
+		if request.ID == answer.RequestID {
+			current = request
+		}
+	}
+	updated, herr := answerRequest(current, answer)
+	if herr != nil {
+		http.Error(w, herr.message, herr.status)
+		return
+	}
+	err = h.updateRequest(user.Email, updated, RequestPending, RequestTimedOut, RequestFailed)
+	if err != nil {
+		if Repo.IsNotFound(err) {
+			http.Error(w, "Request already answered", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to update user data: %v\n", err)
+		http.Error(w, "Couldn't update request", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, serviceauth.IdentityFrom(r.Context()).ClientID, "request.answer", "request/"+updated.ID, current, updated)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// answerRequest applies the prosecution service's answer to the request it
+// is about.
+func answerRequest(current Models.Request, answer prosecution.Callback) (Models.Request, *httpError) {
+	if current.Case != answer.CaseID {
+		return current, &httpError{http.StatusBadRequest, "case_id doesn't match the request"}
+	}
+	if current.Status == RequestResolved {
+		return current, &httpError{http.StatusConflict, "Request already answered"}
+	}
+	updated := current
+	if answer.Error != "" {
+		updated.Status = RequestFailed
+		updated.Description = "Prosecution service couldn't answer: " + answer.Error
+	} else {
+		updated.Status = RequestResolved
+		updated.Description = "Case status: " + strconv.FormatBool(answer.CaseStatus)
+	}
+	return updated, nil
+}
+
+// RunRequestTimeouts times out pending requests the prosecution service
+// never answered, until ctx is cancelled.
+func (h *Courthandler) RunRequestTimeouts(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		h.expireRequests(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireBatch is how many stale requests expireRequests reads at a time.
+const expireBatch = 100
+
+// staleRequests finds requests for expireStale.
+type staleRequests interface {
+	GetStaleRequests(status, before string, skip []string, limit int64) ([]*Models.UserRequest, error)
+}
+
+// expireRequests times out every stale pending request.
+func (h *Courthandler) expireRequests(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-h.cfg.AnswerTimeout).Format(time.RFC3339)
+	expireStale(ctx, h.repo, cutoff, func(s *Models.UserRequest) error {
+		request := s.Request
+		expired := request
+		expired.Status = RequestTimedOut
+		expired.Description = "Prosecution service didn't answer in time"
+		if err := h.updateRequest(s.Email, expired, RequestPending); err != nil {
+			return err
+		}
+		err := h.audit.Record(ctx, audit.Event{
+			Actor:  "system",
+			Action: "request.timeout",
+			Target: "request/" + request.ID,
+			Before: request,
+			After:  expired,
+		})
+		if err != nil {
+			log.Printf("Audit of request.timeout on %v failed: %v\n", request.ID, err)
+		}
+		return nil
+	})
+}
+
+// expireStale passes every pending request created before cutoff to
+// expire, oldest first, expireBatch at a time. A request expire fails on
+// is skipped for the rest of the run, so it can't hold back the others,
+// and retried on the next one; one that was answered meanwhile is simply
+// passed over.
+func expireStale(ctx context.Context, store staleRequests, cutoff string, expire func(*Models.UserRequest) error) {
+	failed := []string{}
+	for ctx.Err() == nil {
+		stale, err := store.GetStaleRequests(RequestPending, cutoff, failed, expireBatch)
+		if err != nil {
+			log.Printf("Operation Failed: %v\n", err)
+			return
+		}
+		for _, s := range stale {
+			err := expire(s)
+			if err != nil && !Repo.IsNotFound(err) {
+				log.Printf("Couldn't time out request %v: %v\n", s.Request.ID, err)
+				failed = append(failed, s.Request.ID)
+			}
+		}
+		if len(stale) < expireBatch {
+			return
+		}
+	}
+}
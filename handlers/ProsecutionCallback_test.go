@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/prosecution"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAnswerRequest(t *testing.T) {
+	request := func(status string) Models.Request {
+		return Models.Request{ID: "r1", Case: "c1", Status: status}
+	}
+	tests := []struct {
+		name       string
+		current    Models.Request
+		answer     prosecution.Callback
+		wantStatus string
+		wantHTTP   int
+	}{
+		{"answer", request(RequestPending), prosecution.Callback{RequestID: "r1", CaseID: "c1", CaseStatus: true}, RequestResolved, 0},
+		{"service error", request(RequestPending), prosecution.Callback{RequestID: "r1", CaseID: "c1", Error: "no such case"}, RequestFailed, 0},
+		{"late answer", request(RequestTimedOut), prosecution.Callback{RequestID: "r1", CaseID: "c1"}, RequestResolved, 0},
+		{"answer after a failure", request(RequestFailed), prosecution.Callback{RequestID: "r1", CaseID: "c1"}, RequestResolved, 0},
+		{"already answered", request(RequestResolved), prosecution.Callback{RequestID: "r1", CaseID: "c1"}, "", http.StatusConflict},
+		{"other case", request(RequestPending), prosecution.Callback{RequestID: "r1", CaseID: "c2"}, "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		updated, herr := answerRequest(tt.current, tt.answer)
+		if tt.wantHTTP != 0 {
+			if herr == nil || herr.status != tt.wantHTTP {
+				t.Errorf("%s: got %+v, %v, want HTTP %d", tt.name, updated, herr, tt.wantHTTP)
+			}
+			continue
+		}
+		if herr != nil || updated.Status != tt.wantStatus || updated.ID != "r1" || updated.Description == "" {
+			t.Errorf("%s: got %+v, %v, want status %s", tt.name, updated, herr, tt.wantStatus)
+		}
+	}
+}
+
+// memRequests hands out stale requests the way GetStaleRequests does.
+type memRequests struct {
+	pending map[string]*Models.UserRequest
+	reads   int
+}
+
+func (m *memRequests) GetStaleRequests(status, before string, skip []string, limit int64) ([]*Models.UserRequest, error) {
+	m.reads++
+	skipped := map[string]bool{}
+	for _, id := range skip {
+		skipped[id] = true
+	}
+	var stale []*Models.UserRequest
+	for _, r := range m.pending {
+		if r.Request.Status == status && r.Request.CreatedAt < before && !skipped[r.Request.ID] {
+			stale = append(stale, r)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Request.CreatedAt < stale[j].Request.CreatedAt })
+	if int64(len(stale)) > limit {
+		stale = stale[:limit]
+	}
+	return stale, nil
+}
+
+func TestExpireStaleSkipsFailures(t *testing.T) {
+	store := &memRequests{pending: map[string]*Models.UserRequest{}}
+	// More than two batches, with a broken request in the first and one
+	// that isn't stale yet
+	for i := 0; i < 2*expireBatch+50; i++ {
+		id := fmt.Sprintf("r%03d", i)
+		store.pending[id] = &Models.UserRequest{Email: "ana@mail.rs",
+			Request: Models.Request{ID: id, Status: RequestPending, CreatedAt: fmt.Sprintf("2024-03-01T09:%02d:%02dZ", i/60, i%60)}}
+	}
+	store.pending["fresh"] = &Models.UserRequest{Request: Models.Request{ID: "fresh", Status: RequestPending, CreatedAt: "2024-03-02T09:00:00Z"}}
+
+	var order []string
+	attempts := map[string]int{}
+	expireStale(context.Background(), store, "2024-03-01T10:00:00Z", func(s *Models.UserRequest) error {
+		id := s.Request.ID
+		attempts[id]++
+		switch id {
+		case "r007", "r150":
+			return errors.New("write conflict")
+		case "r010":
+			// Answered meanwhile
+			s.Request.Status = RequestResolved
+			return mongo.ErrNoDocuments
+		}
+		s.Request.Status = RequestTimedOut
+		order = append(order, id)
+		return nil
+	})
+
+	if len(order) != 2*expireBatch+50-3 {
+		t.Fatalf("expired %d requests, want %d", len(order), 2*expireBatch+50-3)
+	}
+	if !sort.StringsAreSorted(order) {
+		t.Error("requests weren't expired oldest first")
+	}
+	for id, n := range attempts {
+		if n != 1 {
+			t.Errorf("%s tried %d times in one run", id, n)
+		}
+	}
+	if attempts["fresh"] != 0 {
+		t.Error("a request that isn't stale yet was expired")
+	}
+	if store.reads > 4 {
+		t.Errorf("read %d batches for %d requests", store.reads, 2*expireBatch+50)
+	}
+	if store.pending["r007"].Request.Status != RequestPending {
+		t.Error("a failed request changed status")
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/EupravaProjekat/court/Models"
+)
+
+func TestCheckResult(t *testing.T) {
+	both := &Models.ProsecutionStatus{Sources: []string{sourceCourt, sourceProsecution}}
+	courtOnly := &Models.ProsecutionStatus{Sources: []string{sourceCourt}}
+	unreachable := &Models.ProsecutionStatus{Sources: []string{sourceCourt}, ExternalError: "circuit open"}
+	tests := []struct {
+		name           string
+		person         personQuery
+		status         *Models.ProsecutionStatus
+		err            error
+		wantError      string
+		wantIncomplete bool
+	}{
+		{"checked everywhere", personQuery{Email: "ana@mail.rs"}, both, nil, "", false},
+		{"national ID only", personQuery{NationalID: "0101990710001"}, courtOnly, nil, "", true},
+		{"prosecution service down", personQuery{Email: "ana@mail.rs"}, unreachable, nil, errExternalUnavailable.Error(), false},
+		{"court lookup failed", personQuery{NationalID: "0101990710001"}, nil, errors.New("mongo down"), "mongo down", false},
+	}
+	for _, tt := range tests {
+		res := checkResult(tt.person, tt.status, tt.err)
+		if tt.wantError != "" {
+			if !strings.HasPrefix(res.Error, tt.wantError) || res.Status != nil {
+				t.Errorf("%s: got error %q, status %v, want error %q", tt.name, res.Error, res.Status, tt.wantError)
+			}
+			continue
+		}
+		if res.Error != "" || res.Status != tt.status || res.Incomplete != tt.wantIncomplete {
+			t.Errorf("%s: got %+v, want status with incomplete=%v", tt.name, res, tt.wantIncomplete)
+		}
+	}
+}
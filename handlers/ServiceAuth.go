@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/serviceauth"
+	"github.com/EupravaProjekat/court/tlsreload"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"time"
+)
+
+// RequireService lets a request through only when it comes from a
+// registered, non-revoked service client holding the given scope. The client
+// is identified by a verified mTLS certificate or, failing that, by an HMAC
+// request signature.
+func (h *Courthandler) RequireService(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subject := tlsreload.PeerSubject(r.TLS); subject != "" {
+			client, err := h.repo.GetServiceClientByCertSubject(subject)
+			if err == nil && !client.Revoked {
+				h.serveAsService(w, r, client, scope, next)
+				return
+			}
+		}
+		clientID := r.Header.Get(serviceauth.HeaderClientID)
+		if clientID == "" {
+			http.Error(w, serviceauth.ErrMissingHeaders.Error(), http.StatusUnauthorized)
+			return
+		}
+		client, err := h.repo.GetServiceClient(clientID)
+		if err != nil || client.Revoked {
+			http.Error(w, "unknown service client", http.StatusUnauthorized)
+			return
+		}
+		body, err := serviceauth.ReadBody(r)
+		if errors.Is(err, serviceauth.ErrBodyTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		if err := serviceauth.Verify(r, client.Secret, body, now); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err := serviceauth.CheckReplay(r.Context(), h.replay, r.Header.Get(serviceauth.HeaderSignature), now); err != nil {
+			if !errors.Is(err, serviceauth.ErrReplayed) {
+				log.Printf("Operation Failed: %v\n", err)
+				http.Error(w, "Couldn't check the request signature", http.StatusServiceUnavailable)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		h.serveAsService(w, r, client, scope, next)
+	}
+}
+
+func (h *Courthandler) serveAsService(w http.ResponseWriter, r *http.Request, client *Models.ServiceClient, scope string, next http.HandlerFunc) {
+	id := &serviceauth.Identity{ClientID: client.ClientID, Name: client.Name, Scopes: client.Scopes}
+	if !id.HasScope(scope) {
+		http.Error(w, "scope error", http.StatusForbidden)
+		return
+	}
+	next(w, r.WithContext(serviceauth.WithIdentity(r.Context(), id)))
+}
+
+func (h *Courthandler) IssueServiceClient(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	var req struct {
+		Name        string   `json:"name"`
+		Scopes      []string `json:"scopes"`
+		CertSubject string   `json:"cert_subject"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Name == "" || len(req.Scopes) == 0 {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	secret, err := serviceauth.NewSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	client := Models.ServiceClient{
+		ClientID:    uuid.New().String(),
+		Name:        req.Name,
+		Secret:      secret,
+		Scopes:      req.Scopes,
+		CertSubject: req.CertSubject,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	err = h.repo.NewServiceClient(&client)
+	if Repo.IsDuplicate(err) {
+		http.Error(w, "Another service client already uses that certificate subject", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Couldn't register service client", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, admin.Email, "service_client.issue", "service_client/"+client.ClientID, nil, client)
+	// The secret is shown only here; later reads never return it.
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, Models.IssuedServiceClient{ServiceClient: client, Secret: secret})
+}
+func (h *Courthandler) GetAllServiceClients(w http.ResponseWriter, r *http.Request) {
+	if RequireRole(w, r, h.repo, RoleAdmin) == nil {
+		return
+	}
+	response, err := h.repo.GetAllServiceClients()
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Service clients not found", http.StatusNotFound)
+		return
+	}
+	RenderJSON(w, response)
+}
+func (h *Courthandler) RevokeServiceClient(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	clientID := mux.Vars(r)["id"]
+	err := h.repo.RevokeServiceClient(clientID)
+	if err != nil {
+		if Repo.IsNotFound(err) {
+			http.Error(w, "Service client not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Couldn't revoke service client", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, admin.Email, "service_client.revoke", "service_client/"+clientID, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// refreshTokenTTL bounds how long a session can be kept alive by refreshing.
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+// newRefreshToken returns a "<session id>.<random>" token and the hash that
+// is stored in place of it.
+func newRefreshToken(sid string) (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	return sid + "." + secret, hashRefreshSecret(secret), nil
+}
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionStore is the part of the repo sessions are kept in.
+type sessionStore interface {
+	ConsumeToken(jti string, expiresAt time.Time) (bool, error)
+	GetSession(id string) (*Models.Session, error)
+	RotateSession(id, oldHash, newHash, jti string, accessExp time.Time) (bool, error)
+	RevokeSession(id string) ([]*Models.Session, error)
+	RevokeToken(jti string, expiresAt time.Time) error
+}
+
+var (
+	errSessionToken     = errors.New("token already belongs to a session")
+	errTokenExchanged   = errors.New("token was already exchanged")
+	errNoExpiry         = errors.New("token has no expiry")
+	errInvalidRefresh   = errors.New("invalid refresh token")
+	errRefreshTokenUsed = errors.New("refresh token was already used")
+)
+
+// loginTokenKey names a login token on the denylist: by its jti or, for
+// tokens issued without one, by a hash of the whole token.
+func loginTokenKey(claims jwt.MapClaims, token string) string {
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		return jti
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// exchangeLoginToken uses up a login token so it starts one session at
+// most, even when the same token is presented concurrently.
+func exchangeLoginToken(store sessionStore, claims jwt.MapClaims, token string) error {
+	if _, ok := claims["sid"]; ok {
+		return errSessionToken
+	}
+	exp, ok := claimsExpiry(claims)
+	if !ok {
+		return errNoExpiry
+	}
+	consumed, err := store.ConsumeToken(loginTokenKey(claims, token), exp)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return errTokenExchanged
+	}
+	return nil
+}
+
+// NewSession exchanges the access jwt issued at login for a session with a
+// refresh token. The login token is used up by the exchange, and tokens
+// issued by a session can't start another one, so a stolen access token
+// can't be stretched into a session of its own.
+func (h *Courthandler) NewSession(w http.ResponseWriter, r *http.Request) {
+	claims := ParseJwtClaims(r, h.repo)
+	if claims == nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	res, err := h.repo.GetByEmail(claims["email"].(string))
+	if err != nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	err = exchangeLoginToken(h.repo, claims, r.Header.Get("jwt"))
+	switch {
+	case errors.Is(err, errSessionToken), errors.Is(err, errTokenExchanged), errors.Is(err, errNoExpiry):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	sid := uuid.New().String()
+	refresh, refreshHash, err := newRefreshToken(sid)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	access, jti, accessExp := GenerateSessionJwt(res.Email, res.Role, sid)
+	session := Models.Session{
+		ID:          sid,
+		Email:       res.Email,
+		Role:        res.Role,
+		RefreshHash: refreshHash,
+		AccessJti:   jti,
+		AccessExp:   accessExp,
+		ExpiresAt:   time.Now().UTC().Add(refreshTokenTTL),
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	err = h.repo.NewSession(&session)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, res.Email, "session.create", "session/"+sid, nil, nil)
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, Models.TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int64(accessTokenTTL.Seconds())})
+}
+
+// rotateRefreshToken trades a refresh token for a new token pair. Each
+// refresh token works once: presenting one that was already rotated
+// revokes the whole session, along with its current access token, and
+// returns errRefreshTokenUsed with the session.
+func rotateRefreshToken(store sessionStore, token string) (*Models.Session, *Models.TokenPair, error) {
+	sid, secret, ok := strings.Cut(token, ".")
+	if !ok || sid == "" || secret == "" {
+		return nil, nil, errInvalidRefresh
+	}
+	session, err := store.GetSession(sid)
+	if err != nil || session.Revoked || time.Now().UTC().After(session.ExpiresAt) {
+		return nil, nil, errInvalidRefresh
+	}
+	presented := hashRefreshSecret(secret)
+	if presented != session.RefreshHash {
+		// An already rotated token is being replayed; assume it was stolen
+		// and end the whole session.
+		sessions, err := store.RevokeSession(sid)
+		revokeSessions(store, sessions, err)
+		return session, nil, errRefreshTokenUsed
+	}
+	refresh, refreshHash, err := newRefreshToken(sid)
+	if err != nil {
+		return nil, nil, err
+	}
+	access, jti, accessExp := GenerateSessionJwt(session.Email, session.Role, sid)
+	rotated, err := store.RotateSession(sid, presented, refreshHash, jti, accessExp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !rotated {
+		// Lost a race with another refresh using the same token
+		return nil, nil, errInvalidRefresh
+	}
+	return session, &Models.TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int64(accessTokenTTL.Seconds())}, nil
+}
+func (h *Courthandler) RefreshSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	session, pair, err := rotateRefreshToken(h.repo, req.RefreshToken)
+	switch {
+	case errors.Is(err, errRefreshTokenUsed):
+		h.record(r, session.Email, "session.reuse_revoked", "session/"+session.ID, nil, nil)
+		http.Error(w, errInvalidRefresh.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, errInvalidRefresh):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, session.Email, "session.refresh", "session/"+session.ID, nil, nil)
+	RenderJSON(w, pair)
+}
+
+// Logout ends the token's session, or denylists the token itself when it
+// was issued outside a session. A token with neither can't be revoked, so
+// logging it out is refused rather than reported as done.
+func (h *Courthandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims := ParseJwtClaims(r, h.repo)
+	if claims == nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	sid, inSession := claims["sid"].(string)
+	jti, hasJti := claims["jti"].(string)
+	if !inSession && !hasJti {
+		http.Error(w, "Token has no session or id to revoke", http.StatusBadRequest)
+		return
+	}
+	if inSession {
+		sessions, err := h.repo.RevokeSession(sid)
+		if !revokeSessions(h.repo, sessions, err) {
+			http.Error(w, "Couldn't revoke session", http.StatusInternalServerError)
+			return
+		}
+	}
+	if hasJti {
+		exp, ok := claimsExpiry(claims)
+		if !ok {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		if err := h.repo.RevokeToken(jti, exp); err != nil {
+			http.Error(w, "Couldn't revoke token", http.StatusInternalServerError)
+			return
+		}
+	}
+	email, _ := claims["email"].(string)
+	h.record(r, email, "session.logout", "user/"+email, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+func (h *Courthandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	email := mux.Vars(r)["email"]
+	sessions, err := h.repo.RevokeSessionsByEmail(email)
+	if !revokeSessions(h.repo, sessions, err) {
+		http.Error(w, "Couldn't revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, admin.Email, "session.revoke_all", "user/"+email, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSessions denylists the last access token of each revoked session.
+func revokeSessions(store sessionStore, sessions []*Models.Session, err error) bool {
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		return false
+	}
+	ok := true
+	for _, s := range sessions {
+		if s.AccessJti == "" {
+			continue
+		}
+		if err := store.RevokeToken(s.AccessJti, s.AccessExp); err != nil {
+			ok = false
+		}
+	}
+	return ok
+}
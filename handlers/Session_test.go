@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// memSessions keeps sessions and the denylist in memory.
+type memSessions struct {
+	mu       sync.Mutex
+	sessions map[string]*Models.Session
+	revoked  map[string]time.Time
+}
+
+func newMemSessions() *memSessions {
+	return &memSessions{sessions: map[string]*Models.Session{}, revoked: map[string]time.Time{}}
+}
+func (m *memSessions) ConsumeToken(jti string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.revoked[jti]; ok {
+		return false, nil
+	}
+	m.revoked[jti] = expiresAt
+	return true, nil
+}
+func (m *memSessions) GetSession(id string) (*Models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, errors.New("no such session")
+	}
+	copied := *s
+	return &copied, nil
+}
+func (m *memSessions) RotateSession(id, oldHash, newHash, jti string, accessExp time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || s.Revoked || s.RefreshHash != oldHash {
+		return false, nil
+	}
+	s.RefreshHash, s.AccessJti, s.AccessExp = newHash, jti, accessExp
+	return true, nil
+}
+func (m *memSessions) RevokeSession(id string) ([]*Models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || s.Revoked {
+		return nil, nil
+	}
+	s.Revoked = true
+	copied := *s
+	return []*Models.Session{&copied}, nil
+}
+func (m *memSessions) RevokeToken(jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoked[jti] = expiresAt
+	return nil
+}
+func (m *memSessions) isRevoked(jti string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.revoked[jti]
+	return ok
+}
+
+// signToken signs claims the way the login service does.
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(sampleSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestExchangeLoginTokenOnce(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	// Login tokens carry no jti; they differ only in who and when
+	ana := signToken(t, jwt.MapClaims{"email": "ana@mail.rs", "role": RoleGuest, "exp": exp})
+	marko := signToken(t, jwt.MapClaims{"email": "marko@mail.rs", "role": RoleGuest, "exp": exp})
+	withJti := signToken(t, jwt.MapClaims{"email": "ana@mail.rs", "role": RoleGuest, "exp": exp, "jti": "j1"})
+	inSession, _, _ := GenerateSessionJwt("ana@mail.rs", RoleGuest, "s1")
+	noExpiry := signToken(t, jwt.MapClaims{"email": "ana@mail.rs", "role": RoleGuest})
+
+	store := newMemSessions()
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"login token", ana, nil},
+		{"same login token again", ana, errTokenExchanged},
+		{"another user's login token", marko, nil},
+		{"token with a jti", withJti, nil},
+		{"token with a jti again", withJti, errTokenExchanged},
+		{"session token", inSession, errSessionToken},
+		{"token without expiry", noExpiry, errNoExpiry},
+	}
+	for _, tt := range tests {
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(tt.token, claims); err != nil {
+			t.Fatal(err)
+		}
+		if err := exchangeLoginToken(store, claims, tt.token); !errors.Is(err, tt.want) {
+			t.Errorf("%s: exchangeLoginToken() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	// A login token with a jti is dead once exchanged
+	if !store.isRevoked("j1") {
+		t.Error("exchanged jti wasn't denylisted")
+	}
+}
+
+func TestRefreshTokenReuseEndsSession(t *testing.T) {
+	store := newMemSessions()
+	first, hash, err := newRefreshToken("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.sessions["s1"] = &Models.Session{ID: "s1", Email: "ana@mail.rs", Role: RoleGuest,
+		RefreshHash: hash, ExpiresAt: time.Now().Add(time.Hour)}
+
+	_, pair, err := rotateRefreshToken(store, first)
+	if err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	if claims := parseJwt(pair.AccessToken, store.isRevoked); claims == nil || claims["sid"] != "s1" {
+		t.Fatalf("refreshed access token claims = %v", claims)
+	}
+
+	// The rotated-out token comes back: someone else holds a copy
+	session, _, err := rotateRefreshToken(store, first)
+	if !errors.Is(err, errRefreshTokenUsed) || session == nil || session.ID != "s1" {
+		t.Fatalf("reused refresh = %v, %v, want errRefreshTokenUsed", session, err)
+	}
+	if !store.sessions["s1"].Revoked {
+		t.Error("session survived refresh token reuse")
+	}
+	if parseJwt(pair.AccessToken, store.isRevoked) != nil {
+		t.Error("session's access token survived refresh token reuse")
+	}
+	if _, _, err := rotateRefreshToken(store, pair.RefreshToken); !errors.Is(err, errInvalidRefresh) {
+		t.Errorf("refresh after reuse = %v, want errInvalidRefresh", err)
+	}
+
+	for _, token := range []string{"", "s1", "s1.", ".secret", "nosuch.secret"} {
+		if _, _, err := rotateRefreshToken(store, token); !errors.Is(err, errInvalidRefresh) {
+			t.Errorf("rotateRefreshToken(%q) = %v, want errInvalidRefresh", token, err)
+		}
+	}
+}
+
+func TestParseJwtRejectsRevokedJti(t *testing.T) {
+	store := newMemSessions()
+	access, jti, exp := GenerateSessionJwt("ana@mail.rs", RoleGuest, "s1")
+	if parseJwt(access, store.isRevoked) == nil {
+		t.Fatal("valid token rejected")
+	}
+	if err := store.RevokeToken(jti, exp); err != nil {
+		t.Fatal(err)
+	}
+	if parseJwt(access, store.isRevoked) != nil {
+		t.Error("revoked token accepted")
+	}
+
+	expired := signToken(t, jwt.MapClaims{"email": "ana@mail.rs", "exp": time.Now().Add(-time.Minute).Unix()})
+	noEmail := signToken(t, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"email": "ana@mail.rs",
+		"exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte("not the court's key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"expired": expired, "without email": noEmail, "forged": forged} {
+		if parseJwt(token, store.isRevoked) != nil {
+			t.Errorf("%s token accepted", name)
+		}
+	}
+}
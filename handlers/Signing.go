@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/docsign"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// docSigner holds the private keys found in the key directory.
+type docSigner struct {
+	dir  string
+	mu   sync.Mutex
+	keys map[string]*docsign.Key
+}
+
+var errNoSigningKey = errors.New("no signing key; create one with the generate-signing-key command")
+
+// key returns the private key with the ID, rereading the directory for
+// keys added since it was last read.
+func (s *docSigner) key(keyID string) (*docsign.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.keys[keyID]; ok {
+		return key, nil
+	}
+	keys, err := docsign.LoadKeyDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	s.keys = keys
+	if key, ok := keys[keyID]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("signing key %v is not in %v", keyID, s.dir)
+}
+
+// newest returns the most recently created key in the directory.
+func (s *docSigner) newest() (*docsign.Key, error) {
+	keys, err := docsign.LoadKeyDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var newest *docsign.Key
+	for _, key := range keys {
+		if newest == nil || key.CreatedAt > newest.CreatedAt {
+			newest = key
+		}
+	}
+	if newest == nil {
+		return nil, errNoSigningKey
+	}
+	return newest, nil
+}
+
+// signingKey returns the active key. It is looked up on every signature so
+// a rotation on any replica takes effect at once; a court that has never
+// signed anything starts with the newest key in the directory.
+func (h *Courthandler) signingKey() (*docsign.Key, error) {
+	active, err := h.repo.GetActiveSigningKey()
+	if Repo.IsNotFound(err) {
+		key, err := h.signer.newest()
+		if err != nil {
+			return nil, err
+		}
+		if err := h.repo.RotateSigningKey(key.PublicKey); err != nil && !Repo.IsDuplicate(err) {
+			return nil, err
+		}
+		active, err = h.repo.GetActiveSigningKey()
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	key, err := h.signer.key(active.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.PublicKey.PublicKey != active.PublicKey {
+		return nil, fmt.Errorf("signing key file %v doesn't match the published key", active.KeyID)
+	}
+	return key, nil
+}
+
+// sign signs a document with the court's active key.
+func (h *Courthandler) sign(v interface{}) (*docsign.Signature, error) {
+	key, err := h.signingKey()
+	if err != nil {
+		return nil, err
+	}
+	return docsign.Sign(key, v)
+}
+
+// MigrateSigningKeys moves private keys earlier versions stored in the
+// database into the key directory, leaving only their public halves behind.
+func (h *Courthandler) MigrateSigningKeys() error {
+	keys, err := h.repo.GetStoredSigningPrivateKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err := docsign.WriteKeyFile(h.signer.dir, key)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		if err := h.repo.DeleteStoredSigningPrivateKey(key.KeyID); err != nil {
+			return err
+		}
+		log.Printf("Moved signing key %v to %v\n", key.KeyID, h.signer.dir)
+	}
+	return nil
+}
+
+// GetSigningKeys publishes all public keys, retired ones included, for
+// offline verification.
+func (h *Courthandler) GetSigningKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.repo.GetSigningPublicKeys()
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Signing keys not found", http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, keys)
+}
+
+// VerifyDocument checks a signed document exactly as it was issued.
+func (h *Courthandler) VerifyDocument(w http.ResponseWriter, r *http.Request) {
+	document, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	keys, err := h.repo.GetSigningPublicKeys()
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Signing keys not found", http.StatusInternalServerError)
+		return
+	}
+	response := struct {
+		Valid bool   `json:"valid"`
+		KeyID string `json:"key_id,omitempty"`
+		Error string `json:"error,omitempty"`
+	}{}
+	sig, err := docsign.VerifyDocument(keys, document)
+	if sig != nil {
+		response.KeyID = sig.KeyID
+	}
+	if err != nil {
+		response.Error = err.Error()
+	} else {
+		response.Valid = true
+	}
+	RenderJSON(w, response)
+}
+
+// RotateSigningKey makes a key from the key directory the active one. The
+// key is created beforehand with the generate-signing-key command, so its
+// private half never passes through the API.
+func (h *Courthandler) RotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	var req struct {
+		KeyID string `json:"key_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.KeyID == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	key, err := h.signer.key(req.KeyID)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Key not found in the key directory", http.StatusNotFound)
+		return
+	}
+	public := key.PublicKey
+	public.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	err = h.repo.RotateSigningKey(public)
+	if err != nil {
+		if Repo.IsDuplicate(err) {
+			http.Error(w, "Key was already used", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to rotate key", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, admin.Email, "signing_key.rotate", "signing_key/"+public.KeyID, nil, public)
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, public)
+}
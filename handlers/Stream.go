@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/outbox"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	heartbeatInterval    = 15 * time.Second // Keeps idle streams open through proxies
+	sessionCheckInterval = time.Minute      // How soon a stream notices a revoked session
+	streamTicketTTL      = 30 * time.Second
+)
+
+// citizenCaseEvents are the case changes streamed to parties; the rest
+// can carry other people's details and are for staff.
+var citizenCaseEvents = map[string]bool{
+	caseevents.CaseFiled:             true,
+	caseevents.CaseVerified:          true,
+	caseevents.HearingScheduled:      true,
+	caseevents.HearingStatusChanged:  true,
+	caseevents.HearingRescheduled:    true,
+	caseevents.DeadlineSet:           true,
+	caseevents.DeadlineStatusChanged: true,
+	caseevents.StatusChanged:         true,
+	caseevents.VerdictIssued:         true,
+}
+
+// partyEvents can change who is a party to a case, and so who may follow it.
+var partyEvents = map[string]bool{
+	caseevents.CaseFiled:    true,
+	caseevents.CaseVerified: true,
+	caseevents.PartyAdded:   true,
+}
+
+// committed wakes everything reading the outbox after a commit.
+func (h *Courthandler) committed() {
+	h.outbox.Notify()
+	h.stream.Notify()
+}
+
+// streamSession is who a stream was opened for, and until when.
+type streamSession struct {
+	user    *Models.User
+	jti     string
+	expires time.Time
+}
+
+// jwtSession authenticates the request's jwt header.
+func (h *Courthandler) jwtSession(r *http.Request) *streamSession {
+	claims := ParseJwtClaims(r, h.repo)
+	if claims == nil {
+		return nil
+	}
+	user, err := h.repo.GetByEmail(claims["email"].(string))
+	if err != nil {
+		return nil
+	}
+	jti, _ := claims["jti"].(string)
+	expires, _ := claimsExpiry(claims)
+	return &streamSession{user: user, jti: jti, expires: expires}
+}
+
+// streamAuth authenticates a stream by its jwt header or, from browsers,
+// by a ticket query parameter from IssueStreamTicket. Tokens never go in
+// the URL, where proxies and access logs would keep them.
+func (h *Courthandler) streamAuth(r *http.Request) *streamSession {
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
+		return h.jwtSession(r)
+	}
+	t, err := h.repo.TakeStreamTicket(hashStreamTicket(ticket))
+	if err != nil {
+		return nil
+	}
+	s := &streamSession{jti: t.Jti, expires: t.TokenExp}
+	if s.user, err = h.repo.GetByEmail(t.Email); err != nil {
+		return nil
+	}
+	if !h.sessionValid(s) {
+		return nil
+	}
+	return s
+}
+
+// sessionValid re-checks an open stream's session: its token hasn't
+// expired or been revoked, and its user still holds the same role.
+func (h *Courthandler) sessionValid(s *streamSession) bool {
+	if !time.Now().Before(s.expires) {
+		return false
+	}
+	if s.jti != "" && h.repo.IsTokenRevoked(s.jti) {
+		return false
+	}
+	u, err := h.repo.GetByEmail(s.user.Email)
+	return err == nil && u.Role == s.user.Role
+}
+
+func hashStreamTicket(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueStreamTicket trades the caller's jwt for a single-use ticket that
+// opens one event stream or board within seconds. The stream it opens
+// ends when the jwt would have expired.
+func (h *Courthandler) IssueStreamTicket(w http.ResponseWriter, r *http.Request) {
+	s := h.jwtSession(r)
+	if s == nil {
+		http.Error(w, "User doesn't exist", http.StatusForbidden)
+		return
+	}
+	ticket, err := randomCode(32)
+	if err != nil {
+		http.Error(w, "Failed to issue a ticket", http.StatusInternalServerError)
+		return
+	}
+	err = h.repo.NewStreamTicket(&Models.StreamTicket{
+		Hash:      hashStreamTicket(ticket),
+		Email:     s.user.Email,
+		Jti:       s.jti,
+		TokenExp:  s.expires,
+		ExpiresAt: time.Now().Add(streamTicketTTL),
+	})
+	if err != nil {
+		http.Error(w, "Failed to issue a ticket", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, struct {
+		Ticket    string `json:"ticket"`
+		ExpiresIn int64  `json:"expires_in"`
+	}{ticket, int64(streamTicketTTL / time.Second)})
+}
+
+// StreamEvents streams changes to the caller's requests and cases as
+// Server-Sent Events; staff get every change. Each event's id is its
+// outbox Seq, so a reconnecting client resumes with Last-Event-ID.
+// EventSource can't set headers, so browsers open the stream with a
+// ticket and need a fresh one for every reconnect. The stream ends with an
+// "expired" event when the session does.
+func (h *Courthandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	session := h.streamAuth(r)
+	if session == nil {
+		http.Error(w, "User doesn't exist", http.StatusForbidden)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var after int64
+	if lastID != "" {
+		var err error
+		if after, err = strconv.ParseInt(lastID, 10, 64); err != nil || after < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribe before replaying so nothing committed in between is lost
+	sub := h.stream.Subscribe()
+	defer h.stream.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	visible := h.streamFilter(session.user)
+	send := func(m *outbox.Message) error {
+		if m.Seq <= after {
+			return nil
+		}
+		after = m.Seq
+		if !visible(m) {
+			return nil
+		}
+		if err := writeStreamEvent(w, m); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	if lastID != "" {
+		if err := h.stream.Replay(r.Context(), after, send); err != nil {
+			log.Printf("Operation Failed: %v\n", err)
+			return
+		}
+	}
+
+	expired := func() {
+		_, _ = fmt.Fprint(w, "event: expired\ndata: {}\n\n")
+		flusher.Flush()
+	}
+	expiry := time.NewTimer(time.Until(session.expires))
+	defer expiry.Stop()
+	check := time.NewTicker(sessionCheckInterval)
+	defer check.Stop()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expiry.C:
+			expired()
+			return
+		case <-check.C:
+			if !h.sessionValid(session) {
+				expired()
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case m, ok := <-sub.C:
+			if !ok {
+				// Fell behind; the client reconnects and replays
+				return
+			}
+			if err := send(m); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamFilter decides which messages the user may see, remembering case
+// access until the case's parties change.
+func (h *Courthandler) streamFilter(u *Models.User) func(m *outbox.Message) bool {
+	if isStaff(u) {
+		return func(m *outbox.Message) bool { return true }
+	}
+	cases := map[string]bool{}
+	return func(m *outbox.Message) bool {
+		switch m.AggregateType {
+		case "request":
+			var payload struct {
+				Email string `json:"email"`
+			}
+			return json.Unmarshal(m.Payload, &payload) == nil && payload.Email == u.Email
+		case "case":
+			if partyEvents[m.Type] {
+				delete(cases, m.AggregateID)
+			}
+			if !citizenCaseEvents[m.Type] {
+				return false
+			}
+			allowed, ok := cases[m.AggregateID]
+			if !ok {
+				c, err := h.repo.GetCase(m.AggregateID)
+				allowed = err == nil && canAccessCase(u, c)
+				cases[m.AggregateID] = allowed
+			}
+			return allowed
+		}
+		return false
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, m *outbox.Message) error {
+	data, err := json.Marshal(struct {
+		Type          string          `json:"type"`
+		AggregateType string          `json:"aggregate_type"`
+		AggregateID   string          `json:"aggregate_id"`
+		OccurredAt    string          `json:"occurred_at"`
+		Payload       json.RawMessage `json:"payload"`
+	}{m.Type, m.AggregateType, m.AggregateID, m.OccurredAt, m.Payload})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", m.Seq, m.Type, data)
+	return err
+}
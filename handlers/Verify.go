@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	DocumentValid    = "valid"
+	DocumentExpired  = "expired"
+	DocumentRevoked  = "revoked"
+	DocumentNotFound = "not_found"
+)
+
+// shortCodeAlphabet leaves out characters that are easy to misread.
+const shortCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func newShortCode() (string, error) {
+	return randomCode(10)
+}
+
+// newCertificateNumber draws an unguessable certificate number, so
+// certificates can't be found by counting through them.
+func newCertificateNumber(now time.Time) (string, error) {
+	code, err := randomCode(12)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("UV-%d-%s-%s-%s", now.Year(), code[:4], code[4:8], code[8:]), nil
+}
+
+// randomCode draws n characters of shortCodeAlphabet; its 32 characters
+// divide 256, so every one is equally likely.
+func randomCode(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = shortCodeAlphabet[int(b[i])%len(shortCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// VerifyDocumentNumber is the public check of a certificate by its number.
+func (h *Courthandler) VerifyDocumentNumber(w http.ResponseWriter, r *http.Request) {
+	certificate, err := h.repo.GetCertificate(mux.Vars(r)["number"])
+	h.renderVerification(w, certificate, err)
+}
+
+// VerifyShortCode is the same check reached through the QR code link.
+func (h *Courthandler) VerifyShortCode(w http.ResponseWriter, r *http.Request) {
+	certificate, err := h.repo.GetCertificateByShortCode(mux.Vars(r)["code"])
+	h.renderVerification(w, certificate, err)
+}
+
+// renderVerification answers with the document's status and a summary that
+// leaves out who the holder is.
+func (h *Courthandler) renderVerification(w http.ResponseWriter, c *Models.Certificate, err error) {
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		RenderJSON(w, Models.DocumentVerification{Status: DocumentNotFound})
+		return
+	}
+	revocation, err := h.repo.GetRevocation(c.Number)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Failed to verify document", http.StatusInternalServerError)
+		return
+	}
+	response := Models.DocumentVerification{
+		Status:       DocumentValid,
+		Number:       c.Number,
+		Type:         c.Type,
+		IssuingCourt: c.IssuingCourt,
+		IssueDate:    c.IssueDate,
+		ValidUntil:   c.ValidUntil,
+		Result:       c.Result,
+	}
+	validUntil, err := time.Parse(time.RFC3339, c.ValidUntil)
+	switch {
+	case revocation != nil:
+		response.Status = DocumentRevoked
+		response.RevokedAt = revocation.RevokedAt
+		response.ReplacedBy = revocation.ReplacedBy
+	case err != nil || time.Now().After(validUntil):
+		response.Status = DocumentExpired
+	}
+	RenderJSON(w, response)
+}
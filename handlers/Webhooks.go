@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/outbox"
+	"github.com/EupravaProjekat/court/serviceauth"
+	"github.com/EupravaProjekat/court/webhooks"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Request events published alongside case events.
+const (
+	RequestCreated = "RequestCreated"
+	RequestUpdated = "RequestUpdated"
+)
+
+// commitRequest adds a request to the user's requests and announces it,
+// in one transaction.
+func (h *Courthandler) commitRequest(user *Models.User, eventType string, request Models.Request) error {
+	payload := struct {
+		Email   string         `json:"email"`
+		Request Models.Request `json:"request"`
+	}{user.Email, request}
+	m, err := h.outbox.NewMessage(eventType, "request", request.ID, payload)
+	if err != nil {
+		return err
+	}
+	err = h.repo.AddUserRequest(user.Uuid, request, []*outbox.Message{m})
+	if err != nil {
+		return err
+	}
+	h.committed()
+	return nil
+}
+
+// updateRequest replaces one of the user's requests if it is still in one
+// of the from statuses, and announces the change.
+func (h *Courthandler) updateRequest(email string, request Models.Request, from ...string) error {
+	payload := struct {
+		Email   string         `json:"email"`
+		Request Models.Request `json:"request"`
+	}{email, request}
+	m, err := h.outbox.NewMessage(RequestUpdated, "request", request.ID, payload)
+	if err != nil {
+		return err
+	}
+	err = h.repo.UpdateUserRequest(email, request, from, []*outbox.Message{m})
+	if err != nil {
+		return err
+	}
+	h.committed()
+	return nil
+}
+
+// partnerHearing is a hearing as partners see it, without its note.
+type partnerHearing struct {
+	ID        string `json:"id"`
+	Date      string `json:"date,omitempty"`
+	Courtroom string `json:"courtroom,omitempty"`
+	Status    string `json:"status,omitempty"`
+}
+
+// partnerCaseEvent is a case event as partners see it: what happened to
+// the case, without names, contact details, national IDs or free text.
+type partnerCaseEvent struct {
+	CaseID   string          `json:"case_id"`
+	Seq      int             `json:"seq"`
+	Time     string          `json:"time"`
+	CaseType string          `json:"case_type,omitempty"`   // CaseFiled
+	Status   string          `json:"status,omitempty"`      // CaseFiled, StatusChanged, DeadlineStatusChanged
+	Judge    string          `json:"judge,omitempty"`       // JudgeAssigned
+	Hearing  *partnerHearing `json:"hearing,omitempty"`     // Hearing events
+	Role     string          `json:"party_role,omitempty"`  // PartyAdded
+	Outcome  string          `json:"outcome,omitempty"`     // VerdictIssued
+	Deadline string          `json:"deadline_id,omitempty"` // Deadline events
+	Due      string          `json:"due,omitempty"`
+}
+
+// partnerRequest is a request as partners see it, without whose it is.
+type partnerRequest struct {
+	ID        string `json:"id"`
+	Type      string `json:"type,omitempty"`
+	Status    string `json:"status,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// PartnerPayload is the webhooks.PayloadFunc: it reduces case and request
+// events to what partner systems may see, and gives nil for anything
+// else.
+func PartnerPayload(m *outbox.Message) (json.RawMessage, error) {
+	switch m.AggregateType {
+	case "case":
+		var e caseevents.Event
+		if err := json.Unmarshal(m.Payload, &e); err != nil {
+			return nil, err
+		}
+		p := partnerCaseEvent{CaseID: e.CaseID, Seq: e.Seq, Time: e.Time, Judge: e.Judge, Status: e.Status}
+		if e.Case != nil {
+			p.CaseType, p.Status = e.Case.Type, e.Case.Status
+		}
+		if e.Hearing != nil {
+			p.Hearing = &partnerHearing{ID: e.Hearing.ID, Date: e.Hearing.Date, Courtroom: e.Hearing.Courtroom, Status: e.Hearing.Status}
+		}
+		if e.Party != nil {
+			p.Role = e.Party.Role
+		}
+		if e.Verdict != nil {
+			p.Outcome = e.Verdict.Outcome
+		}
+		if e.Deadline != nil {
+			p.Deadline, p.Due = e.Deadline.ID, e.Deadline.Due
+			if e.Type == caseevents.DeadlineStatusChanged {
+				p.Status = e.Deadline.Status
+			}
+		}
+		return json.Marshal(p)
+	case "request":
+		var payload struct {
+			Request Models.Request `json:"request"`
+		}
+		if err := json.Unmarshal(m.Payload, &payload); err != nil {
+			return nil, err
+		}
+		r := payload.Request
+		return json.Marshal(partnerRequest{ID: r.ID, Type: r.Type, Status: r.Status, CreatedAt: r.CreatedAt})
+	}
+	return nil, nil
+}
+
+// NewWebhook subscribes a partner endpoint to event types ("*" for all).
+// The signing secret is generated unless given, and shown only here.
+func (h *Courthandler) NewWebhook(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	var req struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Secret     string   `json:"secret"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.EventTypes) == 0 {
+		http.Error(w, "Invalid request payload, url and event_types are required", http.StatusBadRequest)
+		return
+	}
+	if err := h.webhooks.CheckURL(r.Context(), req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Secret == "" {
+		if req.Secret, err = serviceauth.NewSecret(); err != nil {
+			http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+			return
+		}
+	}
+	sub := webhooks.Subscription{
+		ID:         uuid.New().String(),
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     req.Secret,
+		Active:     true,
+		CreatedBy:  admin.Email,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	err = h.repo.NewWebhook(&sub)
+	if err != nil {
+		http.Error(w, "Couldn't save the webhook", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, admin.Email, "webhook.create", "webhook/"+sub.ID, nil, sub)
+	w.WriteHeader(http.StatusCreated)
+	RenderJSON(w, struct {
+		*webhooks.Subscription
+		Secret string `json:"secret"`
+	}{&sub, sub.Secret})
+}
+func (h *Courthandler) GetAllWebhooks(w http.ResponseWriter, r *http.Request) {
+	if RequireRole(w, r, h.repo, RoleAdmin) == nil {
+		return
+	}
+	subs, err := h.repo.GetAllWebhooks()
+	if err != nil {
+		http.Error(w, "Webhooks not found", http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, subs)
+}
+
+// UpdateWebhook changes a subscription's URL, event types or active flag.
+// Re-activating a disabled endpoint clears its failure streak.
+func (h *Courthandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	sub, err := h.repo.GetWebhook(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	before := *sub
+	var req struct {
+		URL        *string  `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Active     *bool    `json:"active"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.URL != nil {
+		if err := h.webhooks.CheckURL(r.Context(), *req.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sub.URL = *req.URL
+	}
+	if len(req.EventTypes) > 0 {
+		sub.EventTypes = req.EventTypes
+	}
+	if req.Active != nil {
+		if *req.Active && !sub.Active {
+			sub.ConsecutiveFailures = 0
+			sub.DisabledReason = ""
+		}
+		sub.Active = *req.Active
+	}
+	err = h.repo.UpdateWebhook(sub)
+	if err != nil {
+		http.Error(w, "Couldn't save the webhook", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, admin.Email, "webhook.update", "webhook/"+sub.ID, before, sub)
+	RenderJSON(w, sub)
+}
+func (h *Courthandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	err := h.repo.DeleteWebhook(id)
+	if err != nil {
+		if Repo.IsNotFound(err) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Couldn't delete the webhook", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, admin.Email, "webhook.delete", "webhook/"+id, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries shows the delivery log of a subscription, optionally
+// filtered by status.
+func (h *Courthandler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if RequireRole(w, r, h.repo, RoleAdmin) == nil {
+		return
+	}
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	deliveries, err := h.repo.GetWebhookDeliveries(mux.Vars(r)["id"], r.URL.Query().Get("status"), limit)
+	if err != nil {
+		log.Printf("Operation Failed: %v\n", err)
+		http.Error(w, "Deliveries not found", http.StatusInternalServerError)
+		return
+	}
+	RenderJSON(w, deliveries)
+}
+func (h *Courthandler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	admin := RequireRole(w, r, h.repo, RoleAdmin)
+	if admin == nil {
+		return
+	}
+	vars := mux.Vars(r)
+	err := h.repo.RedeliverWebhook(vars["id"], vars["deliveryId"])
+	if err != nil {
+		if Repo.IsNotFound(err) {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Couldn't queue the delivery", http.StatusInternalServerError)
+		return
+	}
+	h.record(r, admin.Email, "webhook.redeliver", "webhook/"+vars["id"]+"/delivery/"+vars["deliveryId"], nil, nil)
+	h.webhooks.Notify()
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/outbox"
+)
+
+func TestPartnerPayloadLeavesOutPersonalData(t *testing.T) {
+	filed := &caseevents.Event{
+		CaseID: "c1", Seq: 1, Type: caseevents.CaseFiled, Time: "2024-03-01T09:00:00Z", Actor: "clerk@sud.rs",
+		Case: &Models.Case{ID: "c1", Type: "Criminal", Status: "Open", Defendant: "Marko Marković",
+			DefendantEmail: "marko@mail.rs", DefendantNationalID: "0101990710001", PlaintiffEmail: "ana@mail.rs"},
+	}
+	party := &caseevents.Event{
+		CaseID: "c1", Seq: 2, Type: caseevents.PartyAdded,
+		Party: &caseevents.Party{Role: caseevents.RoleLawyer, Name: "Adv. Petrović", Email: "petrovic@adv.rs", NationalID: "0202980710002"},
+	}
+	hearing := &caseevents.Event{
+		CaseID: "c1", Seq: 3, Type: caseevents.HearingStatusChanged,
+		Hearing: &Models.Hearing{ID: "h1", Status: HearingDelayed, Note: "Defendant Marković is ill"},
+	}
+	request := struct {
+		Email   string         `json:"email"`
+		Request Models.Request `json:"request"`
+	}{"ana@mail.rs", Models.Request{ID: "r1", Status: "resolved", Description: "Certificate for Ana Anić"}}
+
+	messages := []*outbox.Message{}
+	for _, e := range []*caseevents.Event{filed, party, hearing} {
+		raw, _ := json.Marshal(e)
+		messages = append(messages, &outbox.Message{Type: e.Type, AggregateType: "case", AggregateID: "c1", Payload: raw})
+	}
+	raw, _ := json.Marshal(request)
+	messages = append(messages, &outbox.Message{Type: RequestCreated, AggregateType: "request", AggregateID: "r1", Payload: raw})
+
+	for _, m := range messages {
+		data, err := PartnerPayload(m)
+		if err != nil || data == nil {
+			t.Fatalf("PartnerPayload(%s) = %s, %v", m.Type, data, err)
+		}
+		for _, secret := range []string{"Marković", "@", "0101990710001", "0202980710002", "Petrović", "Anić", "clerk"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("PartnerPayload(%s) = %s, leaks %q", m.Type, data, secret)
+			}
+		}
+	}
+
+	data, _ := PartnerPayload(messages[0])
+	var p partnerCaseEvent
+	json.Unmarshal(data, &p)
+	if p.CaseID != "c1" || p.CaseType != "Criminal" || p.Status != "Open" {
+		t.Fatalf("CaseFiled payload = %s", data)
+	}
+	closed, _ := json.Marshal(&caseevents.Event{CaseID: "c1", Seq: 4, Type: caseevents.DeadlineStatusChanged,
+		Deadline: &Models.Deadline{ID: "d1", Status: DeadlineMet}})
+	data, _ = PartnerPayload(&outbox.Message{Type: caseevents.DeadlineStatusChanged, AggregateType: "case", Payload: closed})
+	p = partnerCaseEvent{}
+	json.Unmarshal(data, &p)
+	if p.Deadline != "d1" || p.Status != DeadlineMet {
+		t.Fatalf("DeadlineStatusChanged payload = %s", data)
+	}
+	if data, err := PartnerPayload(&outbox.Message{AggregateType: "internal"}); data != nil || err != nil {
+		t.Fatalf("PartnerPayload(unknown) = %s, %v, want nothing", data, err)
+	}
+}
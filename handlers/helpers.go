@@ -3,11 +3,14 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/EupravaProjekat/court/Models"
 	"github.com/EupravaProjekat/court/Repo"
 	"io"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	protosAuth "github.com/MihajloJankovic/Auth-Service/protos/main"
@@ -16,6 +19,7 @@ import (
 	protos "github.com/MihajloJankovic/profile-service/protos/main"
 	protosRes "github.com/MihajloJankovic/reservation-service/protos/genfiles"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 func StreamToByte(stream io.Reader) []byte {
@@ -26,23 +30,41 @@ func StreamToByte(stream io.Reader) []byte {
 	}
 	return buf.Bytes()
 }
+
+// accessTokenTTL is the lifetime of an access jwt; sessions outlive it
+// through refresh tokens.
+const accessTokenTTL = 600 * time.Second
+
+var sampleSecretKey = []byte("SecretYouShouldHide")
+
 func GenerateJwt(w http.ResponseWriter, email string, role string) string {
+	tokenString, _, _ := GenerateSessionJwt(email, role, "")
+	return tokenString
+}
+
+// GenerateSessionJwt signs an access token bound to a session and returns
+// it with its jti and expiry so the session can later revoke it.
+func GenerateSessionJwt(email string, role string, sid string) (string, string, time.Time) {
 	// Create a new token object, specifying signing method and the claims
 	// you would like it to contain.
-	ttl := 600 * time.Second
+	jti := uuid.New().String()
+	exp := time.Now().UTC().Add(accessTokenTTL)
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
 	claims["isu"] = jwt.NewNumericDate(time.Now())
 	claims["role"] = role
 	claims["email"] = email
-	claims["exp"] = time.Now().UTC().Add(ttl).Unix()
-	var sampleSecretKey = []byte("SecretYouShouldHide")
+	claims["exp"] = exp.Unix()
+	claims["jti"] = jti
+	if sid != "" {
+		claims["sid"] = sid
+	}
 	// Sign and get the complete encoded token as a string using the secret
 	tokenString, err := token.SignedString(sampleSecretKey)
 	if err != nil {
 		fmt.Println(err)
 	}
-	return tokenString
+	return tokenString, jti, exp
 }
 func DecodeBody(r io.Reader) (*Models.Request, error) {
 	dec := json.NewDecoder(r)
@@ -177,8 +199,13 @@ func RenderJSON(w http.ResponseWriter, v interface{}) {
 		return
 	}
 }
-func ValidateJwt(r *http.Request, h *Repo.Repo) *Models.User {
-	tokenString := r.Header.Get("jwt")
+
+// ParseJwtClaims returns the claims of the request's jwt if it is validly
+// signed, unexpired and its jti hasn't been revoked.
+func ParseJwtClaims(r *http.Request, h *Repo.Repo) jwt.MapClaims {
+	return parseJwt(r.Header.Get("jwt"), h.IsTokenRevoked)
+}
+func parseJwt(tokenString string, isRevoked func(jti string) bool) jwt.MapClaims {
 	if tokenString == "" {
 		return nil
 	}
@@ -189,53 +216,117 @@ func ValidateJwt(r *http.Request, h *Repo.Repo) *Models.User {
 		}
 
 		// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
-		return []byte("SecretYouShouldHide"), nil
+		return sampleSecretKey, nil
 	})
+	if err != nil {
+		return nil
+	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if ok == false || token.Valid == false {
 		return nil
 
 	}
-	exp := claims["exp"].(float64)
-	email := claims["email"].(string)
-	if float64(time.Now().UTC().Unix()) > exp {
+	exp, ok := claimsExpiry(claims)
+	if !ok || time.Now().After(exp) {
 		return nil
 	}
-	rt, err := h.GetByEmail(email)
+	if _, ok := claims["email"].(string); !ok {
+		return nil
+	}
+	if jti, ok := claims["jti"].(string); ok && isRevoked(jti) {
+		return nil
+	}
+	return claims
+}
+
+// claimsExpiry returns the token's exp claim, if it has one.
+func claimsExpiry(claims jwt.MapClaims) (time.Time, bool) {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+func ValidateJwt(r *http.Request, h *Repo.Repo) *Models.User {
+	claims := ParseJwtClaims(r, h)
+	if claims == nil {
+		return nil
+	}
+	rt, err := h.GetByEmail(claims["email"].(string))
 	if err != nil {
 		return nil
 	}
 	return rt
 }
-func ValidateJwt2(r *http.Request, h *Repo.Repo) string {
-	tokenString := r.Header.Get("jwt")
-	if tokenString == "" {
-		return ""
+
+// Roles a court user can hold; new profiles start as RoleGuest.
+const (
+	RoleGuest    = "Guest"
+	RoleOperator = "Operator"
+	RoleJudge    = "Judge"
+	RoleAdmin    = "Admin"
+)
+
+// RequireRole validates the caller's jwt and checks it holds one of the
+// roles, writing the error response itself when it doesn't.
+func RequireRole(w http.ResponseWriter, r *http.Request, h *Repo.Repo, roles ...string) *Models.User {
+	res := ValidateJwt(r, h)
+	if res == nil {
+		err := errors.New("user doesnt exist")
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil
 	}
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Don't forget to validate the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	for _, role := range roles {
+		if res.Role == role {
+			return res
 		}
+	}
+	err := errors.New("role error")
+	http.Error(w, err.Error(), http.StatusForbidden)
+	return nil
+}
 
-		// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
-		return []byte("SecretYouShouldHide"), nil
-	})
-	if err != nil {
-		return ""
+// isStaff reports whether the user works for the court rather than being a
+// party or citizen.
+func isStaff(u *Models.User) bool {
+	return u.Role == RoleOperator || u.Role == RoleJudge || u.Role == RoleAdmin
+}
+
+// verifiedIdentity returns the caller's name and national ID as vouched
+// for by the identity provider in the jwt's name and national_id claims,
+// and remembers them on the user for documents issued to them later.
+// Both are empty when the token carries no identity.
+func verifiedIdentity(r *http.Request, h *Repo.Repo, user *Models.User) (string, string) {
+	claims := ParseJwtClaims(r, h)
+	name, _ := claims["name"].(string)
+	nationalID, _ := claims["national_id"].(string)
+	if name == "" || nationalID == "" {
+		return user.FullName, user.NationalID
 	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok == false || token.Valid == false {
-		return ""
+	if name != user.FullName || nationalID != user.NationalID {
+		if err := h.SetUserIdentity(user.Email, name, nationalID); err != nil {
+			log.Printf("Operation Failed: %v\n", err)
+		}
+		user.FullName, user.NationalID = name, nationalID
+	}
+	return name, nationalID
+}
 
+// sameIdentity reports whether claimed details, where given, match the
+// verified ones.
+func sameIdentity(name, nationalID, verifiedName, verifiedNationalID string) bool {
+	if name != "" && !strings.EqualFold(strings.Join(strings.Fields(name), " "), strings.Join(strings.Fields(verifiedName), " ")) {
+		return false
 	}
-	exp := claims["exp"].(float64)
-	email := claims["email"].(string)
-	if float64(time.Now().UTC().Unix()) > exp {
+	return nationalID == "" || strings.TrimSpace(nationalID) == verifiedNationalID
+}
+
+func ValidateJwt2(r *http.Request, h *Repo.Repo) string {
+	claims := ParseJwtClaims(r, h)
+	if claims == nil {
 		return ""
 	}
-
-	return email
+	return claims["email"].(string)
 
 }
 func formatJSON(data []byte) string {
@@ -0,0 +1,210 @@
+// Package lookupcache is a TTL cache with stale-while-revalidate semantics,
+// an in-process LRU in front of an optional shared backend, and tag based
+// invalidation.
+package lookupcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is a cached value. Until FreshUntil it is served as is; until
+// StaleUntil it is served while being refreshed, or when refreshing fails.
+type Entry struct {
+	Value      []byte    `bson:"value"`
+	Tags       []string  `bson:"tags"`
+	FreshUntil time.Time `bson:"freshUntil"`
+	StaleUntil time.Time `bson:"staleUntil"`
+}
+
+func (e *Entry) hasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Backend is a store shared between replicas.
+type Backend interface {
+	Get(ctx context.Context, key string) (*Entry, error) // nil, nil on a miss
+	Set(ctx context.Context, key string, e *Entry) error
+	DeleteTag(ctx context.Context, tag string) error
+}
+
+type Config struct {
+	Size     int           // Max entries kept in process
+	TTL      time.Duration // How long an entry is fresh
+	StaleTTL time.Duration // How long after that it may still be served
+	LocalTTL time.Duration // Caps local freshness when a shared backend is used, so other replicas' invalidations are picked up
+}
+
+// Result says how a value was obtained.
+type Result int
+
+const (
+	Miss Result = iota
+	Hit
+	Stale
+)
+
+// Metrics are cumulative counters since start.
+type Metrics struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	StaleServed   int64 `json:"stale_served"`
+	Revalidations int64 `json:"revalidations"`
+	LoadErrors    int64 `json:"load_errors"`
+	Evictions     int64 `json:"evictions"`
+	Invalidations int64 `json:"invalidations"`
+	Entries       int   `json:"entries"`
+}
+
+type Cache struct {
+	cfg    Config
+	local  *lru
+	shared Backend
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+
+	// generation counts invalidations; a load that saw it change meanwhile
+	// may have read data from before the invalidation and isn't cached
+	generation atomic.Uint64
+
+	hits, misses, stale, revalidations, loadErrors, evictions, invalidations atomic.Int64
+}
+
+// New builds a cache; shared may be nil for a purely in-process cache.
+func New(cfg Config, shared Backend) *Cache {
+	c := &Cache{cfg: cfg, shared: shared, refreshing: make(map[string]bool)}
+	c.local = newLRU(cfg.Size, func() { c.evictions.Add(1) })
+	return c
+}
+
+// Loader computes a value and the tags it should be invalidated by.
+type Loader func(ctx context.Context) ([]byte, []string, error)
+
+// Get returns the cached value for key, loading it on a miss. A stale entry
+// is returned immediately and refreshed in the background; if loading fails
+// a stale entry is served instead of the error.
+func (c *Cache) Get(ctx context.Context, key string, load Loader) ([]byte, Result, error) {
+	now := time.Now()
+	e := c.lookup(ctx, key)
+	if e != nil && now.Before(e.FreshUntil) {
+		c.hits.Add(1)
+		return e.Value, Hit, nil
+	}
+	if e != nil && now.Before(e.StaleUntil) {
+		c.stale.Add(1)
+		c.revalidate(key, load)
+		return e.Value, Stale, nil
+	}
+	c.misses.Add(1)
+	value, err := c.load(ctx, key, load)
+	if err != nil {
+		return nil, Miss, err
+	}
+	return value, Miss, nil
+}
+
+// Invalidate drops every entry tagged with tag, locally and in the backend.
+// Loads already running return their value without caching it.
+func (c *Cache) Invalidate(ctx context.Context, tag string) {
+	c.generation.Add(1)
+	c.invalidations.Add(int64(c.local.deleteTag(tag)))
+	if c.shared != nil {
+		if err := c.shared.DeleteTag(ctx, tag); err != nil {
+			c.loadErrors.Add(1)
+		}
+	}
+}
+
+func (c *Cache) Metrics() Metrics {
+	return Metrics{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		StaleServed:   c.stale.Load(),
+		Revalidations: c.revalidations.Load(),
+		LoadErrors:    c.loadErrors.Load(),
+		Evictions:     c.evictions.Load(),
+		Invalidations: c.invalidations.Load(),
+		Entries:       c.local.len(),
+	}
+}
+
+func (c *Cache) lookup(ctx context.Context, key string) *Entry {
+	if e := c.local.get(key); e != nil {
+		return e
+	}
+	if c.shared == nil {
+		return nil
+	}
+	e, err := c.shared.Get(ctx, key)
+	if err != nil || e == nil {
+		return nil
+	}
+	c.local.set(key, c.localCopy(e))
+	return e
+}
+
+func (c *Cache) load(ctx context.Context, key string, load Loader) ([]byte, error) {
+	generation := c.generation.Load()
+	value, tags, err := load(ctx)
+	if err != nil {
+		c.loadErrors.Add(1)
+		return nil, err
+	}
+	if c.generation.Load() != generation {
+		return value, nil
+	}
+	now := time.Now()
+	e := &Entry{Value: value, Tags: tags, FreshUntil: now.Add(c.cfg.TTL), StaleUntil: now.Add(c.cfg.TTL + c.cfg.StaleTTL)}
+	c.local.set(key, c.localCopy(e))
+	if c.shared != nil {
+		if err := c.shared.Set(ctx, key, e); err != nil {
+			c.loadErrors.Add(1)
+		}
+	}
+	return value, nil
+}
+
+// localCopy shortens local freshness so entries invalidated by another
+// replica in the shared backend aren't served from here for long.
+func (c *Cache) localCopy(e *Entry) *Entry {
+	if c.shared == nil || c.cfg.LocalTTL <= 0 {
+		return e
+	}
+	cp := *e
+	if limit := time.Now().Add(c.cfg.LocalTTL); cp.FreshUntil.After(limit) {
+		cp.FreshUntil = limit
+	}
+	return &cp
+}
+
+// revalidate refreshes key in the background, once at a time per key.
+func (c *Cache) revalidate(key string, load Loader) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+	c.revalidations.Add(1)
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		// On failure the stale entry simply stays in place
+		_, _ = c.load(ctx, key, load)
+	}()
+}
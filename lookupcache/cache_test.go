@@ -0,0 +1,171 @@
+package lookupcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mapBackend is a shared backend kept in memory.
+type mapBackend struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+func newMapBackend() *mapBackend {
+	return &mapBackend{entries: make(map[string]*Entry)}
+}
+
+func (b *mapBackend) Get(ctx context.Context, key string) (*Entry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.entries[key], nil
+}
+
+func (b *mapBackend) Set(ctx context.Context, key string, e *Entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[key] = e
+	return nil
+}
+
+func (b *mapBackend) DeleteTag(ctx context.Context, tag string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, e := range b.entries {
+		if e.hasTag(tag) {
+			delete(b.entries, key)
+		}
+	}
+	return nil
+}
+
+// value returns a loader that answers v and counts its calls.
+func value(v string, calls *int) Loader {
+	return func(ctx context.Context) ([]byte, []string, error) {
+		*calls++
+		return []byte(v), []string{"tag"}, nil
+	}
+}
+
+func TestGetCachesUntilInvalidated(t *testing.T) {
+	c := New(Config{Size: 10, TTL: time.Minute, StaleTTL: time.Minute}, nil)
+	ctx := context.Background()
+	calls := 0
+	if v, res, err := c.Get(ctx, "k", value("a", &calls)); err != nil || string(v) != "a" || res != Miss {
+		t.Fatalf("first Get() = %q, %v, %v", v, res, err)
+	}
+	if v, res, _ := c.Get(ctx, "k", value("b", &calls)); string(v) != "a" || res != Hit {
+		t.Fatalf("second Get() = %q, %v, want cached a", v, res)
+	}
+	c.Invalidate(ctx, "tag")
+	if v, res, _ := c.Get(ctx, "k", value("b", &calls)); string(v) != "b" || res != Miss {
+		t.Fatalf("Get() after Invalidate = %q, %v, want fresh b", v, res)
+	}
+	if calls != 2 {
+		t.Fatalf("loader called %d times, want 2", calls)
+	}
+	m := c.Metrics()
+	if m.Hits != 1 || m.Misses != 2 || m.Invalidations != 1 {
+		t.Fatalf("metrics = %+v", m)
+	}
+}
+
+func TestStaleServedWhileRefreshing(t *testing.T) {
+	c := New(Config{Size: 10, TTL: time.Millisecond, StaleTTL: time.Minute}, nil)
+	ctx := context.Background()
+	calls := 0
+	c.Get(ctx, "k", value("a", &calls))
+	time.Sleep(5 * time.Millisecond)
+
+	refreshed := make(chan struct{})
+	v, res, err := c.Get(ctx, "k", func(ctx context.Context) ([]byte, []string, error) {
+		defer close(refreshed)
+		return []byte("b"), nil, nil
+	})
+	if err != nil || string(v) != "a" || res != Stale {
+		t.Fatalf("Get() of a stale entry = %q, %v, %v", v, res, err)
+	}
+	<-refreshed
+	// The refresh stores its value just after the loader returns
+	deadline := time.Now().Add(time.Second)
+	for {
+		if e := c.local.get("k"); string(e.Value) == "b" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("entry not refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	c := New(Config{Size: 10, TTL: time.Minute}, nil)
+	boom := errors.New("boom")
+	_, _, err := c.Get(context.Background(), "k", func(ctx context.Context) ([]byte, []string, error) {
+		return nil, nil, boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("Get() = %v, want the loader's error", err)
+	}
+	if c.local.get("k") != nil {
+		t.Fatal("failed load was cached")
+	}
+	if c.Metrics().LoadErrors != 1 {
+		t.Fatalf("metrics = %+v", c.Metrics())
+	}
+}
+
+func TestInvalidateDuringLoad(t *testing.T) {
+	c := New(Config{Size: 10, TTL: time.Minute}, nil)
+	ctx := context.Background()
+	v, _, err := c.Get(ctx, "k", func(ctx context.Context) ([]byte, []string, error) {
+		// Data read here predates the invalidation
+		c.Invalidate(ctx, "tag")
+		return []byte("old"), []string{"tag"}, nil
+	})
+	if err != nil || string(v) != "old" {
+		t.Fatalf("Get() = %q, %v", v, err)
+	}
+	if e := c.local.get("k"); e != nil {
+		t.Fatalf("load overlapping an invalidation was cached: %+v", e)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := New(Config{Size: 2, TTL: time.Minute}, nil)
+	ctx := context.Background()
+	calls := 0
+	c.Get(ctx, "a", value("a", &calls))
+	c.Get(ctx, "b", value("b", &calls))
+	c.Get(ctx, "a", value("a", &calls)) // a is now the most recently used
+	c.Get(ctx, "c", value("c", &calls))
+	if c.local.get("b") != nil || c.local.get("a") == nil {
+		t.Fatal("least recently used entry not evicted")
+	}
+	if m := c.Metrics(); m.Evictions != 1 || m.Entries != 2 {
+		t.Fatalf("metrics = %+v", m)
+	}
+}
+
+func TestSharedBackend(t *testing.T) {
+	shared := newMapBackend()
+	ctx := context.Background()
+	one := New(Config{Size: 10, TTL: time.Hour, LocalTTL: time.Minute}, shared)
+	two := New(Config{Size: 10, TTL: time.Hour, LocalTTL: time.Minute}, shared)
+	calls := 0
+	one.Get(ctx, "k", value("a", &calls))
+	if v, res, _ := two.Get(ctx, "k", value("b", &calls)); string(v) != "a" || res != Hit {
+		t.Fatalf("other replica Get() = %q, %v, want the shared a", v, res)
+	}
+	if e := one.local.get("k"); time.Until(e.FreshUntil) > time.Minute {
+		t.Fatalf("local copy fresh until %v, want within LocalTTL", e.FreshUntil)
+	}
+	two.Invalidate(ctx, "tag")
+	if e, _ := shared.Get(ctx, "k"); e != nil {
+		t.Fatal("invalidation didn't reach the shared backend")
+	}
+}
@@ -0,0 +1,75 @@
+package lookupcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+type lruItem struct {
+	key   string
+	entry *Entry
+}
+
+// lru is a fixed-size in-process store that evicts the least recently used
+// entry once full.
+type lru struct {
+	mu        sync.Mutex
+	size      int
+	ll        *list.List
+	items     map[string]*list.Element
+	onEvicted func()
+}
+
+func newLRU(size int, onEvicted func()) *lru {
+	return &lru{size: size, ll: list.New(), items: make(map[string]*list.Element), onEvicted: onEvicted}
+}
+
+func (l *lru) get(key string) *Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		l.ll.MoveToFront(el)
+		return el.Value.(*lruItem).entry
+	}
+	return nil
+}
+
+func (l *lru) set(key string, e *Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		el.Value.(*lruItem).entry = e
+		l.ll.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.ll.PushFront(&lruItem{key: key, entry: e})
+	for l.size > 0 && l.ll.Len() > l.size {
+		oldest := l.ll.Back()
+		l.ll.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruItem).key)
+		if l.onEvicted != nil {
+			l.onEvicted()
+		}
+	}
+}
+
+// deleteTag drops every entry carrying the tag and returns how many.
+func (l *lru) deleteTag(tag string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for key, el := range l.items {
+		if el.Value.(*lruItem).entry.hasTag(tag) {
+			l.ll.Remove(el)
+			delete(l.items, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (l *lru) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
@@ -4,7 +4,19 @@ import (
 	"context"
 	"errors"
 	"github.com/EupravaProjekat/court/Repo"
+	"github.com/EupravaProjekat/court/audit"
+	"github.com/EupravaProjekat/court/docsign"
+	"github.com/EupravaProjekat/court/eventstream"
 	"github.com/EupravaProjekat/court/handlers"
+	"github.com/EupravaProjekat/court/notify"
+	"github.com/EupravaProjekat/court/outbox"
+	"github.com/EupravaProjekat/court/prosecution"
+	"github.com/EupravaProjekat/court/prosecution/simulator"
+	"github.com/EupravaProjekat/court/ratelimit"
+	"github.com/EupravaProjekat/court/reminders"
+	"github.com/EupravaProjekat/court/serviceauth"
+	"github.com/EupravaProjekat/court/tlsreload"
+	"github.com/EupravaProjekat/court/webhooks"
 	habb "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"log"
@@ -16,7 +28,28 @@ import (
 )
 
 func main() {
-	quit := make(chan os.Signal)
+	// Subcommands for local development
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "prosecution-sim":
+			err = simulator.Run(os.Args[2:])
+		case "verify-document":
+			err = docsign.RunVerify(os.Args[2:])
+		case "generate-signing-key":
+			err = docsign.RunGenerateKey(os.Args[2:])
+		case "verify-audit":
+			err = audit.RunVerify(os.Args[2:])
+		default:
+			err = errors.New("unknown subcommand " + os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	l := log.New(os.Stdout, "standard-api", log.LstdFlags)
 	timeoutContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -34,14 +67,65 @@ func main() {
 
 	// NoSQL: Checking if the connection was established
 	repo.Ping()
+	if err := repo.RequireReplicaSet(); err != nil {
+		l.Fatal(err)
+	}
+	repo.EnsureIndexes()
 
 	//Initialize the handler and inject said logger
-	hh := handlers.NewCourthandler(l, repo)
+	prosecutionClient := prosecution.New(prosecution.ConfigFromEnv())
+	sinks, err := outbox.SinksFromEnv(l)
+	if err != nil {
+		l.Fatal(err)
+	}
+	webhookWorker := webhooks.NewWorker(repo.WebhookStore(), webhooks.ConfigFromEnv(), handlers.PartnerPayload, l)
+	var notifyChannels []notify.Channel
+	if smtpCfg, ok := notify.SMTPConfigFromEnv(); ok {
+		notifyChannels = append(notifyChannels, notify.NewSMTPChannel(smtpCfg))
+	}
+	handlerConfig, err := handlers.ConfigFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	notifyConfig := notify.ConfigFromEnv()
+	notifyConfig.TimeZone = handlerConfig.TimeZone
+	notifier := notify.New(repo.NotificationStore(), notifyChannels, notifyConfig, l)
+	reminderConfig, err := reminders.ConfigFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	scheduler := reminders.New(repo.ReminderStore(), reminderConfig, notifier.Remind, l)
+	sinks = append(sinks, webhookWorker.Sink(), notifier.Sink(), scheduler.Sink())
+	dispatcher := outbox.New(repo.OutboxStore(), sinks, outbox.ConfigFromEnv(), l)
+	repo.EnsureOutboxIndexes(dispatcher.Sinks())
+	dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+	defer stopDispatch()
+	go dispatcher.Run(dispatchCtx)
+	go webhookWorker.Run(dispatchCtx)
+	go notifier.Run(dispatchCtx)
+	go scheduler.Run(dispatchCtx)
+	go func() {
+		if err := scheduler.Backfill(dispatchCtx); err != nil {
+			l.Printf("Couldn't backfill reminders: %v\n", err)
+		}
+	}()
+	hub := eventstream.NewHub(repo.StreamStore(), time.Second, l)
+	go hub.Run(dispatchCtx)
+	hh := handlers.NewCourthandler(l, repo, handlerConfig, prosecutionClient, dispatcher, webhookWorker, hub, notifier)
+	go hh.RunRequestTimeouts(dispatchCtx)
+	go hh.RunAudit(dispatchCtx)
+	if err := hh.MigrateSigningKeys(); err != nil {
+		l.Printf("Couldn't move signing keys out of the database: %v\n", err)
+	}
 
 	router := mux.NewRouter()
 	router.StrictSlash(true)
 	//profile
+	router.HandleFunc("/profile/notifications", hh.GetNotificationPreferences).Methods("GET")
+	router.HandleFunc("/profile/notifications", hh.UpdateNotificationPreferences).Methods("PUT")
 	router.HandleFunc("/profile/{email}", hh.GetProfile).Methods("GET")
+	router.HandleFunc("/profile/signing-key/challenge", hh.NewSigningKeyChallenge).Methods("POST")
+	router.HandleFunc("/profile/signing-key", hh.RegisterSigningKey).Methods("PUT")
 	router.HandleFunc("/newrequest", hh.NewRequest).Methods("POST")
 	router.HandleFunc("/checkifuserexists", hh.CheckIfUserExists).Methods("GET")
 	router.HandleFunc("/getrequest/{id}", hh.GetRequest).Methods("GET")
@@ -49,20 +133,135 @@ func main() {
 	router.HandleFunc("/getallrequests", hh.GetallRequests).Methods("GET")
 	router.HandleFunc("/getallcausings", hh.GetAllCases).Methods("GET")
 	router.HandleFunc("/newcase", hh.NewCase).Methods("POST")
-	router.HandleFunc("/checkifprosecuted", hh.CheckIfPersonIsProsecuted).Methods("GET")
+	router.HandleFunc("/cases/{id}/verdict", hh.IssueVerdict).Methods("POST")
+	router.HandleFunc("/cases/{id}/verify", hh.VerifyCase).Methods("POST")
+	router.HandleFunc("/cases/{id}/judge", hh.AssignJudge).Methods("PUT")
+	router.HandleFunc("/cases/{id}/hearings", hh.ScheduleHearing).Methods("POST")
+	router.HandleFunc("/cases/{id}/hearings/{hearingId}/status", hh.ChangeHearingStatus).Methods("PUT")
+	router.HandleFunc("/cases/{id}/hearings/{hearingId}", hh.RescheduleHearing).Methods("PUT")
+	router.HandleFunc("/cases/{id}/deadlines", hh.SetDeadline).Methods("POST")
+	router.HandleFunc("/cases/{id}/deadlines/{deadlineId}", hh.ChangeDeadlineStatus).Methods("PUT")
+	router.HandleFunc("/cases/{id}/status", hh.ChangeCaseStatus).Methods("PUT")
+	router.HandleFunc("/cases/{id}/parties", hh.AddParty).Methods("POST")
+	router.HandleFunc("/cases/{id}/history", hh.GetCaseHistory).Methods("GET")
+	router.HandleFunc("/cases/{id}/asof", hh.GetCaseAsOf).Methods("GET")
+	router.HandleFunc("/cases/{id}/documents", hh.UploadCaseDocument).Methods("POST")
+	router.HandleFunc("/cases/{id}/documents", hh.GetCaseDocuments).Methods("GET")
+	router.HandleFunc("/cases/{id}/documents/{docId}", hh.DownloadCaseDocument).Methods("GET")
+	router.HandleFunc("/cases/{id}/documents/{docId}/versions", hh.UploadDocumentVersion).Methods("POST")
+	router.HandleFunc("/cases/{id}/documents/{docId}/versions", hh.GetDocumentVersions).Methods("GET")
+	router.HandleFunc("/cases/{id}/documents/{docId}/versions/{version}", hh.DownloadDocumentVersion).Methods("GET")
+	router.HandleFunc("/cases/{id}/documents/{docId}/diff", hh.DiffDocumentVersions).Methods("GET")
+	router.HandleFunc("/cases/{id}/documents/{docId}/verify", hh.VerifyCaseDocument).Methods("GET")
+	router.HandleFunc("/cases/{id}/evidence", hh.NewEvidence).Methods("POST")
+	router.HandleFunc("/cases/{id}/evidence", hh.GetCaseEvidence).Methods("GET")
+	router.HandleFunc("/cases/{id}/evidence/{evidenceId}", hh.GetEvidence).Methods("GET")
+	router.HandleFunc("/cases/{id}/evidence/{evidenceId}/custody", hh.AddCustodyEntry).Methods("POST")
+	router.HandleFunc("/cases/{id}/evidence/{evidenceId}/custody", hh.GetCustodyLog).Methods("GET")
+	router.HandleFunc("/cases/{id}/evidence/{evidenceId}/custody/report", hh.GetCustodyReport).Methods("GET")
+	router.HandleFunc("/cases/{id}/decision/pdf", hh.GetDecisionPDF).Methods("GET")
+	router.HandleFunc("/cases/{id}/summons/pdf", hh.GetSummonsPDF).Methods("GET")
+	router.HandleFunc("/cases/{id}/hearing-notice/pdf", hh.GetHearingNoticePDF).Methods("GET")
+	router.HandleFunc("/checkifprosecuted", hh.RequireService(serviceauth.ScopeProsecutionCheck, hh.CheckIfPersonIsProsecuted)).Methods("GET")
+	router.HandleFunc("/checkifprosecuted/batch", hh.RequireService(serviceauth.ScopeProsecutionCheck, hh.CheckIfPeopleAreProsecuted)).Methods("POST")
+	router.HandleFunc("/prosecution/callback", hh.RequireService(serviceauth.ScopeProsecutionCallback, hh.ProsecutionCallback)).Methods("POST")
+	router.HandleFunc("/metrics/prosecution-cache", hh.GetProsecutionCacheMetrics).Methods("GET")
+	//signed documents
+	router.HandleFunc("/signing-keys", hh.GetSigningKeys).Methods("GET")
+	router.HandleFunc("/documents/verify", hh.VerifyDocument).Methods("POST")
+	router.HandleFunc("/admin/signing-keys/rotate", hh.RotateSigningKey).Methods("POST")
+	//public verification, rate limited against enumeration
+	verifyLimiter := ratelimit.New(0.2, 10)
+	router.HandleFunc("/verify/{number}", verifyLimiter.Middleware(handlerConfig.TrustedProxyHops, hh.VerifyDocumentNumber)).Methods("GET")
+	router.HandleFunc("/v/{code}", verifyLimiter.Middleware(handlerConfig.TrustedProxyHops, hh.VerifyShortCode)).Methods("GET")
+	//certificates
+	router.HandleFunc("/certificates", hh.NewCertificate).Methods("POST")
+	router.HandleFunc("/certificates", hh.GetMyCertificates).Methods("GET")
+	router.HandleFunc("/certificates/{number}", hh.GetCertificate).Methods("GET")
+	router.HandleFunc("/certificates/{number}/pdf", hh.GetCertificatePDF).Methods("GET")
+	router.HandleFunc("/admin/certificates/{number}/revoke", hh.RevokeCertificate).Methods("POST")
+	router.HandleFunc("/admin/certificates/{number}/reissue", hh.ReissueCertificate).Methods("POST")
+	//audit
+	router.HandleFunc("/admin/audit", hh.GetAuditLog).Methods("GET")
+	router.HandleFunc("/admin/audit/verify", hh.VerifyAuditLog).Methods("GET")
+	router.HandleFunc("/admin/audit/export", hh.ExportAuditLog).Methods("GET")
+	//outbox
+	router.HandleFunc("/admin/outbox", hh.GetOutboxMessages).Methods("GET")
+	router.HandleFunc("/admin/outbox/stats", hh.GetOutboxStats).Methods("GET")
+	router.HandleFunc("/admin/outbox/{id}/retry", hh.RetryOutboxMessage).Methods("POST")
+	//webhooks
+	router.HandleFunc("/admin/webhooks", hh.NewWebhook).Methods("POST")
+	router.HandleFunc("/admin/webhooks", hh.GetAllWebhooks).Methods("GET")
+	router.HandleFunc("/admin/webhooks/{id}", hh.UpdateWebhook).Methods("PUT")
+	router.HandleFunc("/admin/webhooks/{id}", hh.DeleteWebhook).Methods("DELETE")
+	router.HandleFunc("/admin/webhooks/{id}/deliveries", hh.GetWebhookDeliveries).Methods("GET")
+	router.HandleFunc("/admin/webhooks/{id}/deliveries/{deliveryId}/redeliver", hh.RedeliverWebhook).Methods("POST")
+	//notifications
+	router.HandleFunc("/notifications", hh.GetNotifications).Methods("GET")
+	router.HandleFunc("/notifications/read", hh.MarkAllNotificationsRead).Methods("POST")
+	router.HandleFunc("/notifications/{id}/read", hh.MarkNotificationRead).Methods("POST")
+	router.HandleFunc("/admin/notifications", hh.GetNotificationDeliveries).Methods("GET")
+	router.HandleFunc("/admin/notifications/{id}/retry", hh.RetryNotification).Methods("POST")
+
+	//reminders
+	router.HandleFunc("/admin/reminders", hh.GetReminders).Methods("GET")
+	//live updates
+	router.HandleFunc("/events/ticket", hh.IssueStreamTicket).Methods("POST")
+	router.HandleFunc("/events/stream", hh.StreamEvents).Methods("GET")
+	router.HandleFunc("/board/ws", hh.CourtroomBoard).Methods("GET")
+	router.HandleFunc("/public/board/ws", hh.PublicCourtroomBoard).Methods("GET")
+	//sessions
+	router.HandleFunc("/auth/session", hh.NewSession).Methods("POST")
+	router.HandleFunc("/auth/refresh", hh.RefreshSession).Methods("POST")
+	router.HandleFunc("/auth/logout", hh.Logout).Methods("POST")
+	router.HandleFunc("/admin/sessions/{email}", hh.RevokeUserSessions).Methods("DELETE")
+	//service clients
+	router.HandleFunc("/admin/serviceclients", hh.IssueServiceClient).Methods("POST")
+	router.HandleFunc("/admin/serviceclients", hh.GetAllServiceClients).Methods("GET")
+	router.HandleFunc("/admin/serviceclients/{id}", hh.RevokeServiceClient).Methods("DELETE")
 
-	headersOk := habb.AllowedHeaders([]string{"Content-Type", "jwt", "Authorization"})
+	headersOk := habb.AllowedHeaders([]string{"Content-Type", "jwt", "Authorization", "Last-Event-ID"})
 	originsOk := habb.AllowedOrigins([]string{"http://localhost:4200"}) // Replace with your frontend origin
-	methodsOk := habb.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS"})
+	methodsOk := habb.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"})
 
 	// Use the CORS middleware
 	corsRouter := habb.CORS(originsOk, headersOk, methodsOk)(router)
 
 	// Start the server
 	srv := &http.Server{Addr: ":9198", Handler: corsRouter}
+
+	// TLS and mTLS are optional and configured by files
+	tlsCfg, useTLS, err := tlsreload.ConfigFromEnv()
+	if err != nil {
+		l.Fatal(err)
+	}
+	if useTLS {
+		reloader, err := tlsreload.New(tlsCfg, l)
+		if err != nil {
+			l.Fatal(err)
+		}
+		srv.TLSConfig = reloader.TLSConfig()
+
+		// Reload certificates on SIGHUP without restarting the listener
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := reloader.Reload(); err != nil {
+					l.Printf("tls reload failed: %v\n", err)
+				}
+			}
+		}()
+	}
 	go func() {
 		log.Println("server starting border")
-		if err := srv.ListenAndServe(); err != nil {
+		var err error
+		if useTLS {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
 				log.Fatal(err)
 			}
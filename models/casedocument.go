@@ -0,0 +1,40 @@
+package Models
+
+// CaseDocument is one immutable version of a document filed on a case.
+// Versions of the same document share ID and are chained by hash.
+type CaseDocument struct {
+	ID              string `bson:"id,omitempty" json:"id,omitempty"`
+	Version         int    `bson:"version" json:"version"`
+	CaseID          string `bson:"caseId,omitempty" json:"case_id,omitempty"`
+	FileID          string `bson:"fileId,omitempty" json:"-"` // GridFS file holding the content
+	Filename        string `bson:"filename,omitempty" json:"filename,omitempty"`
+	DocType         string `bson:"docType,omitempty" json:"doc_type,omitempty"`                // filing, evidence, minutes, judgment or other
+	Uploader        string `bson:"uploader,omitempty" json:"uploader,omitempty"`               // Email of the uploading user
+	Party           string `bson:"party,omitempty" json:"party,omitempty"`                     // court, plaintiff or defendant
+	Confidentiality string `bson:"confidentiality,omitempty" json:"confidentiality,omitempty"` // public, parties or sealed
+	ContentType     string `bson:"contentType,omitempty" json:"content_type,omitempty"`
+	Size            int64  `bson:"size" json:"size"`
+	SHA256          string `bson:"sha256,omitempty" json:"sha256,omitempty"`
+	UploadedAt      string `bson:"uploadedAt,omitempty" json:"uploaded_at,omitempty"`
+	PrevHash        string `bson:"prevHash,omitempty" json:"prev_hash,omitempty"`   // ChainHash of the previous version
+	ChainHash       string `bson:"chainHash,omitempty" json:"chain_hash,omitempty"` // Hash over this version's metadata and PrevHash
+}
+
+type DocumentVersionCheck struct {
+	Version   int    `json:"version"`
+	ContentOK bool   `json:"content_ok"`
+	ChainOK   bool   `json:"chain_ok"`
+	Problem   string `json:"problem,omitempty"`
+}
+
+type DocumentIntegrity struct {
+	DocumentID string                 `json:"document_id"`
+	Intact     bool                   `json:"intact"`
+	Versions   []DocumentVersionCheck `json:"versions"`
+}
+
+type MetadataChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
@@ -0,0 +1,22 @@
+package Models
+
+import "github.com/EupravaProjekat/court/docsign"
+
+type Certificate struct {
+	ID                   string             `bson:"id,omitempty" json:"id,omitempty"`
+	Number               string             `bson:"number,omitempty" json:"number,omitempty"`        // Unique, unguessable number UV-<year>-XXXX-XXXX-XXXX, e.g. UV-2026-7KQM-3ZP9-XH2D
+	ShortCode            string             `bson:"shortCode,omitempty" json:"short_code,omitempty"` // Short verification code printed in the QR link
+	Type                 string             `bson:"type,omitempty" json:"type,omitempty"`
+	RequestID            string             `bson:"requestId,omitempty" json:"request_id,omitempty"`
+	HolderEmail          string             `bson:"holderEmail,omitempty" json:"holder_email,omitempty"`
+	HolderName           string             `bson:"holderName,omitempty" json:"holder_name,omitempty"`
+	HolderNationalID     string             `bson:"holderNationalId,omitempty" json:"holder_national_id,omitempty"`
+	ProceedingsConducted bool               `bson:"proceedingsConducted" json:"proceedings_conducted"`
+	Result               string             `bson:"result,omitempty" json:"result,omitempty"` // Wording printed on the certificate
+	Sources              []string           `bson:"sources,omitempty" json:"sources,omitempty"`
+	IssueDate            string             `bson:"issueDate,omitempty" json:"issue_date,omitempty"`
+	ValidUntil           string             `bson:"validUntil,omitempty" json:"valid_until,omitempty"`
+	IssuingCourt         string             `bson:"issuingCourt,omitempty" json:"issuing_court,omitempty"`
+	Replaces             string             `bson:"replaces,omitempty" json:"replaces,omitempty"`   // Number of the revoked certificate this one corrects
+	Signature            *docsign.Signature `bson:"signature,omitempty" json:"signature,omitempty"` // Court's signature over all other fields
+}
@@ -0,0 +1,55 @@
+package Models
+
+import (
+	"github.com/EupravaProjekat/court/docsign"
+	"time"
+)
+
+// Evidence is a physical or digital evidence item attached to a case. Its
+// holder, location and seal follow the latest custody entry.
+type Evidence struct {
+	ID              string `bson:"id,omitempty" json:"id,omitempty"`
+	CaseID          string `bson:"caseId,omitempty" json:"case_id,omitempty"`
+	Description     string `bson:"description,omitempty" json:"description,omitempty"`
+	Type            string `bson:"type,omitempty" json:"type,omitempty"`              // physical or digital
+	DocumentID      string `bson:"documentId,omitempty" json:"document_id,omitempty"` // Case document holding a digital item
+	StorageLocation string `bson:"storageLocation,omitempty" json:"storage_location,omitempty"`
+	SealNumber      string `bson:"sealNumber,omitempty" json:"seal_number,omitempty"`
+	CurrentHolder   string `bson:"currentHolder,omitempty" json:"current_holder,omitempty"`
+	Status          string `bson:"status,omitempty" json:"status,omitempty"` // registered, in_custody or destroyed
+	RegisteredBy    string `bson:"registeredBy,omitempty" json:"registered_by,omitempty"`
+	RegisteredAt    string `bson:"registeredAt,omitempty" json:"registered_at,omitempty"`
+}
+
+// CustodyClaim is what the acting user signs. Seq and PrevHash bind it to
+// its place in the log, so a signed entry can't be replayed or reordered.
+type CustodyClaim struct {
+	CaseID     string `bson:"caseId" json:"case_id"`
+	EvidenceID string `bson:"evidenceId" json:"evidence_id"`
+	Seq        int    `bson:"seq" json:"seq"`
+	Action     string `bson:"action" json:"action"` // received, transferred, returned or destroyed
+	FromHolder string `bson:"fromHolder" json:"from_holder"`
+	ToHolder   string `bson:"toHolder" json:"to_holder"`
+	Location   string `bson:"location" json:"location"`
+	SealNumber string `bson:"sealNumber" json:"seal_number"`
+	Note       string `bson:"note" json:"note"`
+	ActedBy    string `bson:"actedBy" json:"acted_by"`
+	ActedAt    string `bson:"actedAt" json:"acted_at"`
+	PrevHash   string `bson:"prevHash" json:"prev_hash"`
+}
+
+// CustodyEntry is an append-only record of one hand-off.
+type CustodyEntry struct {
+	CustodyClaim `bson:",inline"`
+	Signature    docsign.Signature `bson:"signature" json:"signature"`
+	Hash         string            `bson:"hash" json:"hash"` // Over the claim and its signature
+	RecordedAt   string            `bson:"recordedAt" json:"recorded_at"`
+}
+
+// KeyChallenge is the nonce a user signs to prove they hold the key they
+// register. It is used once and expires quickly.
+type KeyChallenge struct {
+	Email     string    `bson:"email" json:"-"`
+	Challenge string    `bson:"challenge" json:"challenge"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expires_at"`
+}
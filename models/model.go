@@ -1,33 +1,112 @@
 package Models
 
+import "github.com/EupravaProjekat/court/docsign"
+
 type User struct {
 	Uuid     string    `bson:"uuid,omitempty" json:"uuid,omitempty"`
 	Email    string    `bson:"email,omitempty" json:"email,omitempty"`
 	Role     string    `bson:"role,omitempty" json:"role,omitempty"`
 	Requests []Request ` bson:"requests,omitempty" json:"requests,omitempty"`
+	// Identity vouched for by the identity provider's token; certificates
+	// are issued to it
+	FullName   string `bson:"fullName,omitempty" json:"full_name,omitempty"`
+	NationalID string `bson:"nationalId,omitempty" json:"national_id,omitempty"`
+	// Keys the user signs custody entries with; the last one is current
+	SigningKeys   []docsign.PublicKey     `bson:"signingKeys,omitempty" json:"signing_keys,omitempty"`
+	Notifications NotificationPreferences `bson:"notifications,omitempty" json:"notifications"`
 }
 type Case struct {
-	ID           string `bson:"ID,omitempty" json:"id,omitempty"`               // Unique identifier for the case
-	Type         string `bson:"type,omitempty" json:"type"`                     // Type of case (e.g., Civil, Criminal)
-	Status       string `bson:"status,omitempty" json:"status"`                 // Current status of the case (e.g., Open, Closed)
-	FilingDate   string `bson:"filingDate,omitempty" json:"filing_date"`        // Date when the case was filed
-	HearingDates string `bson:"hearingDates,omitempty" json:"hearing_dates"`    // List of scheduled hearing dates
-	Judge        string `bson:"judge,omitempty" json:"judge,omitempty"`         // Name of the judge
-	Plaintiff    string `bson:"plaintiff,omitempty" json:"plaintiff,omitempty"` // Name of the plaintiff
-	Defendant    string `bson:"defendant,omitempty" json:"defendant,omitempty"` // Name of the defendant
-	Lawyers      string `bson:"lawyers,omitempty" json:"lawyers,omitempty"`     // List of lawyers involved
+	ID                  string     `bson:"ID,omitempty" json:"id,omitempty"`               // Unique identifier for the case
+	Type                string     `bson:"type,omitempty" json:"type"`                     // Type of case (e.g., Civil, Criminal)
+	Status              string     `bson:"status,omitempty" json:"status"`                 // Current status of the case (e.g., Open, Closed)
+	FilingDate          string     `bson:"filingDate,omitempty" json:"filing_date"`        // Date when the case was filed
+	HearingDates        string     `bson:"hearingDates,omitempty" json:"hearing_dates"`    // List of scheduled hearing dates
+	Judge               string     `bson:"judge,omitempty" json:"judge,omitempty"`         // Name of the judge
+	Plaintiff           string     `bson:"plaintiff,omitempty" json:"plaintiff,omitempty"` // Name of the plaintiff
+	Defendant           string     `bson:"defendant,omitempty" json:"defendant,omitempty"` // Name of the defendant
+	Lawyers             string     `bson:"lawyers,omitempty" json:"lawyers,omitempty"`     // List of lawyers involved
+	PlaintiffEmail      string     `bson:"plaintiffEmail,omitempty" json:"plaintiff_email,omitempty"`
+	DefendantEmail      string     `bson:"defendantEmail,omitempty" json:"defendant_email,omitempty"`
+	DefendantNationalID string     `bson:"defendantNationalId,omitempty" json:"defendant_national_id,omitempty"` // JMBG of the defendant
+	Verdict             *Verdict   `bson:"verdict,omitempty" json:"verdict,omitempty"`                           // Set once the court decides
+	Visibility          string     `bson:"visibility,omitempty" json:"visibility,omitempty"`                     // public or confidential
+	Unverified          bool       `bson:"unverified,omitempty" json:"unverified,omitempty"`                     // Filed by a citizen and not yet confirmed by court staff
+	Hearings            []Hearing  `bson:"hearings,omitempty" json:"hearings,omitempty"`
+	Deadlines           []Deadline `bson:"deadlines,omitempty" json:"deadlines,omitempty"`              // Procedural deadlines
+	LawyerEmails        []string   `bson:"lawyerEmails,omitempty" json:"lawyer_emails,omitempty"`       // Of the lawyers who gave one; they get reminders
+	ConfirmedEmails     []string   `bson:"confirmedEmails,omitempty" json:"confirmed_emails,omitempty"` // Entered or checked by court staff; others are emailed only if they have a court profile
+	Version             int        `bson:"version" json:"version"`                                      // Sequence number of the last event applied
+}
+type Hearing struct {
+	ID        string `bson:"id,omitempty" json:"id,omitempty"`
+	Date      string `bson:"date,omitempty" json:"date,omitempty"` // RFC 3339
+	Courtroom string `bson:"courtroom,omitempty" json:"courtroom,omitempty"`
+	Status    string `bson:"status,omitempty" json:"status,omitempty"` // scheduled, started, delayed, adjourned, finished or cancelled
+	Note      string `bson:"note,omitempty" json:"note,omitempty"`     // Shown on the courtroom board, e.g. why it is delayed
+}
+
+// Deadline is a procedural deadline, such as for filing an appeal or a
+// response.
+type Deadline struct {
+	ID     string `bson:"id,omitempty" json:"id,omitempty"`
+	Title  string `bson:"title,omitempty" json:"title,omitempty"`
+	Due    string `bson:"due,omitempty" json:"due,omitempty"`       // RFC 3339
+	Party  string `bson:"party,omitempty" json:"party,omitempty"`   // plaintiff or defendant when only they must act
+	Status string `bson:"status,omitempty" json:"status,omitempty"` // open, met or cancelled
+}
+type Verdict struct {
+	CaseID    string             `bson:"caseId,omitempty" json:"case_id,omitempty"`
+	Outcome   string             `bson:"outcome,omitempty" json:"outcome"` // Convicted, Acquitted or Dismissed
+	Date      string             `bson:"date,omitempty" json:"date,omitempty"`
+	Judge     string             `bson:"judge,omitempty" json:"judge,omitempty"`
+	Summary   string             `bson:"summary,omitempty" json:"summary,omitempty"`
+	Signature *docsign.Signature `bson:"signature,omitempty" json:"signature,omitempty"` // Makes the decision verifiable offline
 }
 type Request struct {
 	ID          string `bson:"id,omitempty" json:"id,omitempty"`         // Unique identifier for the request
 	Type        string `bson:"type,omitempty" json:"type,omitempty"`     // Type of request (e.g., access, support)
 	Status      string `bson:"status,omitempty" json:"status,omitempty"` // Current status of the request (e.g., pending, resolved)
 	Case        string `bson:"case,omitempty" json:"case,omitempty"`
+	Certificate string `bson:"certificate,omitempty" json:"certificate,omitempty"` // Number of the certificate issued for the request
 	Description string `bson:"description,omitempty" json:"description,omitempty"` // Description of the request
 	CreatedAt   string `bson:"created_at,omitempty" json:"created_at,omitempty"`   // Timestamp when the request was created
 }
+
+// UserRequest is a request together with the user who filed it.
+type UserRequest struct {
+	Email   string  `bson:"email" json:"email"`
+	Request Request `bson:"request" json:"request"`
+}
 type GetRequest struct {
 	Uuid string `bson:"uuid,omitempty" json:"uuid,omitempty"`
 }
 type Response struct {
 	CaseStatus bool `json:"case_status"`
 }
+type ProsecutionStatus struct {
+	Prosecuted    bool              `json:"prosecuted"`
+	Convicted     bool              `json:"convicted"`
+	Sources       []string          `json:"sources"`         // Which registers answered: court, prosecution-service
+	Cases         []ProsecutionCase `json:"cases,omitempty"` // Court cases behind a positive answer
+	ExternalError string            `json:"external_error,omitempty"`
+	Stale         bool              `json:"stale,omitempty"` // Served from cache while the upstream answer is being refreshed
+}
+type ProsecutionCase struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Verdict string `json:"verdict,omitempty"`
+}
+type ProsecutionCheckResult struct {
+	Email      string             `json:"email,omitempty"`
+	NationalID string             `json:"national_id,omitempty"`
+	Status     *ProsecutionStatus `json:"status,omitempty"`
+	Error      string             `json:"error,omitempty"`      // Set instead of Status when this person couldn't be checked
+	Incomplete bool               `json:"incomplete,omitempty"` // Status is the court's own answer; the prosecution service, which only knows emails, wasn't asked
+}
+type ProsecutionBatchResponse struct {
+	Results    []ProsecutionCheckResult `json:"results"`
+	Checked    int                      `json:"checked"`
+	Incomplete int                      `json:"incomplete"` // Of Checked, how many answered from the court alone
+	Failed     int                      `json:"failed"`
+}
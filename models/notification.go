@@ -0,0 +1,9 @@
+package Models
+
+// NotificationPreferences is how a user wants to be told about their
+// requests and cases. The zero value means every channel, in Serbian.
+type NotificationPreferences struct {
+	Language string   `bson:"language,omitempty" json:"language,omitempty"` // sr or en
+	Disabled []string `bson:"disabled,omitempty" json:"disabled,omitempty"` // Channels turned off: inapp, email
+	Muted    []string `bson:"muted,omitempty" json:"muted,omitempty"`       // Notification kinds not wanted at all
+}
@@ -0,0 +1,20 @@
+package Models
+
+type Revocation struct {
+	DocumentNumber string `bson:"documentNumber,omitempty" json:"document_number,omitempty"`
+	Reason         string `bson:"reason,omitempty" json:"reason,omitempty"`
+	RevokedBy      string `bson:"revokedBy,omitempty" json:"revoked_by,omitempty"`
+	RevokedAt      string `bson:"revokedAt,omitempty" json:"revoked_at,omitempty"`
+	ReplacedBy     string `bson:"replacedBy,omitempty" json:"replaced_by,omitempty"` // Number of the corrected document, if re-issued
+}
+type DocumentVerification struct {
+	Status       string `json:"status"` // valid, expired, revoked or not_found
+	Number       string `json:"number,omitempty"`
+	Type         string `json:"type,omitempty"`
+	IssuingCourt string `json:"issuing_court,omitempty"`
+	IssueDate    string `json:"issue_date,omitempty"`
+	ValidUntil   string `json:"valid_until,omitempty"`
+	Result       string `json:"result,omitempty"`
+	RevokedAt    string `json:"revoked_at,omitempty"`
+	ReplacedBy   string `json:"replaced_by,omitempty"`
+}
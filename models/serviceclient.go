@@ -0,0 +1,16 @@
+package Models
+
+type ServiceClient struct {
+	ClientID    string   `bson:"clientId,omitempty" json:"client_id,omitempty"`
+	Name        string   `bson:"name,omitempty" json:"name,omitempty"`                // Calling service (e.g. border, police)
+	Secret      string   `bson:"secret,omitempty" json:"-"`                           // HMAC signing key, returned only at issuance
+	Scopes      []string `bson:"scopes,omitempty" json:"scopes,omitempty"`            // Permissions granted to the client
+	CertSubject string   `bson:"certSubject,omitempty" json:"cert_subject,omitempty"` // Client certificate CN accepted instead of a signature
+	Revoked     bool     `bson:"revoked" json:"revoked"`
+	CreatedAt   string   `bson:"createdAt,omitempty" json:"created_at,omitempty"`
+	RevokedAt   string   `bson:"revokedAt,omitempty" json:"revoked_at,omitempty"`
+}
+type IssuedServiceClient struct {
+	ServiceClient
+	Secret string `json:"secret"`
+}
@@ -0,0 +1,36 @@
+package Models
+
+import "time"
+
+type Session struct {
+	ID          string    `bson:"id,omitempty" json:"id,omitempty"`
+	Email       string    `bson:"email,omitempty" json:"email,omitempty"`
+	Role        string    `bson:"role,omitempty" json:"role,omitempty"`
+	RefreshHash string    `bson:"refreshHash,omitempty" json:"-"`                  // SHA-256 of the current refresh token
+	AccessJti   string    `bson:"accessJti,omitempty" json:"-"`                    // jti of the last access token issued
+	AccessExp   time.Time `bson:"accessExp,omitempty" json:"-"`                    // Expiry of that access token
+	ExpiresAt   time.Time `bson:"expiresAt,omitempty" json:"expires_at,omitempty"` // Refresh token lifetime
+	Revoked     bool      `bson:"revoked" json:"revoked"`
+	CreatedAt   string    `bson:"createdAt,omitempty" json:"created_at,omitempty"`
+	RevokedAt   string    `bson:"revokedAt,omitempty" json:"revoked_at,omitempty"`
+}
+type RevokedToken struct {
+	Jti       string    `bson:"jti"`
+	ExpiresAt time.Time `bson:"expiresAt"` // Removed by a TTL index once the token would have expired anyway
+}
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// StreamTicket stands in for the jwt where a browser can't send headers,
+// as with EventSource and WebSocket. It is used once, within seconds, and
+// only its hash is stored.
+type StreamTicket struct {
+	Hash      string    `bson:"hash"`
+	Email     string    `bson:"email"`
+	Jti       string    `bson:"jti,omitempty"` // Of the access token it was issued for
+	TokenExp  time.Time `bson:"tokenExp"`      // When that token expires; so does the stream
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/outbox"
+	"github.com/EupravaProjekat/court/queue"
+	"github.com/EupravaProjekat/court/reminders"
+)
+
+// requestPending is a request still waiting for its outcome; nothing to
+// tell yet.
+const requestPending = "pending"
+
+// hearingChanges are the hearing statuses parties are told about.
+var hearingChanges = map[string]bool{
+	"delayed":   true,
+	"adjourned": true,
+	"cancelled": true,
+}
+
+// Sink is the outbox sink turning case and request events into
+// notifications.
+func (s *Service) Sink() outbox.Sink {
+	return &sink{s: s}
+}
+
+type sink struct {
+	s *Service
+}
+
+func (k *sink) Name() string { return "notifications" }
+
+func (k *sink) Deliver(ctx context.Context, m *outbox.Message) error {
+	in, err := k.s.intentFor(ctx, m)
+	if err != nil || in == nil {
+		return err
+	}
+	return k.s.Send(ctx, *in)
+}
+
+// intentFor decides who is told what about m; nil when nobody is.
+func (s *Service) intentFor(ctx context.Context, m *outbox.Message) (*Intent, error) {
+	switch m.AggregateType {
+	case "request":
+		var payload struct {
+			Email   string         `json:"email"`
+			Request Models.Request `json:"request"`
+		}
+		if err := json.Unmarshal(m.Payload, &payload); err != nil {
+			return nil, queue.Permanent(err)
+		}
+		if payload.Request.Status == requestPending {
+			return nil, nil
+		}
+		return &Intent{
+			Kind:     KindRequestOutcome,
+			SourceID: m.ID,
+			Emails:   []string{payload.Email},
+			Data:     Data{Request: &payload.Request, Link: s.cfg.AppURL + "/requests"},
+		}, nil
+	case "case":
+		var e caseevents.Event
+		if err := json.Unmarshal(m.Payload, &e); err != nil {
+			return nil, queue.Permanent(err)
+		}
+		var kind string
+		switch e.Type {
+		case caseevents.HearingScheduled, caseevents.HearingRescheduled, caseevents.HearingStatusChanged:
+			if e.Hearing == nil {
+				// Retrying can't fill in what the event lacks
+				return nil, queue.Permanent(fmt.Errorf("notify: %s %s carries no hearing", e.Type, m.ID))
+			}
+			kind = KindHearingSummons
+			if e.Type == caseevents.HearingStatusChanged {
+				if !hearingChanges[e.Hearing.Status] {
+					return nil, nil
+				}
+				kind = KindHearingChanged
+			}
+		case caseevents.VerdictIssued:
+			if e.Verdict == nil {
+				return nil, queue.Permanent(fmt.Errorf("notify: %s %s carries no verdict", e.Type, m.ID))
+			}
+			kind = KindVerdict
+		default:
+			return nil, nil
+		}
+		c, err := s.store.GetCase(ctx, m.AggregateID)
+		if err != nil {
+			return nil, err
+		}
+		if c.Unverified {
+			// Nobody is told about a citizen's filing until staff confirm it
+			return nil, nil
+		}
+		data := Data{Case: c, Hearing: e.Hearing, Verdict: e.Verdict, Link: s.cfg.AppURL + "/cases/" + c.ID}
+		if e.Type == caseevents.HearingStatusChanged {
+			// The event carries only the change; date and courtroom come
+			// from the case
+			for _, h := range c.Hearings {
+				if h.ID == e.Hearing.ID {
+					changed := h
+					changed.Status, changed.Note = e.Hearing.Status, e.Hearing.Note
+					data.Hearing = &changed
+				}
+			}
+		}
+		return &Intent{
+			Kind:      kind,
+			SourceID:  m.ID,
+			Emails:    append([]string{c.PlaintiffEmail, c.DefendantEmail}, c.LawyerEmails...),
+			Confirmed: c.ConfirmedEmails,
+			Data:      data,
+		}, nil
+	}
+	return nil, nil
+}
+
+// Remind sends the reminder for a job of the reminder scheduler. It
+// returns reminders.ErrStale when the hearing or deadline has since moved
+// or closed.
+func (s *Service) Remind(ctx context.Context, j *reminders.Job) error {
+	c, err := s.store.GetCase(ctx, j.CaseID)
+	if err != nil {
+		return err
+	}
+	in := Intent{
+		SourceID:  j.ID,
+		Emails:    append([]string{c.PlaintiffEmail, c.DefendantEmail}, c.LawyerEmails...),
+		Confirmed: c.ConfirmedEmails,
+		Data:      Data{Case: c, Link: s.cfg.AppURL + "/cases/" + c.ID},
+	}
+	switch j.Target {
+	case reminders.TargetHearing:
+		for _, h := range c.Hearings {
+			if h.ID == j.TargetID && remindable(h.Status, "", "scheduled", "delayed") && sameTime(h.Date, j.DueAt) {
+				hearing := h
+				in.Kind, in.Data.Hearing = KindHearingReminder, &hearing
+			}
+		}
+	case reminders.TargetDeadline:
+		for _, d := range c.Deadlines {
+			if d.ID == j.TargetID && remindable(d.Status, "", "open") && sameTime(d.Due, j.DueAt) {
+				deadline := d
+				in.Kind, in.Data.Deadline = KindDeadlineReminder, &deadline
+				// Only the party who must act, and the lawyers
+				switch d.Party {
+				case "plaintiff":
+					in.Emails = append([]string{c.PlaintiffEmail}, c.LawyerEmails...)
+				case "defendant":
+					in.Emails = append([]string{c.DefendantEmail}, c.LawyerEmails...)
+				}
+			}
+		}
+	}
+	if in.Kind == "" {
+		return reminders.ErrStale
+	}
+	return s.Send(ctx, in)
+}
+
+func remindable(status string, open ...string) bool {
+	for _, o := range open {
+		if status == o {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTime reports whether the RFC 3339 date s is at t.
+func sameTime(s string, t time.Time) bool {
+	parsed, err := time.Parse(time.RFC3339, s)
+	return err == nil && parsed.Equal(t)
+}
@@ -0,0 +1,315 @@
+// Package notify tells citizens what happens to their requests and cases.
+// Every notification lands in the user's in-app inbox and is also sent
+// over the other channels, such as email, they haven't turned off. It is
+// fed by the outbox through its sink; sending is retried with backoff and
+// tracked per channel.
+package notify
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/queue"
+	"github.com/google/uuid"
+)
+
+// Channels a notification can reach the user through. The inbox is the
+// stored notification itself.
+const (
+	ChannelInApp = "inapp"
+	ChannelEmail = "email"
+)
+
+// Kinds of notification, each with its own templates.
+const (
+	KindRequestOutcome   = "request.outcome"
+	KindHearingSummons   = "hearing.summons"
+	KindHearingChanged   = "hearing.changed"
+	KindVerdict          = "case.verdict"
+	KindHearingReminder  = "hearing.reminder"
+	KindDeadlineReminder = "deadline.reminder"
+)
+
+// Delivery states, tracked per channel.
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed" // Gave up after MaxAttempts
+)
+
+const (
+	LanguageSerbian = "sr"
+	LanguageEnglish = "en"
+)
+
+type Notification struct {
+	ID        string `bson:"id" json:"id"`
+	Email     string `bson:"email" json:"email"`
+	Kind      string `bson:"kind" json:"kind"`
+	Language  string `bson:"language" json:"language"`
+	Subject   string `bson:"subject" json:"subject"`
+	Body      string `bson:"body" json:"body"`
+	Link      string `bson:"link,omitempty" json:"link,omitempty"`
+	SourceID  string `bson:"sourceId" json:"source_id"` // What caused it; one notification per source, recipient and kind
+	InApp     bool   `bson:"inApp" json:"in_app"`       // Shown in the inbox
+	Read      bool   `bson:"read" json:"read"`
+	ReadAt    string `bson:"readAt,omitempty" json:"read_at,omitempty"`
+	CreatedAt string `bson:"createdAt" json:"created_at"`
+	// Sending over the other channels, by channel name
+	Deliveries map[string]*Delivery `bson:"deliveries" json:"deliveries"`
+}
+
+type Delivery struct {
+	Status        string    `bson:"status" json:"status"`
+	Attempts      int       `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time `bson:"nextAttemptAt" json:"next_attempt_at"`
+	LeaseUntil    time.Time `bson:"leaseUntil" json:"-"`
+	LastError     string    `bson:"lastError,omitempty" json:"last_error,omitempty"`
+	SentAt        time.Time `bson:"sentAt,omitempty" json:"sent_at,omitempty"`
+}
+
+// Recipient is whom a notification is for. People who are party to a case
+// without a court profile are not Known and only get email.
+type Recipient struct {
+	Email       string
+	Known       bool
+	Preferences Models.NotificationPreferences
+}
+
+// Wants reports whether the recipient takes kind over channel.
+func (r *Recipient) Wants(kind, channel string) bool {
+	if channel == ChannelInApp && !r.Known {
+		return false
+	}
+	for _, muted := range r.Preferences.Muted {
+		if muted == kind {
+			return false
+		}
+	}
+	for _, off := range r.Preferences.Disabled {
+		if off == channel {
+			return false
+		}
+	}
+	return true
+}
+
+// Language is the recipient's language, Serbian unless they chose English.
+func (r *Recipient) Language() string {
+	if r.Preferences.Language == LanguageEnglish {
+		return LanguageEnglish
+	}
+	return LanguageSerbian
+}
+
+// Intent asks for a notification of kind to each of Emails. Recipients
+// without a court profile are only emailed at addresses in Confirmed,
+// which court staff entered or checked.
+type Intent struct {
+	Kind      string
+	SourceID  string
+	Emails    []string
+	Confirmed []string
+	Data      Data
+}
+
+// Channel sends a notification outside the app.
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+type Store interface {
+	// Recipient never fails for an unknown email; it returns a Recipient
+	// that is not Known.
+	Recipient(ctx context.Context, email string) (*Recipient, error)
+	GetCase(ctx context.Context, id string) (*Models.Case, error)
+	// SaveNotifications skips notifications already saved for the same
+	// source, recipient and kind, so a repeated outbox delivery is harmless.
+	SaveNotifications(ctx context.Context, ns []*Notification) error
+	// ClaimDelivery leases the oldest due delivery over channel; nil, nil
+	// when none.
+	ClaimDelivery(ctx context.Context, channel string, now time.Time, lease time.Duration) (*Notification, error)
+	SaveDelivery(ctx context.Context, id, channel string, d *Delivery) error
+}
+
+type Config struct {
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Lease        time.Duration
+	Timeout      time.Duration  // Per send
+	AppURL       string         // Links in notifications point into the app
+	CourtName    string         // Signs the messages
+	TimeZone     *time.Location // Dates in messages are in the court's local time
+}
+
+// ConfigFromEnv reads NOTIFY_MAX_ATTEMPTS, NOTIFY_APP_URL and COURT_NAME,
+// defaulting the rest.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		PollInterval: 5 * time.Second,
+		MaxAttempts:  6,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   2 * time.Hour,
+		Lease:        time.Minute,
+		Timeout:      30 * time.Second,
+		AppURL:       "http://localhost:4200",
+		CourtName:    "Osnovni sud",
+		TimeZone:     time.Local,
+	}
+	if n, err := strconv.Atoi(os.Getenv("NOTIFY_MAX_ATTEMPTS")); err == nil && n > 0 {
+		cfg.MaxAttempts = n
+	}
+	if v := os.Getenv("NOTIFY_APP_URL"); v != "" {
+		cfg.AppURL = strings.TrimRight(v, "/")
+	}
+	if v := os.Getenv("COURT_NAME"); v != "" {
+		cfg.CourtName = v
+	}
+	return cfg
+}
+
+type Service struct {
+	store    Store
+	channels []Channel
+	cfg      Config
+	logger   *log.Logger
+	loops    map[string]*queue.Loop // By channel name
+}
+
+func New(store Store, channels []Channel, cfg Config, logger *log.Logger) *Service {
+	s := &Service{store: store, channels: channels, cfg: cfg, logger: logger, loops: map[string]*queue.Loop{}}
+	for _, ch := range channels {
+		ch := ch
+		s.loops[ch.Name()] = queue.NewLoop(cfg.PollInterval, func(ctx context.Context) bool {
+			return s.sendOne(ctx, ch)
+		})
+	}
+	return s
+}
+
+// Send renders and stores a notification for every recipient who wants
+// it, queueing it on their channels.
+func (s *Service) Send(ctx context.Context, in Intent) error {
+	in.Data.Court = s.cfg.CourtName
+	seen := map[string]bool{}
+	now := time.Now().UTC()
+	var notifications []*Notification
+	for _, email := range in.Emails {
+		if email == "" || seen[email] {
+			continue
+		}
+		seen[email] = true
+		r, err := s.store.Recipient(ctx, email)
+		if err != nil {
+			return err
+		}
+		if !r.Known && !contains(in.Confirmed, email) {
+			continue
+		}
+		n := &Notification{
+			ID:         uuid.New().String(),
+			Email:      email,
+			Kind:       in.Kind,
+			Language:   r.Language(),
+			Link:       in.Data.Link,
+			SourceID:   in.SourceID,
+			InApp:      r.Wants(in.Kind, ChannelInApp),
+			CreatedAt:  now.Format(time.RFC3339),
+			Deliveries: map[string]*Delivery{},
+		}
+		for _, ch := range s.channels {
+			if r.Wants(in.Kind, ch.Name()) {
+				n.Deliveries[ch.Name()] = &Delivery{Status: StatusPending, NextAttemptAt: now, LeaseUntil: now}
+			}
+		}
+		if !n.InApp && len(n.Deliveries) == 0 {
+			continue
+		}
+		if n.Subject, n.Body, err = render(in.Kind, n.Language, in.Data, s.cfg.TimeZone); err != nil {
+			// The same data renders the same way next time
+			return queue.Permanent(err)
+		}
+		notifications = append(notifications, n)
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	if err := s.store.SaveNotifications(ctx, notifications); err != nil {
+		return err
+	}
+	s.Notify()
+	return nil
+}
+
+// Notify wakes the senders, e.g. after a retry was queued.
+func (s *Service) Notify() {
+	for _, l := range s.loops {
+		l.Notify()
+	}
+}
+
+// Run sends due deliveries until ctx is done, one loop per channel.
+func (s *Service) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, l := range s.loops {
+		wg.Add(1)
+		go func(l *queue.Loop) {
+			defer wg.Done()
+			l.Run(ctx)
+		}(l)
+	}
+	wg.Wait()
+}
+
+// sendOne sends the next due notification over ch, reporting whether
+// there may be more.
+func (s *Service) sendOne(ctx context.Context, ch Channel) bool {
+	n, err := s.store.ClaimDelivery(ctx, ch.Name(), time.Now().UTC(), s.cfg.Lease)
+	if err != nil || n == nil {
+		if err != nil && ctx.Err() == nil {
+			s.logger.Printf("notify: claim for %s failed: %v\n", ch.Name(), err)
+		}
+		return false
+	}
+	d := n.Deliveries[ch.Name()]
+	sendCtx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	err = ch.Send(sendCtx, n)
+	cancel()
+	d.Attempts++
+	d.LeaseUntil = time.Time{}
+	if err == nil {
+		d.Status = StatusSent
+		d.SentAt = time.Now().UTC()
+		d.LastError = ""
+	} else {
+		d.LastError = err.Error()
+		d.NextAttemptAt = time.Now().UTC().Add(queue.Backoff{Base: s.cfg.BaseBackoff, Max: s.cfg.MaxBackoff}.Delay(d.Attempts))
+		if d.Attempts >= s.cfg.MaxAttempts {
+			d.Status = StatusFailed
+			s.logger.Printf("notify: %s to %s failed for good: %v\n", ch.Name(), n.Email, err)
+		}
+	}
+	if err := s.store.SaveDelivery(ctx, n.ID, ch.Name(), d); err != nil {
+		// The lease runs out and it is sent again
+		s.logger.Printf("notify: saving %s delivery of %s failed: %v\n", ch.Name(), n.ID, err)
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
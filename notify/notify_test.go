@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/outbox"
+	"github.com/EupravaProjekat/court/queue"
+)
+
+// memStore keeps notifications in memory; users are the known emails.
+type memStore struct {
+	users map[string]bool
+	cases map[string]*Models.Case
+	saved []*Notification
+}
+
+func (s *memStore) Recipient(ctx context.Context, email string) (*Recipient, error) {
+	return &Recipient{Email: email, Known: s.users[email]}, nil
+}
+func (s *memStore) GetCase(ctx context.Context, id string) (*Models.Case, error) {
+	return s.cases[id], nil
+}
+func (s *memStore) SaveNotifications(ctx context.Context, ns []*Notification) error {
+	s.saved = append(s.saved, ns...)
+	return nil
+}
+func (s *memStore) ClaimDelivery(ctx context.Context, channel string, now time.Time, lease time.Duration) (*Notification, error) {
+	return nil, nil
+}
+func (s *memStore) SaveDelivery(ctx context.Context, id, channel string, d *Delivery) error {
+	return nil
+}
+
+type nopChannel struct{}
+
+func (nopChannel) Name() string                                    { return ChannelEmail }
+func (nopChannel) Send(ctx context.Context, n *Notification) error { return nil }
+
+func newService(store *memStore) *Service {
+	cfg := ConfigFromEnv()
+	return New(store, []Channel{nopChannel{}}, cfg, log.New(io.Discard, "", 0))
+}
+
+func TestSendOnlyToVerifiedAddresses(t *testing.T) {
+	store := &memStore{users: map[string]bool{"citizen@example.com": true}}
+	s := newService(store)
+	verdict := &Models.Verdict{Outcome: "Acquitted", Date: "2024-03-01T10:00:00Z"}
+	err := s.Send(context.Background(), Intent{
+		Kind:      KindVerdict,
+		SourceID:  "m1",
+		Emails:    []string{"citizen@example.com", "typed-in@example.com", "staff-entered@example.com"},
+		Confirmed: []string{"staff-entered@example.com"},
+		Data:      Data{Case: &Models.Case{ID: "c1"}, Verdict: verdict},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, n := range store.saved {
+		got[n.Email] = true
+	}
+	if len(got) != 2 || !got["citizen@example.com"] || !got["staff-entered@example.com"] {
+		t.Fatalf("notified %v, want the court user and the confirmed address only", got)
+	}
+}
+
+func TestBrokenEventsArePermanent(t *testing.T) {
+	store := &memStore{cases: map[string]*Models.Case{"c1": {ID: "c1"}}}
+	s := newService(store)
+	payload, _ := json.Marshal(caseevents.Event{CaseID: "c1", Type: caseevents.HearingScheduled})
+	m := &outbox.Message{ID: "m1", AggregateType: "case", AggregateID: "c1", Payload: payload}
+	if err := s.Sink().Deliver(context.Background(), m); !queue.IsPermanent(err) {
+		t.Fatalf("Deliver() of a hearing event without a hearing = %v, want a permanent error", err)
+	}
+
+	err := s.Send(context.Background(), Intent{Kind: "no.such.kind", SourceID: "m2", Emails: []string{"a@example.com"}, Confirmed: []string{"a@example.com"}})
+	if !queue.IsPermanent(err) {
+		t.Fatalf("Send() with a template that can't render = %v, want a permanent error", err)
+	}
+}
@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	From     string
+	Username string // Empty for servers without authentication
+	Password string
+}
+
+// SMTPConfigFromEnv reads NOTIFY_SMTP_HOST, NOTIFY_SMTP_PORT,
+// NOTIFY_SMTP_FROM, NOTIFY_SMTP_USERNAME and NOTIFY_SMTP_PASSWORD. Email is
+// off unless a host is set; a local test server such as MailHog needs only
+// the host and port.
+func SMTPConfigFromEnv() (SMTPConfig, bool) {
+	cfg := SMTPConfig{
+		Host:     os.Getenv("NOTIFY_SMTP_HOST"),
+		Port:     "25",
+		From:     "sud@eprava.local",
+		Username: os.Getenv("NOTIFY_SMTP_USERNAME"),
+		Password: os.Getenv("NOTIFY_SMTP_PASSWORD"),
+	}
+	if v := os.Getenv("NOTIFY_SMTP_PORT"); v != "" {
+		cfg.Port = v
+	}
+	if v := os.Getenv("NOTIFY_SMTP_FROM"); v != "" {
+		cfg.From = v
+	}
+	return cfg, cfg.Host != ""
+}
+
+// SMTPChannel sends notifications as plain text email. It upgrades to TLS
+// when the server offers STARTTLS.
+type SMTPChannel struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPChannel(cfg SMTPConfig) *SMTPChannel {
+	return &SMTPChannel{cfg: cfg}
+}
+
+func (c *SMTPChannel) Name() string { return ChannelEmail }
+
+func (c *SMTPChannel) Send(ctx context.Context, n *Notification) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.cfg.Host, c.cfg.Port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, c.cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if c.cfg.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support authentication")
+		}
+		if err := client.Auth(smtp.PlainAuth("", c.cfg.Username, c.cfg.Password, c.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.cfg.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(n.Email); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(c.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message builds the email, base64 encoding the body so Serbian letters
+// survive any relay.
+func (c *SMTPChannel) message(n *Notification) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", c.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", n.Email)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", n.ID, c.cfg.From[strings.LastIndex(c.cfg.From, "@")+1:])
+	fmt.Fprintf(&buf, "Content-Language: %s\r\n", n.Language)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(n.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
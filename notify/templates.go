@@ -0,0 +1,247 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+)
+
+// Data is what the templates can show. Court is filled in by the service.
+type Data struct {
+	Request  *Models.Request
+	Case     *Models.Case
+	Hearing  *Models.Hearing
+	Verdict  *Models.Verdict
+	Deadline *Models.Deadline
+	Link     string
+	Court    string
+}
+
+// messageTemplate is a subject line and a body, in one language.
+type messageTemplate struct {
+	subject string
+	body    string
+}
+
+var messageTemplates = map[string]map[string]messageTemplate{
+	KindRequestOutcome: {
+		LanguageSerbian: {
+			subject: "Vaš zahtev je obrađen: {{label .Request.Status}}",
+			body: `Poštovani,
+
+vaš zahtev {{.Request.ID}} ima novi status: {{label .Request.Status}}.
+{{.Request.Description}}
+
+Detalji: {{.Link}}
+
+{{.Court}}`,
+		},
+		LanguageEnglish: {
+			subject: "Your request has been processed: {{label .Request.Status}}",
+			body: `Dear citizen,
+
+your request {{.Request.ID}} has a new status: {{label .Request.Status}}.
+{{.Request.Description}}
+
+Details: {{.Link}}
+
+{{.Court}}`,
+		},
+	},
+	KindHearingSummons: {
+		LanguageSerbian: {
+			subject: "Poziv na ročište u predmetu {{.Case.ID}}",
+			body: `Poštovani,
+
+pozivate se na ročište u predmetu {{.Case.ID}} koje će se održati {{date .Hearing.Date}} u sudnici {{.Hearing.Courtroom}}.
+
+Detalji: {{.Link}}
+
+{{.Court}}`,
+		},
+		LanguageEnglish: {
+			subject: "Summons to a hearing in case {{.Case.ID}}",
+			body: `Dear citizen,
+
+you are summoned to a hearing in case {{.Case.ID}}, to be held on {{date .Hearing.Date}} in courtroom {{.Hearing.Courtroom}}.
+
+Details: {{.Link}}
+
+{{.Court}}`,
+		},
+	},
+	KindHearingChanged: {
+		LanguageSerbian: {
+			subject: "Promena ročišta u predmetu {{.Case.ID}}",
+			body: `Poštovani,
+
+ročište u predmetu {{.Case.ID}} zakazano za {{date .Hearing.Date}} u sudnici {{.Hearing.Courtroom}}: {{label .Hearing.Status}}.
+{{- if .Hearing.Note}}
+Napomena: {{.Hearing.Note}}{{end}}
+
+Detalji: {{.Link}}
+
+{{.Court}}`,
+		},
+		LanguageEnglish: {
+			subject: "Change to a hearing in case {{.Case.ID}}",
+			body: `Dear citizen,
+
+the hearing in case {{.Case.ID}} set for {{date .Hearing.Date}} in courtroom {{.Hearing.Courtroom}} is {{label .Hearing.Status}}.
+{{- if .Hearing.Note}}
+Note: {{.Hearing.Note}}{{end}}
+
+Details: {{.Link}}
+
+{{.Court}}`,
+		},
+	},
+	KindVerdict: {
+		LanguageSerbian: {
+			subject: "Doneta je odluka u predmetu {{.Case.ID}}",
+			body: `Poštovani,
+
+sud je {{date .Verdict.Date}} doneo odluku u predmetu {{.Case.ID}}: {{label .Verdict.Outcome}}.
+
+Odluka je dostupna na: {{.Link}}
+
+{{.Court}}`,
+		},
+		LanguageEnglish: {
+			subject: "A decision was issued in case {{.Case.ID}}",
+			body: `Dear citizen,
+
+on {{date .Verdict.Date}} the court issued its decision in case {{.Case.ID}}: {{label .Verdict.Outcome}}.
+
+The decision is available at: {{.Link}}
+
+{{.Court}}`,
+		},
+	},
+	KindHearingReminder: {
+		LanguageSerbian: {
+			subject: "Podsetnik: ročište u predmetu {{.Case.ID}} {{date .Hearing.Date}}",
+			body: `Poštovani,
+
+podsećamo vas da je ročište u predmetu {{.Case.ID}} zakazano za {{date .Hearing.Date}} u sudnici {{.Hearing.Courtroom}}.
+
+Detalji: {{.Link}}
+
+{{.Court}}`,
+		},
+		LanguageEnglish: {
+			subject: "Reminder: hearing in case {{.Case.ID}} on {{date .Hearing.Date}}",
+			body: `Dear citizen,
+
+this is a reminder that the hearing in case {{.Case.ID}} is set for {{date .Hearing.Date}} in courtroom {{.Hearing.Courtroom}}.
+
+Details: {{.Link}}
+
+{{.Court}}`,
+		},
+	},
+	KindDeadlineReminder: {
+		LanguageSerbian: {
+			subject: "Podsetnik: rok u predmetu {{.Case.ID}} ističe {{date .Deadline.Due}}",
+			body: `Poštovani,
+
+podsećamo vas da rok „{{.Deadline.Title}}“ u predmetu {{.Case.ID}} ističe {{date .Deadline.Due}}.
+
+Detalji: {{.Link}}
+
+{{.Court}}`,
+		},
+		LanguageEnglish: {
+			subject: "Reminder: deadline in case {{.Case.ID}} runs out on {{date .Deadline.Due}}",
+			body: `Dear citizen,
+
+this is a reminder that the deadline "{{.Deadline.Title}}" in case {{.Case.ID}} runs out on {{date .Deadline.Due}}.
+
+Details: {{.Link}}
+
+{{.Court}}`,
+		},
+	},
+}
+
+// labels translates the statuses and outcomes the templates show.
+var labels = map[string]map[string]string{
+	LanguageSerbian: {
+		"resolved":  "rešen",
+		"failed":    "nije obrađen",
+		"timed_out": "nije obrađen na vreme",
+		"delayed":   "kasni",
+		"adjourned": "odloženo",
+		"cancelled": "otkazano",
+		"Convicted": "osuđujuća presuda",
+		"Acquitted": "oslobađajuća presuda",
+		"Dismissed": "odbačeno",
+	},
+	LanguageEnglish: {
+		"resolved":  "resolved",
+		"failed":    "not processed",
+		"timed_out": "not processed in time",
+		"delayed":   "running late",
+		"adjourned": "adjourned",
+		"cancelled": "cancelled",
+		"Convicted": "convicted",
+		"Acquitted": "acquitted",
+		"Dismissed": "dismissed",
+	},
+}
+
+var dateLayouts = map[string]string{
+	LanguageSerbian: "02.01.2006. u 15:04",
+	LanguageEnglish: "2 January 2006 at 15:04",
+}
+
+// render fills in the kind's templates in language, falling back to
+// Serbian, with dates in loc.
+func render(kind, language string, data Data, loc *time.Location) (subject, body string, err error) {
+	byLanguage, ok := messageTemplates[kind]
+	if !ok {
+		return "", "", fmt.Errorf("notify: no templates for %q", kind)
+	}
+	tmpl, ok := byLanguage[language]
+	if !ok {
+		language = LanguageSerbian
+		tmpl = byLanguage[language]
+	}
+	funcs := template.FuncMap{
+		"label": func(s string) string {
+			if l, ok := labels[language][s]; ok {
+				return l
+			}
+			return s
+		},
+		"date": func(s string) string {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return s
+			}
+			return t.In(loc).Format(dateLayouts[language])
+		},
+	}
+	if subject, err = execute(kind+".subject", tmpl.subject, funcs, data); err != nil {
+		return "", "", err
+	}
+	if body, err = execute(kind+".body", tmpl.body, funcs, data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subject), body, nil
+}
+func execute(name, text string, funcs template.FuncMap, data Data) (string, error) {
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,241 @@
+// Package outbox delivers domain events to other services at least once.
+// Events are written to an outbox collection in the same transaction as the
+// state change they describe; a dispatcher then hands them to each sink,
+// retrying with backoff and dead-lettering what keeps failing.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/EupravaProjekat/court/queue"
+	"github.com/google/uuid"
+)
+
+// Delivery states, tracked per sink.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+type Message struct {
+	ID            string               `bson:"id" json:"id"`
+	Seq           int64                `bson:"seq" json:"seq"` // Global order, assigned on commit
+	Type          string               `bson:"type" json:"type"`
+	AggregateType string               `bson:"aggregateType" json:"aggregate_type"`
+	AggregateID   string               `bson:"aggregateId" json:"aggregate_id"`
+	OccurredAt    string               `bson:"occurredAt" json:"occurred_at"`
+	Payload       json.RawMessage      `bson:"payload" json:"payload"`
+	Deliveries    map[string]*Delivery `bson:"deliveries" json:"deliveries"` // By sink name
+}
+
+type Delivery struct {
+	Status        string    `bson:"status" json:"status"`
+	Attempts      int       `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time `bson:"nextAttemptAt" json:"next_attempt_at"`
+	LeaseUntil    time.Time `bson:"leaseUntil" json:"-"`
+	LastError     string    `bson:"lastError,omitempty" json:"last_error,omitempty"`
+	DeliveredAt   time.Time `bson:"deliveredAt,omitempty" json:"delivered_at,omitempty"`
+}
+
+// Sink receives messages. Deliver may see a message more than once, so
+// sinks and their consumers must be idempotent on Message.ID.
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, m *Message) error
+}
+
+// Store is where the dispatcher finds and settles deliveries.
+type Store interface {
+	// Claim leases the oldest due delivery for sink, skipping aggregates
+	// with an earlier delivery to sink still pending; nil, nil when none.
+	Claim(ctx context.Context, sink string, now time.Time, lease time.Duration) (*Message, error)
+	Settle(ctx context.Context, id, sink string, d *Delivery) error
+	// Prune deletes messages delivered to every sink before cutoff.
+	Prune(ctx context.Context, sinks []string, cutoff time.Time) (int64, error)
+}
+
+type Config struct {
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Lease        time.Duration // How long a claimed delivery is hidden from other dispatchers
+	Timeout      time.Duration // Per delivery attempt
+	Retention    time.Duration // How long delivered messages stay for the event stream to replay
+}
+
+// ConfigFromEnv reads OUTBOX_POLL_INTERVAL, OUTBOX_MAX_ATTEMPTS,
+// OUTBOX_MAX_BACKOFF and OUTBOX_RETENTION, defaulting the rest.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		PollInterval: 2 * time.Second,
+		MaxAttempts:  10,
+		BaseBackoff:  5 * time.Second,
+		MaxBackoff:   time.Hour,
+		Lease:        time.Minute,
+		Timeout:      10 * time.Second,
+		Retention:    7 * 24 * time.Hour,
+	}
+	if d, err := time.ParseDuration(os.Getenv("OUTBOX_POLL_INTERVAL")); err == nil && d > 0 {
+		cfg.PollInterval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS")); err == nil && n > 0 {
+		cfg.MaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("OUTBOX_MAX_BACKOFF")); err == nil && d > 0 {
+		cfg.MaxBackoff = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("OUTBOX_RETENTION")); err == nil && d > 0 {
+		cfg.Retention = d
+	}
+	return cfg
+}
+
+type Dispatcher struct {
+	store  Store
+	sinks  []Sink
+	cfg    Config
+	logger *log.Logger
+
+	loops map[string]*queue.Loop // By sink name
+}
+
+func New(store Store, sinks []Sink, cfg Config, logger *log.Logger) *Dispatcher {
+	d := &Dispatcher{store: store, sinks: sinks, cfg: cfg, logger: logger, loops: map[string]*queue.Loop{}}
+	for _, s := range sinks {
+		s := s
+		d.loops[s.Name()] = queue.NewLoop(cfg.PollInterval, func(ctx context.Context) bool {
+			return d.dispatchOne(ctx, s)
+		})
+	}
+	return d
+}
+
+// Sinks names the registered sinks.
+func (d *Dispatcher) Sinks() []string {
+	names := make([]string, len(d.sinks))
+	for i, s := range d.sinks {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// NewMessage builds a message with a pending delivery for every sink. It
+// gets its Seq when the store commits it.
+func (d *Dispatcher) NewMessage(msgType, aggregateType, aggregateID string, payload interface{}) (*Message, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	m := &Message{
+		ID:            uuid.New().String(),
+		Type:          msgType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		OccurredAt:    now.Format(time.RFC3339Nano),
+		Payload:       raw,
+		Deliveries:    map[string]*Delivery{},
+	}
+	for _, s := range d.sinks {
+		m.Deliveries[s.Name()] = &Delivery{Status: StatusPending, NextAttemptAt: now, LeaseUntil: now}
+	}
+	return m, nil
+}
+
+// Notify wakes the dispatcher after a commit instead of waiting for the
+// next poll.
+func (d *Dispatcher) Notify() {
+	for _, l := range d.loops {
+		l.Notify()
+	}
+}
+
+// Run dispatches until ctx is done, one loop per sink so a slow sink does
+// not hold back the others, and prunes delivered messages hourly.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range d.sinks {
+		wg.Add(1)
+		go func(l *queue.Loop) {
+			defer wg.Done()
+			l.Run(ctx)
+		}(d.loops[s.Name()])
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.runPrune(ctx)
+	}()
+	wg.Wait()
+}
+func (d *Dispatcher) runPrune(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		n, err := d.store.Prune(ctx, d.Sinks(), time.Now().UTC().Add(-d.cfg.Retention))
+		if err != nil && !errors.Is(err, context.Canceled) {
+			d.logger.Printf("outbox: pruning failed: %v\n", err)
+		} else if n > 0 {
+			d.logger.Printf("outbox: pruned %d delivered messages\n", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchOne delivers the next due message to s, reporting whether there
+// may be more. A sink's queue.Permanent error dead-letters the message at
+// once.
+func (d *Dispatcher) dispatchOne(ctx context.Context, s Sink) bool {
+	now := time.Now().UTC()
+	m, err := d.store.Claim(ctx, s.Name(), now, d.cfg.Lease)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			d.logger.Printf("outbox: claim for %s failed: %v\n", s.Name(), err)
+		}
+		return false
+	}
+	if m == nil {
+		return false
+	}
+	delivery := m.Deliveries[s.Name()]
+	attemptCtx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	err = s.Deliver(attemptCtx, m)
+	cancel()
+
+	delivery.Attempts++
+	delivery.LeaseUntil = time.Time{}
+	if err == nil {
+		delivery.Status = StatusDelivered
+		delivery.DeliveredAt = time.Now().UTC()
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = time.Now().UTC().Add(d.backoff().Delay(delivery.Attempts))
+		if delivery.Attempts >= d.cfg.MaxAttempts || queue.IsPermanent(err) {
+			delivery.Status = StatusDead
+			d.logger.Printf("outbox: %s %s dead-lettered for %s: %v\n", m.Type, m.ID, s.Name(), err)
+		}
+	}
+	if err := d.store.Settle(ctx, m.ID, s.Name(), delivery); err != nil {
+		// The lease runs out and the message is delivered again
+		d.logger.Printf("outbox: settling %s for %s failed: %v\n", m.ID, s.Name(), err)
+	}
+	return true
+}
+
+func (d *Dispatcher) backoff() queue.Backoff {
+	return queue.Backoff{Base: d.cfg.BaseBackoff, Max: d.cfg.MaxBackoff}
+}
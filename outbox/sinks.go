@@ -0,0 +1,96 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/EupravaProjekat/court/serviceauth"
+)
+
+// LogSink writes messages to the log; useful in development.
+type LogSink struct {
+	Logger *log.Logger
+}
+
+func (s *LogSink) Name() string { return "log" }
+
+func (s *LogSink) Deliver(ctx context.Context, m *Message) error {
+	s.Logger.Printf("outbox: %d %s %s/%s\n", m.Seq, m.Type, m.AggregateType, m.AggregateID)
+	return nil
+}
+
+// HTTPSink posts each message as JSON to a fixed URL, signed like every
+// other service-to-service call. Any 2xx answer counts as delivered.
+type HTTPSink struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	Client       *http.Client
+}
+
+func (s *HTTPSink) Name() string { return "http" }
+
+func (s *HTTPSink) Deliver(ctx context.Context, m *Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", m.ID)
+	if s.ClientID != "" {
+		serviceauth.Sign(req, s.ClientID, s.ClientSecret, body)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %d", s.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// SinksFromEnv builds the sinks named in OUTBOX_SINKS (comma separated,
+// default "log"). The http sink posts to OUTBOX_HTTP_URL and signs with
+// COURT_SERVICE_CLIENT_ID and COURT_SERVICE_CLIENT_SECRET.
+func SinksFromEnv(logger *log.Logger) ([]Sink, error) {
+	names := os.Getenv("OUTBOX_SINKS")
+	if names == "" {
+		names = "log"
+	}
+	var sinks []Sink
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "log":
+			sinks = append(sinks, &LogSink{Logger: logger})
+		case "http":
+			url := os.Getenv("OUTBOX_HTTP_URL")
+			if url == "" {
+				return nil, errors.New("outbox: http sink needs OUTBOX_HTTP_URL")
+			}
+			sinks = append(sinks, &HTTPSink{
+				URL:          url,
+				ClientID:     os.Getenv("COURT_SERVICE_CLIENT_ID"),
+				ClientSecret: os.Getenv("COURT_SERVICE_CLIENT_SECRET"),
+				Client:       &http.Client{},
+			})
+		case "":
+		default:
+			return nil, errors.New("outbox: unknown sink " + strconv.Quote(name))
+		}
+	}
+	return sinks, nil
+}
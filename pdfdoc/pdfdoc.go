@@ -0,0 +1,120 @@
+// Package pdfdoc renders court documents to PDF in pure Go. Text is set in
+// the embedded Go fonts, which cover Serbian Cyrillic and Latin diacritics.
+package pdfdoc
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+const fontFamily = "go"
+
+// Field is a labelled value printed in the document's data table.
+type Field struct {
+	Label string
+	Value string
+}
+
+// Document is the layout every court document shares: a court header, a
+// title, a data table, body paragraphs, a signature line and an optional
+// QR code linking to the document's verification page.
+type Document struct {
+	Court      string
+	Title      string
+	Number     string
+	Fields     []Field
+	Paragraphs []string
+	SignedBy   string
+	VerifyURL  string
+	IssuedAt   time.Time
+}
+
+// Render writes doc to w as a PDF.
+func Render(w io.Writer, doc Document) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(fontFamily, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(fontFamily, "B", gobold.TTF)
+	pdf.SetTitle(doc.Title, true)
+	pdf.SetCreator(doc.Court, true)
+	if !doc.IssuedAt.IsZero() {
+		pdf.SetCreationDate(doc.IssuedAt)
+	}
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont(fontFamily, "", 8)
+		footer := doc.Court
+		if doc.Number != "" {
+			footer += " · " + doc.Number
+		}
+		pdf.CellFormat(0, 10, footer, "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// Header
+	pdf.SetFont(fontFamily, "B", 12)
+	pdf.CellFormat(0, 6, "REPUBLIKA SRBIJA", "", 1, "L", false, 0, "")
+	pdf.CellFormat(0, 6, doc.Court, "", 1, "L", false, 0, "")
+	pdf.SetFont(fontFamily, "", 10)
+	if doc.Number != "" {
+		pdf.CellFormat(0, 6, "Broj: "+doc.Number, "", 1, "L", false, 0, "")
+	}
+	if !doc.IssuedAt.IsZero() {
+		pdf.CellFormat(0, 6, "Datum: "+doc.IssuedAt.Format("02.01.2006."), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(10)
+
+	// Title
+	pdf.SetFont(fontFamily, "B", 16)
+	pdf.MultiCell(0, 8, doc.Title, "", "C", false)
+	pdf.Ln(6)
+
+	// Data table
+	for _, f := range doc.Fields {
+		pdf.SetFont(fontFamily, "B", 10)
+		pdf.CellFormat(55, 7, f.Label, "1", 0, "L", false, 0, "")
+		pdf.SetFont(fontFamily, "", 10)
+		pdf.MultiCell(0, 7, f.Value, "1", "L", false)
+	}
+	pdf.Ln(6)
+
+	// Body
+	pdf.SetFont(fontFamily, "", 11)
+	for _, p := range doc.Paragraphs {
+		pdf.MultiCell(0, 6, p, "", "J", false)
+		pdf.Ln(3)
+	}
+
+	// Signature and verification block
+	pdf.Ln(12)
+	top := pdf.GetY()
+	if doc.VerifyURL != "" {
+		png, err := qrcode.Encode(doc.VerifyURL, qrcode.Medium, 256)
+		if err != nil {
+			return err
+		}
+		opts := fpdf.ImageOptions{ImageType: "PNG"}
+		pdf.RegisterImageOptionsReader("qr", opts, bytes.NewReader(png))
+		pdf.ImageOptions("qr", 20, top, 35, 35, false, opts, 0, doc.VerifyURL)
+		pdf.SetXY(20, top+36)
+		pdf.SetFont(fontFamily, "", 7)
+		pdf.MultiCell(80, 4, "Proverite dokument: "+doc.VerifyURL, "", "L", false)
+	}
+	if doc.SignedBy != "" {
+		pdf.SetXY(120, top+10)
+		pdf.SetFont(fontFamily, "", 10)
+		pdf.CellFormat(70, 6, "______________________", "", 2, "C", false, 0, "")
+		pdf.CellFormat(70, 6, doc.SignedBy, "", 2, "C", false, 0, "")
+	}
+
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+	return pdf.Output(w)
+}
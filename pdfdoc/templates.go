@@ -0,0 +1,248 @@
+package pdfdoc
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+)
+
+// Body text of each document type, in Serbian.
+var bodies = template.Must(template.New("bodies").Parse(`
+{{define "certificate"}}Na osnovu evidencije suda i podataka nadležnog tužilaštva, ovim se potvrđuje da {{if .ProceedingsConducted}}se protiv lica {{.HolderName}} (JMBG {{.HolderNationalID}}) vodi krivični postupak{{else}}se protiv lica {{.HolderName}} (JMBG {{.HolderNationalID}}) ne vodi krivični postupak{{end}}.
+Uverenje se izdaje na lični zahtev i važi do {{.ValidUntil}}.{{end}}
+{{define "summons"}}Poziva se {{.Party}} da pristupi ovom sudu {{.Hearing}} radi održavanja ročišta u predmetu broj {{.Case.ID}}.
+Ukoliko uredno pozvano lice ne pristupi, a izostanak ne opravda, sud može preduzeti mere propisane zakonom.{{end}}
+{{define "hearingNotice"}}Obaveštavaju se stranke i punomoćnici da je u predmetu broj {{.Case.ID}} ({{.Case.Plaintiff}} protiv {{.Case.Defendant}}) zakazano ročište {{.Hearing}}.{{end}}
+{{define "decision"}}Sud je u predmetu broj {{.Case.ID}}, vrste {{.Case.Type}}, doneo odluku: {{.Outcome}}.
+{{if .Verdict.Summary}}Obrazloženje: {{.Verdict.Summary}}{{end}}{{end}}
+{{define "custody"}}Lanac čuvanja dokaza "{{.Evidence.Description}}" u predmetu broj {{.Evidence.CaseID}}, prema evidenciji suda:
+{{range .Entries}}{{.Seq}}. {{.When}} – {{.Action}}{{if .From}}, od: {{.From}}{{end}}{{if .To}}, preuzeo: {{.To}}{{end}}{{if .Location}}, mesto čuvanja: {{.Location}}{{end}}{{if .Seal}}, plomba: {{.Seal}}{{end}}{{if .Note}} ({{.Note}}){{end}}. Potpisao {{.ActedBy}}, potpis {{.Check}}.
+{{else}}Za dokaz još nije upisana nijedna primopredaja.
+{{end}}{{end}}
+`))
+
+// outcomes are the Serbian wording of verdict outcomes.
+var outcomes = map[string]string{
+	"Convicted": "optuženi se oglašava krivim",
+	"Acquitted": "optuženi se oslobađa od optužbe",
+	"Dismissed": "optužba se odbija",
+}
+
+func body(name string, data interface{}) ([]string, error) {
+	var buf bytes.Buffer
+	if err := bodies.ExecuteTemplate(&buf, name, data); err != nil {
+		return nil, err
+	}
+	return splitParagraphs(buf.String()), nil
+}
+
+func splitParagraphs(s string) []string {
+	var out []string
+	for _, p := range bytes.Split([]byte(s), []byte("\n")) {
+		if t := string(bytes.TrimSpace(p)); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func formatDate(s string) string {
+	if t := parseTime(s); !t.IsZero() {
+		return t.Format("02.01.2006.")
+	}
+	return s
+}
+
+// custodyActions are the Serbian names of custody log actions.
+var custodyActions = map[string]string{
+	"received":    "prijem",
+	"transferred": "predaja",
+	"returned":    "vraćanje",
+	"destroyed":   "uništenje",
+}
+
+// Certificate lays out a certificate of (no) criminal proceedings.
+func Certificate(c *Models.Certificate, verifyURL string) (Document, error) {
+	data := *c
+	data.ValidUntil = formatDate(c.ValidUntil)
+	paragraphs, err := body("certificate", data)
+	if err != nil {
+		return Document{}, err
+	}
+	return Document{
+		Court:  c.IssuingCourt,
+		Title:  "UVERENJE\no (ne)vođenju krivičnog postupka",
+		Number: c.Number,
+		Fields: []Field{
+			{"Ime i prezime", c.HolderName},
+			{"JMBG", c.HolderNationalID},
+			{"Rezultat provere", c.Result},
+			{"Datum izdavanja", formatDate(c.IssueDate)},
+			{"Važi do", formatDate(c.ValidUntil)},
+		},
+		Paragraphs: paragraphs,
+		SignedBy:   "Ovlašćeno lice suda",
+		VerifyURL:  verifyURL,
+		IssuedAt:   parseTime(c.IssueDate),
+	}, nil
+}
+
+type hearingData struct {
+	Case    *Models.Case
+	Party   string
+	Hearing string
+}
+
+// hearingText says when and where a hearing is held, in the court's time
+// zone loc.
+func hearingText(h *Models.Hearing, loc *time.Location) string {
+	text := h.Date
+	if t := parseTime(h.Date); !t.IsZero() {
+		text = t.In(loc).Format("02.01.2006. u 15:04")
+	}
+	if h.Courtroom != "" {
+		text += ", sudnica " + h.Courtroom
+	}
+	return text
+}
+
+// Summons lays out a summons of one party to a hearing, its time given in
+// loc.
+func Summons(court string, loc *time.Location, c *Models.Case, party string, h *Models.Hearing) (Document, error) {
+	hearing := hearingText(h, loc)
+	paragraphs, err := body("summons", hearingData{Case: c, Party: party, Hearing: hearing})
+	if err != nil {
+		return Document{}, err
+	}
+	return Document{
+		Court:  court,
+		Title:  "POZIV",
+		Number: c.ID,
+		Fields: []Field{
+			{"Predmet", c.ID},
+			{"Vrsta predmeta", c.Type},
+			{"Pozvano lice", party},
+			{"Ročište", hearing},
+			{"Sudija", c.Judge},
+		},
+		Paragraphs: paragraphs,
+		SignedBy:   c.Judge,
+		IssuedAt:   time.Now(),
+	}, nil
+}
+
+// HearingNotice lays out a notice of a scheduled hearing for all parties,
+// its time given in loc.
+func HearingNotice(court string, loc *time.Location, c *Models.Case, h *Models.Hearing) (Document, error) {
+	hearing := hearingText(h, loc)
+	paragraphs, err := body("hearingNotice", hearingData{Case: c, Hearing: hearing})
+	if err != nil {
+		return Document{}, err
+	}
+	return Document{
+		Court:  court,
+		Title:  "OBAVEŠTENJE O ROČIŠTU",
+		Number: c.ID,
+		Fields: []Field{
+			{"Predmet", c.ID},
+			{"Tužilac", c.Plaintiff},
+			{"Tuženi / okrivljeni", c.Defendant},
+			{"Ročište", hearing},
+		},
+		Paragraphs: paragraphs,
+		SignedBy:   c.Judge,
+		IssuedAt:   time.Now(),
+	}, nil
+}
+
+// Decision lays out the court's decision in a case.
+func Decision(court string, c *Models.Case) (Document, error) {
+	outcome := outcomes[c.Verdict.Outcome]
+	if outcome == "" {
+		outcome = c.Verdict.Outcome
+	}
+	data := struct {
+		Case    *Models.Case
+		Verdict *Models.Verdict
+		Outcome string
+	}{c, c.Verdict, outcome}
+	paragraphs, err := body("decision", data)
+	if err != nil {
+		return Document{}, err
+	}
+	return Document{
+		Court:  court,
+		Title:  "PRESUDA",
+		Number: c.ID,
+		Fields: []Field{
+			{"Predmet", c.ID},
+			{"Tužilac", c.Plaintiff},
+			{"Okrivljeni", c.Defendant},
+			{"Sudija", c.Verdict.Judge},
+			{"Datum odluke", formatDate(c.Verdict.Date)},
+		},
+		Paragraphs: paragraphs,
+		SignedBy:   c.Verdict.Judge,
+		IssuedAt:   parseTime(c.Verdict.Date),
+	}, nil
+}
+
+type custodyLine struct {
+	Seq                                  int
+	When, Action, From, To               string
+	Location, Seal, Note, ActedBy, Check string
+}
+
+// CustodyReport lays out the full chain of custody of an evidence item.
+// signatureOK tells, per entry, whether its signature verified. Times are
+// given in loc.
+func CustodyReport(court string, loc *time.Location, e *Models.Evidence, entries []*Models.CustodyEntry, signatureOK []bool) (Document, error) {
+	lines := make([]custodyLine, len(entries))
+	for i, entry := range entries {
+		check := "ispravan"
+		if !signatureOK[i] {
+			check = "NEISPRAVAN"
+		}
+		action := custodyActions[entry.Action]
+		if action == "" {
+			action = entry.Action
+		}
+		when := entry.ActedAt
+		if t := parseTime(entry.ActedAt); !t.IsZero() {
+			when = t.In(loc).Format("02.01.2006. 15:04")
+		}
+		lines[i] = custodyLine{entry.Seq, when, action, entry.FromHolder, entry.ToHolder,
+			entry.Location, entry.SealNumber, entry.Note, entry.ActedBy, check}
+	}
+	data := struct {
+		Evidence *Models.Evidence
+		Entries  []custodyLine
+	}{e, lines}
+	paragraphs, err := body("custody", data)
+	if err != nil {
+		return Document{}, err
+	}
+	return Document{
+		Court:  court,
+		Title:  "IZVEŠTAJ O LANCU ČUVANJA DOKAZA",
+		Number: e.ID,
+		Fields: []Field{
+			{"Predmet", e.CaseID},
+			{"Dokaz", e.Description},
+			{"Vrsta", e.Type},
+			{"Trenutno kod", e.CurrentHolder},
+			{"Mesto čuvanja", e.StorageLocation},
+			{"Broj plombe", e.SealNumber},
+		},
+		Paragraphs: paragraphs,
+		SignedBy:   "Ovlašćeno lice suda",
+		IssuedAt:   time.Now(),
+	}, nil
+}
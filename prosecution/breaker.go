@@ -0,0 +1,87 @@
+package prosecution
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// breaker is a consecutive-failure circuit breaker. After threshold failures
+// it opens for cooldown, then lets a single probe through (half-open); the
+// probe's outcome closes or re-opens it.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+	lastErr   error // Latest failure, reported while open
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may go out now.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *breaker) failure(now time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastErr = err
+	b.failures++
+	b.probing = false
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
+
+// openError is ErrCircuitOpen wrapping the failure that keeps the circuit
+// open, so callers still see what went wrong.
+func (b *breaker) openError() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lastErr == nil {
+		return ErrCircuitOpen
+	}
+	return fmt.Errorf("%w: %w", ErrCircuitOpen, b.lastErr)
+}
+
+// abandon releases a half-open probe whose outcome is unknown.
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State is reported for diagnostics: "closed", "open" or "half-open".
+func (b *breaker) state(now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.threshold <= 0 || b.failures < b.threshold:
+		return "closed"
+	case now.Before(b.openUntil):
+		return "open"
+	}
+	return "half-open"
+}
@@ -0,0 +1,70 @@
+package prosecution
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(2, time.Minute)
+	failed := errors.New("connection refused")
+
+	b.failure(now, failed)
+	if !b.allow(now) || b.state(now) != "closed" {
+		t.Fatalf("opened after one failure of two")
+	}
+	b.failure(now, failed)
+	if b.allow(now) || b.state(now) != "open" {
+		t.Fatalf("still closed after reaching the threshold")
+	}
+	if err := b.openError(); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, failed) {
+		t.Fatalf("openError() = %v, want it to wrap both ErrCircuitOpen and the failure", err)
+	}
+
+	later := now.Add(time.Minute)
+	if b.state(later) != "half-open" || !b.allow(later) {
+		t.Fatalf("no probe let through after the cooldown")
+	}
+	if b.allow(later) {
+		t.Fatalf("a second probe was let through while the first is out")
+	}
+	b.failure(later, failed)
+	if b.allow(later.Add(time.Second)) {
+		t.Fatalf("a failed probe didn't re-open the circuit")
+	}
+
+	after := later.Add(2 * time.Minute)
+	if !b.allow(after) {
+		t.Fatalf("no probe after the second cooldown")
+	}
+	b.success()
+	if !b.allow(after) || !b.allow(after) || b.state(after) != "closed" {
+		t.Fatalf("a successful probe didn't close the circuit")
+	}
+}
+
+func TestBreakerAbandon(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(1, time.Second)
+	b.failure(now, errors.New("down"))
+	later := now.Add(time.Second)
+	if !b.allow(later) {
+		t.Fatal("no probe after the cooldown")
+	}
+	b.abandon()
+	if !b.allow(later) {
+		t.Fatal("an abandoned probe kept the circuit blocked")
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		b.failure(time.Now(), errors.New("down"))
+	}
+	if !b.allow(time.Now()) {
+		t.Fatal("a breaker with no threshold opened")
+	}
+}
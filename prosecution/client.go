@@ -0,0 +1,276 @@
+// Package prosecution is a typed client for the external prosecution
+// service that the court asks whether people and cases are under
+// prosecution.
+package prosecution
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EupravaProjekat/court/serviceauth"
+)
+
+const (
+	pathProsecute  = "/prosecute"
+	pathCaseStatus = "/casestatus"
+	pathSubmitCase = "/casestatus/async"
+)
+
+// ErrCircuitOpen is returned without calling out while the service is
+// considered down. It wraps the failure that opened the circuit.
+var ErrCircuitOpen = errors.New("prosecution service circuit open")
+
+// HeaderCallerToken carries the jwt of the user a call is made for, so
+// the service can tell whom the court is asking on behalf of.
+const HeaderCallerToken = "jwt"
+
+type callerTokenKey struct{}
+
+// WithCallerToken makes calls made with ctx forward the user's jwt.
+func WithCallerToken(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, callerTokenKey{}, token)
+}
+
+// StatusError is returned for non-2xx answers.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("prosecution service returned %d: %s", e.Code, e.Body)
+}
+
+// DecodeError is returned when a 2xx answer can't be parsed.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "invalid prosecution service response: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+type Config struct {
+	BaseURL          string
+	Timeout          time.Duration // Per attempt, on top of the caller's context
+	MaxRetries       int           // Extra attempts for idempotent calls
+	Backoff          time.Duration // Initial retry delay, doubled each attempt
+	BreakerThreshold int           // Consecutive failures that open the circuit
+	BreakerCooldown  time.Duration
+	ClientID         string // Court's own service credentials used to sign calls
+	ClientSecret     string
+	CallbackURL      string // Where the service posts asynchronous answers
+}
+
+// ConfigFromEnv reads PROSECUTION_SERVICE_URL, PROSECUTION_TIMEOUT,
+// PROSECUTION_MAX_RETRIES, PROSECUTION_CALLBACK_URL and the court's
+// COURT_SERVICE_CLIENT_ID/SECRET.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		BaseURL:          "http://localhost:9199",
+		Timeout:          3 * time.Second,
+		MaxRetries:       2,
+		Backoff:          200 * time.Millisecond,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		ClientID:         os.Getenv("COURT_SERVICE_CLIENT_ID"),
+		ClientSecret:     os.Getenv("COURT_SERVICE_CLIENT_SECRET"),
+		CallbackURL:      "http://localhost:9198/prosecution/callback",
+	}
+	if v := os.Getenv("PROSECUTION_SERVICE_URL"); v != "" {
+		cfg.BaseURL = strings.TrimRight(v, "/")
+	}
+	if d, err := time.ParseDuration(os.Getenv("PROSECUTION_TIMEOUT")); err == nil {
+		cfg.Timeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("PROSECUTION_MAX_RETRIES")); err == nil {
+		cfg.MaxRetries = n
+	}
+	if v := os.Getenv("PROSECUTION_CALLBACK_URL"); v != "" {
+		cfg.CallbackURL = v
+	}
+	return cfg
+}
+
+type Client struct {
+	cfg     Config
+	http    *http.Client
+	breaker *breaker
+}
+
+func New(cfg Config) *Client {
+	return &Client{
+		cfg:     cfg,
+		http:    &http.Client{},
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+}
+
+type PersonRequest struct {
+	Email string `json:"email"`
+}
+type PersonStatus struct {
+	Email      string `json:"email"`
+	Prosecuted bool   `json:"prosecuted"`
+}
+type CaseStatusRequest struct {
+	CaseID      string `json:"case_id"`
+	RequestID   string `json:"request_id,omitempty"`
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+type CaseStatus struct {
+	CaseStatus bool `json:"case_status"`
+}
+
+// Submission acknowledges a case status request that will be answered
+// through the callback.
+type Submission struct {
+	RequestID string `json:"request_id"`
+}
+
+// Callback is the asynchronous answer posted to the court. Error is set
+// when the service could not determine the status.
+type Callback struct {
+	RequestID  string `json:"request_id"`
+	CaseID     string `json:"case_id"`
+	CaseStatus bool   `json:"case_status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CheckPerson asks whether the person is under prosecution.
+func (c *Client) CheckPerson(ctx context.Context, email string) (*PersonStatus, error) {
+	var out PersonStatus
+	if err := c.do(ctx, pathProsecute, PersonRequest{Email: email}, &out, true); err != nil {
+		return nil, err
+	}
+	if out.Email == "" {
+		out.Email = email
+	}
+	return &out, nil
+}
+
+// CaseStatus asks for the prosecution status of a case.
+func (c *Client) CaseStatus(ctx context.Context, caseID string) (*CaseStatus, error) {
+	var out CaseStatus
+	if err := c.do(ctx, pathCaseStatus, CaseStatusRequest{CaseID: caseID}, &out, true); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SubmitCaseStatus asks for the prosecution status of a case without
+// waiting for it; the answer is posted to the callback URL under requestID.
+// Submitting the same requestID again is safe.
+func (c *Client) SubmitCaseStatus(ctx context.Context, caseID, requestID string) error {
+	var out Submission
+	return c.do(ctx, pathSubmitCase, CaseStatusRequest{CaseID: caseID, RequestID: requestID, CallbackURL: c.cfg.CallbackURL}, &out, true)
+}
+
+// BreakerState reports the circuit state for diagnostics.
+func (c *Client) BreakerState() string {
+	return c.breaker.state(time.Now())
+}
+
+func (c *Client) do(ctx context.Context, path string, in, out interface{}, idempotent bool) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	attempts := 1
+	if idempotent {
+		attempts += c.cfg.MaxRetries
+	}
+	delay := c.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.allow(time.Now()) {
+			return c.breaker.openError()
+		}
+		err = c.attempt(ctx, path, body, out)
+		if ctx.Err() != nil {
+			// The caller gave up; that's no verdict on the service
+			c.breaker.abandon()
+			return err
+		}
+		if err == nil {
+			c.breaker.success()
+			return nil
+		}
+		if !retryable(err) {
+			// The service answered; a 4xx says nothing about its health
+			c.breaker.success()
+			return err
+		}
+		c.breaker.failure(time.Now(), err)
+		if attempt >= attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, path string, body []byte, out interface{}) error {
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token, ok := ctx.Value(callerTokenKey{}).(string); ok {
+		req.Header.Set(HeaderCallerToken, token)
+	}
+	if c.cfg.ClientID != "" {
+		serviceauth.Sign(req, c.cfg.ClientID, c.cfg.ClientSecret, body)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{Code: resp.StatusCode, Body: string(respBody)}
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+// retryable treats transport errors, timeouts, 429 and 5xx as transient.
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code == http.StatusTooManyRequests || se.Code >= 500
+	}
+	var de *DecodeError
+	return !errors.As(err, &de)
+}
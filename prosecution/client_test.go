@@ -0,0 +1,101 @@
+package prosecution
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testClient(url string) *Client {
+	return New(Config{
+		BaseURL:          url,
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		Backoff:          time.Millisecond,
+		BreakerThreshold: 3,
+		BreakerCooldown:  time.Minute,
+	})
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(PersonStatus{Prosecuted: true})
+	}))
+	defer srv.Close()
+
+	status, err := testClient(srv.URL).CheckPerson(context.Background(), "a@b.rs")
+	if err != nil {
+		t.Fatalf("CheckPerson() = %v", err)
+	}
+	if !status.Prosecuted || status.Email != "a@b.rs" || calls.Load() != 3 {
+		t.Fatalf("got %+v after %d calls", status, calls.Load())
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "no such case", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, err := testClient(srv.URL).CaseStatus(context.Background(), "c1")
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusNotFound {
+		t.Fatalf("CaseStatus() = %v, want a 404 StatusError", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("a 404 was retried: %d calls", calls.Load())
+	}
+}
+
+func TestClientOpenCircuitKeepsCause(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+	_, err := c.CheckPerson(context.Background(), "a@b.rs")
+	var se *StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("first call = %v, want the StatusError", err)
+	}
+	_, err = c.CheckPerson(context.Background(), "a@b.rs")
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &se) || se.Code != http.StatusInternalServerError {
+		t.Fatalf("call while open = %v, want ErrCircuitOpen wrapping the 500", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("called out %d times, want 3 before the circuit opened", calls.Load())
+	}
+}
+
+func TestClientForwardsCallerToken(t *testing.T) {
+	got := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Get(HeaderCallerToken)
+		json.NewEncoder(w).Encode(Submission{RequestID: "r1"})
+	}))
+	defer srv.Close()
+
+	ctx := WithCallerToken(context.Background(), "token")
+	if err := testClient(srv.URL).SubmitCaseStatus(ctx, "c1", "r1"); err != nil {
+		t.Fatalf("SubmitCaseStatus() = %v", err)
+	}
+	if token := <-got; token != "token" {
+		t.Fatalf("forwarded jwt = %q", token)
+	}
+}
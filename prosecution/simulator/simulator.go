@@ -0,0 +1,333 @@
+// Package simulator is a stand-in for the external prosecution service so
+// the court can be developed and tested offline. A *Simulator is an
+// http.Handler, ready to mount in an httptest.Server with its fixtures
+// seeded through SetPerson and SetCase, or run with "court prosecution-sim".
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/EupravaProjekat/court/prosecution"
+	"github.com/EupravaProjekat/court/serviceauth"
+)
+
+// Fixtures are the canned answers; unknown people and cases are clean.
+type Fixtures struct {
+	People map[string]bool `json:"people"` // email -> prosecuted
+	Cases  map[string]bool `json:"cases"`  // case id -> case status
+}
+
+// Config controls latency and failure injection.
+type Config struct {
+	Latency     time.Duration `json:"latency"`      // Added to every answer
+	Jitter      time.Duration `json:"jitter"`       // Random extra latency up to this much
+	FailureRate float64       `json:"failure_rate"` // Share of calls answered with 503, 0..1
+	FailStatus  int           `json:"fail_status"`  // Status used for injected failures
+
+	CallbackDelay    time.Duration `json:"callback_delay"`     // Before answering an async request
+	CallbackDropRate float64       `json:"callback_drop_rate"` // Share of async requests never answered, 0..1
+}
+
+type Simulator struct {
+	mu       sync.RWMutex
+	cfg      Config
+	fixtures Fixtures
+	rnd      *rand.Rand
+
+	// Credentials the simulator signs callbacks with, as the court knows
+	// the prosecution service.
+	clientID     string
+	clientSecret string
+	http         *http.Client
+	mux          *http.ServeMux
+}
+
+func New(cfg Config, fixtures Fixtures) *Simulator {
+	if fixtures.People == nil {
+		fixtures.People = make(map[string]bool)
+	}
+	if fixtures.Cases == nil {
+		fixtures.Cases = make(map[string]bool)
+	}
+	s := &Simulator{
+		cfg:      cfg,
+		fixtures: fixtures,
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		http:     &http.Client{Timeout: 5 * time.Second},
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/prosecute", s.inject(s.prosecute))
+	s.mux.HandleFunc("/casestatus", s.inject(s.caseStatus))
+	s.mux.HandleFunc("/casestatus/async", s.inject(s.submitCase))
+	s.mux.HandleFunc("/fixtures", s.handleFixtures)
+	s.mux.HandleFunc("/config", s.handleConfig)
+	return s
+}
+
+// NewHandler returns a simulator ready for httptest.NewServer; tests keep
+// it to seed fixtures and change failure injection as they go.
+func NewHandler(cfg Config, fixtures Fixtures) *Simulator {
+	return New(cfg, fixtures)
+}
+
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetPerson seeds whether a person is prosecuted.
+func (s *Simulator) SetPerson(email string, prosecuted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures.People[email] = prosecuted
+}
+
+// SetCase seeds the status reported for a case.
+func (s *Simulator) SetCase(caseID string, status bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures.Cases[caseID] = status
+}
+
+// SetCallbackCredentials sets the service client used to sign callbacks.
+func (s *Simulator) SetCallbackCredentials(clientID, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientID, s.clientSecret = clientID, secret
+}
+
+func (s *Simulator) SetConfig(cfg Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+}
+
+// inject applies the configured latency and failure rate before a handler.
+func (s *Simulator) inject(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.mu.Lock()
+		cfg := s.cfg
+		delay := cfg.Latency
+		if cfg.Jitter > 0 {
+			delay += time.Duration(s.rnd.Int63n(int64(cfg.Jitter)))
+		}
+		fail := cfg.FailureRate > 0 && s.rnd.Float64() < cfg.FailureRate
+		s.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		if fail {
+			status := cfg.FailStatus
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, "injected failure", status)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Simulator) prosecute(w http.ResponseWriter, r *http.Request) {
+	var req prosecution.PersonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	s.mu.RLock()
+	prosecuted := s.fixtures.People[req.Email]
+	s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, prosecution.PersonStatus{Email: req.Email, Prosecuted: prosecuted})
+}
+
+func (s *Simulator) caseStatus(w http.ResponseWriter, r *http.Request) {
+	var req prosecution.CaseStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CaseID == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	s.mu.RLock()
+	status := s.fixtures.Cases[req.CaseID]
+	s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, prosecution.CaseStatus{CaseStatus: status})
+}
+
+// submitCase acknowledges an async case status request and posts the
+// answer to its callback URL later, unless the drop rate says otherwise.
+func (s *Simulator) submitCase(w http.ResponseWriter, r *http.Request) {
+	var req prosecution.CaseStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CaseID == "" || req.RequestID == "" || req.CallbackURL == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	status := s.fixtures.Cases[req.CaseID]
+	delay := s.cfg.CallbackDelay
+	drop := s.cfg.CallbackDropRate > 0 && s.rnd.Float64() < s.cfg.CallbackDropRate
+	s.mu.Unlock()
+
+	if !drop {
+		answer := prosecution.Callback{RequestID: req.RequestID, CaseID: req.CaseID, CaseStatus: status}
+		go func() {
+			time.Sleep(delay)
+			s.callback(req.CallbackURL, answer)
+		}()
+	}
+	writeJSON(w, http.StatusAccepted, prosecution.Submission{RequestID: req.RequestID})
+}
+
+// callback posts the answer, retrying a few times while the court is
+// unreachable or failing.
+func (s *Simulator) callback(url string, answer prosecution.Callback) {
+	body, err := json.Marshal(answer)
+	if err != nil {
+		log.Printf("callback for %s: %v\n", answer.RequestID, err)
+		return
+	}
+	s.mu.RLock()
+	clientID, secret := s.clientID, s.clientSecret
+	s.mu.RUnlock()
+	delay := time.Second
+	for attempt := 1; attempt <= 5; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("callback for %s: %v\n", answer.RequestID, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if clientID != "" {
+			serviceauth.Sign(req, clientID, secret, body)
+		}
+		resp, err := s.http.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 500 {
+				if resp.StatusCode > 299 {
+					log.Printf("callback for %s rejected with %d\n", answer.RequestID, resp.StatusCode)
+				}
+				return
+			}
+			err = errors.New(resp.Status)
+		}
+		log.Printf("callback for %s failed (attempt %d): %v\n", answer.RequestID, attempt, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// handleFixtures returns the fixtures on GET and merges posted ones on POST.
+func (s *Simulator) handleFixtures(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		writeJSON(w, http.StatusOK, s.fixtures)
+	case http.MethodPost:
+		var f Fixtures
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		for email, v := range f.People {
+			s.SetPerson(email, v)
+		}
+		for id, v := range f.Cases {
+			s.SetCase(id, v)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Simulator) handleConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		writeJSON(w, http.StatusOK, s.cfg)
+	case http.MethodPut:
+		var cfg Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil || cfg.FailureRate < 0 || cfg.FailureRate > 1 || cfg.CallbackDropRate < 0 || cfg.CallbackDropRate > 1 {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		s.SetConfig(cfg)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// LoadFixtures reads fixtures from a JSON file.
+func LoadFixtures(path string) (Fixtures, error) {
+	var f Fixtures
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	err = json.Unmarshal(data, &f)
+	return f, err
+}
+
+// Run is the entry point of the "prosecution-sim" subcommand.
+func Run(args []string) error {
+	fs := flag.NewFlagSet("prosecution-sim", flag.ContinueOnError)
+	addr := fs.String("addr", ":9199", "listen address")
+	fixturesPath := fs.String("fixtures", "", "JSON file with people and cases fixtures")
+	latency := fs.Duration("latency", 0, "latency added to every answer")
+	jitter := fs.Duration("jitter", 0, "random extra latency")
+	failureRate := fs.Float64("failure-rate", 0, "share of calls failing with 503 (0..1)")
+	callbackDelay := fs.Duration("callback-delay", time.Second, "delay before answering async requests")
+	dropRate := fs.Float64("callback-drop-rate", 0, "share of async requests never answered (0..1)")
+	clientID := fs.String("client-id", os.Getenv("PROSECUTION_CLIENT_ID"), "service client the callbacks are signed as")
+	clientSecret := fs.String("client-secret", os.Getenv("PROSECUTION_CLIENT_SECRET"), "secret of that service client")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *failureRate < 0 || *failureRate > 1 {
+		return errors.New("failure-rate must be between 0 and 1")
+	}
+	if *dropRate < 0 || *dropRate > 1 {
+		return errors.New("callback-drop-rate must be between 0 and 1")
+	}
+	var fixtures Fixtures
+	if *fixturesPath != "" {
+		var err error
+		if fixtures, err = LoadFixtures(*fixturesPath); err != nil {
+			return err
+		}
+	}
+	cfg := Config{
+		Latency:          *latency,
+		Jitter:           *jitter,
+		FailureRate:      *failureRate,
+		CallbackDelay:    *callbackDelay,
+		CallbackDropRate: *dropRate,
+	}
+	sim := New(cfg, fixtures)
+	sim.SetCallbackCredentials(*clientID, *clientSecret)
+	log.Printf("prosecution simulator listening on %s\n", *addr)
+	return http.ListenAndServe(*addr, sim)
+}
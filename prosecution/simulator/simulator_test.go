@@ -0,0 +1,88 @@
+package simulator_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EupravaProjekat/court/prosecution"
+	"github.com/EupravaProjekat/court/prosecution/simulator"
+	"github.com/EupravaProjekat/court/serviceauth"
+)
+
+func client(url string) *prosecution.Client {
+	return prosecution.New(prosecution.Config{BaseURL: url, Timeout: time.Second, Backoff: time.Millisecond, BreakerThreshold: 5, BreakerCooldown: time.Minute})
+}
+
+func TestFixtures(t *testing.T) {
+	sim := simulator.NewHandler(simulator.Config{}, simulator.Fixtures{})
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+	c := client(srv.URL)
+
+	status, err := c.CheckPerson(context.Background(), "a@b.rs")
+	if err != nil || status.Prosecuted {
+		t.Fatalf("unknown person = %+v, %v; want clean", status, err)
+	}
+	sim.SetPerson("a@b.rs", true)
+	sim.SetCase("c1", true)
+	if status, err = c.CheckPerson(context.Background(), "a@b.rs"); err != nil || !status.Prosecuted {
+		t.Fatalf("seeded person = %+v, %v; want prosecuted", status, err)
+	}
+	if cs, err := c.CaseStatus(context.Background(), "c1"); err != nil || !cs.CaseStatus {
+		t.Fatalf("seeded case = %+v, %v", cs, err)
+	}
+}
+
+func TestInjectedFailures(t *testing.T) {
+	sim := simulator.NewHandler(simulator.Config{FailureRate: 1, FailStatus: http.StatusBadGateway}, simulator.Fixtures{})
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+
+	_, err := client(srv.URL).CheckPerson(context.Background(), "a@b.rs")
+	var se *prosecution.StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusBadGateway {
+		t.Fatalf("CheckPerson() = %v, want an injected 502", err)
+	}
+	sim.SetConfig(simulator.Config{})
+	if _, err := client(srv.URL).CheckPerson(context.Background(), "a@b.rs"); err != nil {
+		t.Fatalf("CheckPerson() after clearing failures = %v", err)
+	}
+}
+
+func TestSignedCallback(t *testing.T) {
+	answers := make(chan prosecution.Callback, 1)
+	court := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := serviceauth.Verify(r, "secret", body, time.Now()); err != nil {
+			t.Errorf("callback signature: %v", err)
+		}
+		var cb prosecution.Callback
+		json.Unmarshal(body, &cb)
+		answers <- cb
+	}))
+	defer court.Close()
+
+	sim := simulator.NewHandler(simulator.Config{}, simulator.Fixtures{Cases: map[string]bool{"c1": true}})
+	sim.SetCallbackCredentials("prosecution", "secret")
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+
+	c := prosecution.New(prosecution.Config{BaseURL: srv.URL, Timeout: time.Second, CallbackURL: court.URL})
+	if err := c.SubmitCaseStatus(context.Background(), "c1", "r1"); err != nil {
+		t.Fatalf("SubmitCaseStatus() = %v", err)
+	}
+	select {
+	case cb := <-answers:
+		if cb.RequestID != "r1" || cb.CaseID != "c1" || !cb.CaseStatus {
+			t.Fatalf("callback = %+v", cb)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no callback")
+	}
+}
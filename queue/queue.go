@@ -0,0 +1,93 @@
+// Package queue holds what the court's leased work queues have in common.
+// The outbox dispatcher and the webhook, notification and reminder workers
+// each claim one due item at a time under a lease, settle it, and retry
+// failures later; the lease running out covers a worker that dies midway.
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Backoff is a retry schedule doubling the wait after each failed attempt.
+type Backoff struct {
+	Base time.Duration // Wait after the first failure
+	Max  time.Duration
+}
+
+// Delay is how long to wait after the given number of failed attempts.
+func (b Backoff) Delay(attempts int) time.Duration {
+	wait := b.Base
+	for i := 1; i < attempts && wait < b.Max; i++ {
+		wait *= 2
+	}
+	if wait > b.Max {
+		wait = b.Max
+	}
+	return wait
+}
+
+// permanentError marks a failure that retrying can't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that fails the same way on every attempt,
+// such as a malformed message, so the item is given up at once instead of
+// retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked
+// Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Loop drives one queue: it calls next until next reports the queue empty,
+// then waits for the poll interval or a Notify.
+type Loop struct {
+	poll time.Duration
+	next func(ctx context.Context) bool
+	wake chan struct{}
+}
+
+// NewLoop returns a Loop calling next, which handles one due item and
+// reports whether there may be more.
+func NewLoop(poll time.Duration, next func(ctx context.Context) bool) *Loop {
+	return &Loop{poll: poll, next: next, wake: make(chan struct{}, 1)}
+}
+
+// Notify wakes the loop, e.g. after items were queued, instead of waiting
+// for the next poll.
+func (l *Loop) Notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run works the queue until ctx is done.
+func (l *Loop) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.poll)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil && l.next(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-l.wake:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Base: 10 * time.Second, Max: time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := b.Delay(tt.attempts); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	boom := errors.New("boom")
+	wrapped := fmt.Errorf("sending: %w", Permanent(boom))
+	if !IsPermanent(wrapped) || !errors.Is(wrapped, boom) {
+		t.Fatalf("IsPermanent(%v) = false, or the cause was lost", wrapped)
+	}
+	if IsPermanent(boom) {
+		t.Fatal("IsPermanent() of a plain error = true")
+	}
+	if Permanent(nil) != nil {
+		t.Fatal("Permanent(nil) != nil")
+	}
+}
+
+func TestLoopDrainsAndWakes(t *testing.T) {
+	var queued, handled atomic.Int32
+	queued.Store(3)
+	worked := make(chan struct{}, 10)
+	l := NewLoop(time.Hour, func(ctx context.Context) bool {
+		if queued.Load() == 0 {
+			return false
+		}
+		queued.Add(-1)
+		handled.Add(1)
+		worked <- struct{}{}
+		return true
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Run(ctx)
+	}()
+
+	wait := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case <-worked:
+			case <-time.After(time.Second):
+				t.Fatalf("handled %d items, want more", handled.Load())
+			}
+		}
+	}
+	// Everything queued at start is handled without waiting for a poll
+	wait(3)
+	queued.Store(2)
+	l.Notify()
+	wait(2)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() didn't return after ctx was done")
+	}
+	if handled.Load() != 5 {
+		t.Fatalf("handled %d items, want 5", handled.Load())
+	}
+}
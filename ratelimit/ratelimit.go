@@ -0,0 +1,103 @@
+// Package ratelimit is a per-client token bucket limiter kept in memory.
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter allows each key Burst requests at once, refilled at Rate per second.
+type Limiter struct {
+	Rate  float64
+	Burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func New(rate, burst float64) *Limiter {
+	return &Limiter{Rate: rate, Burst: burst, buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token for key, reporting false when none is left.
+func (l *Limiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.Burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.Rate
+	if b.tokens > l.Burst {
+		b.tokens = l.Burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep forgets buckets that have refilled completely, once a minute.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	full := time.Duration(l.Burst / l.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// ClientIP is the address limits are keyed by. trustedHops is how many
+// proxies in front of the service append to X-Forwarded-For; the client is
+// the entry the outermost of them added, counting from the right, since
+// anything left of it came from the client and can be forged. With no
+// trusted proxies the header is ignored.
+func ClientIP(r *http.Request, trustedHops int) string {
+	if trustedHops > 0 {
+		var hops []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(header, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		if len(hops) >= trustedHops {
+			return hops[len(hops)-trustedHops]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware rejects requests over the limit with 429.
+func (l *Limiter) Middleware(trustedHops int, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !l.Allow(ClientIP(r, trustedHops), time.Now()) {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
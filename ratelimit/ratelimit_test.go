@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name string
+		hops int
+		xff  []string
+		want string
+	}{
+		{"no proxy ignores the header", 0, []string{"1.1.1.1"}, "10.0.0.9"},
+		{"one proxy takes the rightmost", 1, []string{"6.6.6.6, 1.1.1.1"}, "1.1.1.1"},
+		{"two proxies", 2, []string{"6.6.6.6, 1.1.1.1, 10.0.0.2"}, "1.1.1.1"},
+		{"repeated headers", 2, []string{"6.6.6.6, 1.1.1.1", "10.0.0.2"}, "1.1.1.1"},
+		{"short header falls back to the peer", 2, []string{"1.1.1.1"}, "10.0.0.9"},
+		{"no header", 1, nil, "10.0.0.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.9:5123"
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(r, tt.hops); got != tt.want {
+				t.Fatalf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	l := New(1, 2)
+	now := time.Now()
+	if !l.Allow("a", now) || !l.Allow("a", now) {
+		t.Fatal("burst not allowed")
+	}
+	if l.Allow("a", now) {
+		t.Fatal("allowed past the burst")
+	}
+	if !l.Allow("b", now) {
+		t.Fatal("other client limited")
+	}
+	if !l.Allow("a", now.Add(time.Second)) {
+		t.Fatal("not refilled after a second")
+	}
+}
@@ -0,0 +1,60 @@
+package reminders
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Duration is a time.Duration kept and shown as a string such as
+// "168h0m0s" rather than a count of nanoseconds.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(d.String())
+}
+
+// UnmarshalBSONValue also reads the nanoseconds jobs were first stored
+// with.
+func (d *Duration) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bsontype.String:
+		parsed, err := time.ParseDuration(raw.StringValue())
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case bsontype.Int64:
+		*d = Duration(raw.Int64())
+	case bsontype.Int32:
+		*d = Duration(raw.Int32())
+	default:
+		return fmt.Errorf("reminders: can't read a duration from BSON %v", t)
+	}
+	return nil
+}
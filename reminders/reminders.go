@@ -0,0 +1,348 @@
+// Package reminders schedules reminders ahead of hearings and procedural
+// deadlines. Jobs are kept in Mongo so they survive restarts, and each is
+// leased before it fires so only one replica sends it. Its outbox sink
+// plans jobs from case events and cancels them when a hearing moves or a
+// deadline closes.
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/outbox"
+	"github.com/EupravaProjekat/court/queue"
+	"github.com/google/uuid"
+)
+
+// What a job reminds of.
+const (
+	TargetHearing  = "hearing"
+	TargetDeadline = "deadline"
+)
+
+// Job states.
+const (
+	StatusPending   = "pending"
+	StatusSent      = "sent"
+	StatusCancelled = "cancelled"
+	StatusFailed    = "failed" // Gave up after MaxAttempts
+)
+
+// ErrStale is returned by a Fire func when the hearing or deadline no
+// longer matches the job; the job is cancelled instead of sent.
+var ErrStale = errors.New("reminder no longer applies")
+
+type Job struct {
+	ID         string    `bson:"id" json:"id"`
+	Key        string    `bson:"key" json:"-"` // One job per target, due time and offset
+	Target     string    `bson:"target" json:"target"`
+	CaseID     string    `bson:"caseId" json:"case_id"`
+	TargetID   string    `bson:"targetId" json:"target_id"`
+	DueAt      time.Time `bson:"dueAt" json:"due_at"`  // When the hearing starts or the deadline runs out
+	Offset     Duration  `bson:"offset" json:"offset"` // How long before DueAt it fires
+	FireAt     time.Time `bson:"fireAt" json:"fire_at"`
+	Status     string    `bson:"status" json:"status"`
+	Attempts   int       `bson:"attempts" json:"attempts"`
+	LeaseUntil time.Time `bson:"leaseUntil" json:"-"`
+	LastError  string    `bson:"lastError,omitempty" json:"last_error,omitempty"`
+	SentAt     time.Time `bson:"sentAt,omitempty" json:"sent_at,omitempty"`
+	CreatedAt  time.Time `bson:"createdAt" json:"created_at"`
+}
+
+type Store interface {
+	// AddJobs stores new jobs and revives cancelled ones with the same
+	// Key; jobs already pending, sent or failed are left alone, so
+	// planning the same target twice is harmless.
+	AddJobs(ctx context.Context, jobs []*Job) error
+	// CancelJobs cancels the target's pending jobs, except those due at
+	// keep.
+	CancelJobs(ctx context.Context, target, targetID string, keep time.Time) error
+	// ClaimJob leases the earliest due pending job; nil, nil when none.
+	ClaimJob(ctx context.Context, now time.Time, lease time.Duration) (*Job, error)
+	SaveJob(ctx context.Context, j *Job) error
+	// UpcomingCases returns the cases with a hearing or deadline dated
+	// after since.
+	UpcomingCases(ctx context.Context, since time.Time) ([]*Models.Case, error)
+}
+
+// Fire sends the reminder for a job.
+type Fire func(ctx context.Context, j *Job) error
+
+type Config struct {
+	Offsets      []time.Duration // How long before the due time reminders go out
+	PollInterval time.Duration
+	Lease        time.Duration
+	MaxAttempts  int
+	RetryDelay   time.Duration
+}
+
+// ConfigFromEnv reads REMINDER_OFFSETS, a comma separated list of
+// durations that may also be given in days, e.g. "7d,1d,2h".
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Offsets:      []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, 2 * time.Hour},
+		PollInterval: 30 * time.Second,
+		Lease:        2 * time.Minute,
+		MaxAttempts:  5,
+		RetryDelay:   5 * time.Minute,
+	}
+	if v := os.Getenv("REMINDER_OFFSETS"); v != "" {
+		offsets, err := ParseOffsets(v)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Offsets = offsets
+	}
+	return cfg, nil
+}
+
+// ParseOffsets parses a comma separated list of positive durations, each
+// either a Go duration or a number of days such as "7d".
+func ParseOffsets(s string) ([]time.Duration, error) {
+	var offsets []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		var d time.Duration
+		if days, ok := strings.CutSuffix(part, "d"); ok {
+			n, err := strconv.Atoi(days)
+			if err != nil {
+				return nil, fmt.Errorf("reminders: bad offset %q", part)
+			}
+			d = time.Duration(n) * 24 * time.Hour
+		} else {
+			var err error
+			if d, err = time.ParseDuration(part); err != nil {
+				return nil, fmt.Errorf("reminders: bad offset %q", part)
+			}
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("reminders: offset %q must be positive", part)
+		}
+		offsets = append(offsets, d)
+	}
+	return offsets, nil
+}
+
+type Scheduler struct {
+	store  Store
+	cfg    Config
+	fire   Fire
+	logger *log.Logger
+	loop   *queue.Loop
+}
+
+func New(store Store, cfg Config, fire Fire, logger *log.Logger) *Scheduler {
+	s := &Scheduler{store: store, cfg: cfg, fire: fire, logger: logger}
+	s.loop = queue.NewLoop(cfg.PollInterval, s.fireOne)
+	return s
+}
+
+// Plan builds a job for every offset whose reminder is still ahead.
+func (s *Scheduler) Plan(target, caseID, targetID string, due, now time.Time) []*Job {
+	var jobs []*Job
+	for _, offset := range s.cfg.Offsets {
+		fireAt := due.Add(-offset)
+		if !fireAt.After(now) {
+			continue
+		}
+		jobs = append(jobs, &Job{
+			ID:         uuid.New().String(),
+			Key:        fmt.Sprintf("%s/%s/%d/%s", target, targetID, due.Unix(), offset),
+			Target:     target,
+			CaseID:     caseID,
+			TargetID:   targetID,
+			DueAt:      due.UTC(),
+			Offset:     Duration(offset),
+			FireAt:     fireAt.UTC(),
+			Status:     StatusPending,
+			LeaseUntil: now.UTC(),
+			CreatedAt:  now.UTC(),
+		})
+	}
+	return jobs
+}
+
+// Reschedule replaces the target's pending jobs with ones for due. A zero
+// due only cancels them.
+func (s *Scheduler) Reschedule(ctx context.Context, target, caseID, targetID string, due time.Time) error {
+	if err := s.store.CancelJobs(ctx, target, targetID, due.UTC()); err != nil {
+		return err
+	}
+	if due.IsZero() {
+		return nil
+	}
+	jobs := s.Plan(target, caseID, targetID, due, time.Now())
+	if len(jobs) == 0 {
+		return nil
+	}
+	if err := s.store.AddJobs(ctx, jobs); err != nil {
+		return err
+	}
+	s.Notify()
+	return nil
+}
+
+// Backfill plans the reminders of upcoming hearings and deadlines set
+// before the scheduler existed, or whose events it never saw. Jobs already
+// planned are left alone, so it is safe to run on every start.
+func (s *Scheduler) Backfill(ctx context.Context) error {
+	now := time.Now()
+	// Dates carry their own offsets; a day's slack covers all of them
+	cases, err := s.store.UpcomingCases(ctx, now.Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	var jobs []*Job
+	for _, c := range cases {
+		for i := range c.Hearings {
+			if due := hearingDue(&c.Hearings[i]); !due.IsZero() {
+				jobs = append(jobs, s.Plan(TargetHearing, c.ID, c.Hearings[i].ID, due, now)...)
+			}
+		}
+		for i := range c.Deadlines {
+			if due := deadlineDue(&c.Deadlines[i]); !due.IsZero() {
+				jobs = append(jobs, s.Plan(TargetDeadline, c.ID, c.Deadlines[i].ID, due, now)...)
+			}
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	if err := s.store.AddJobs(ctx, jobs); err != nil {
+		return err
+	}
+	s.logger.Printf("reminders: backfill checked %d jobs of %d cases\n", len(jobs), len(cases))
+	s.Notify()
+	return nil
+}
+
+// Notify wakes the scheduler, e.g. after jobs were added.
+func (s *Scheduler) Notify() {
+	s.loop.Notify()
+}
+
+// Sink is the outbox sink planning jobs from case events.
+func (s *Scheduler) Sink() outbox.Sink {
+	return &sink{s: s}
+}
+
+type sink struct {
+	s *Scheduler
+}
+
+func (k *sink) Name() string { return "reminders" }
+
+func (k *sink) Deliver(ctx context.Context, m *outbox.Message) error {
+	if m.AggregateType != "case" {
+		return nil
+	}
+	var e caseevents.Event
+	if err := json.Unmarshal(m.Payload, &e); err != nil {
+		return err
+	}
+	switch e.Type {
+	case caseevents.CaseFiled:
+		for _, h := range e.Case.Hearings {
+			if err := k.s.Reschedule(ctx, TargetHearing, e.CaseID, h.ID, hearingDue(&h)); err != nil {
+				return err
+			}
+		}
+		for _, d := range e.Case.Deadlines {
+			if err := k.s.Reschedule(ctx, TargetDeadline, e.CaseID, d.ID, deadlineDue(&d)); err != nil {
+				return err
+			}
+		}
+	case caseevents.HearingScheduled, caseevents.HearingRescheduled:
+		return k.s.Reschedule(ctx, TargetHearing, e.CaseID, e.Hearing.ID, hearingDue(e.Hearing))
+	case caseevents.HearingStatusChanged:
+		// Once a hearing is under way or over there is nothing left to
+		// remind of; a delay keeps its reminders
+		if e.Hearing.Status == "delayed" {
+			return nil
+		}
+		return k.s.Reschedule(ctx, TargetHearing, e.CaseID, e.Hearing.ID, time.Time{})
+	case caseevents.DeadlineSet:
+		return k.s.Reschedule(ctx, TargetDeadline, e.CaseID, e.Deadline.ID, deadlineDue(e.Deadline))
+	case caseevents.DeadlineStatusChanged:
+		// Met or cancelled; nothing left to remind of
+		return k.s.Reschedule(ctx, TargetDeadline, e.CaseID, e.Deadline.ID, time.Time{})
+	}
+	return nil
+}
+
+// hearingDue is when a hearing that still takes place starts; zero when
+// it won't.
+func hearingDue(h *Models.Hearing) time.Time {
+	switch h.Status {
+	case "", "scheduled", "delayed":
+	default:
+		return time.Time{}
+	}
+	due, err := time.Parse(time.RFC3339, h.Date)
+	if err != nil {
+		return time.Time{}
+	}
+	return due
+}
+
+// deadlineDue is when an open deadline runs out; zero once it is closed.
+func deadlineDue(d *Models.Deadline) time.Time {
+	if d.Status != "" && d.Status != "open" {
+		return time.Time{}
+	}
+	due, err := time.Parse(time.RFC3339, d.Due)
+	if err != nil {
+		return time.Time{}
+	}
+	return due
+}
+
+// Run fires due jobs until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.loop.Run(ctx)
+}
+
+// fireOne fires the next due job, reporting whether there may be more. A
+// queue.Permanent error fails the job at once.
+func (s *Scheduler) fireOne(ctx context.Context) bool {
+	j, err := s.store.ClaimJob(ctx, time.Now().UTC(), s.cfg.Lease)
+	if err != nil || j == nil {
+		if err != nil && ctx.Err() == nil {
+			s.logger.Printf("reminders: claim failed: %v\n", err)
+		}
+		return false
+	}
+	err = s.fire(ctx, j)
+	j.Attempts++
+	j.LeaseUntil = time.Time{}
+	switch {
+	case err == nil:
+		j.Status = StatusSent
+		j.SentAt = time.Now().UTC()
+		j.LastError = ""
+	case errors.Is(err, ErrStale):
+		j.Status = StatusCancelled
+	default:
+		j.LastError = err.Error()
+		j.FireAt = time.Now().UTC().Add(s.cfg.RetryDelay)
+		if j.Attempts >= s.cfg.MaxAttempts || !j.FireAt.Before(j.DueAt) || queue.IsPermanent(err) {
+			// A reminder after the fact is no use
+			j.Status = StatusFailed
+			s.logger.Printf("reminders: %s %s failed for good: %v\n", j.Target, j.TargetID, err)
+		}
+	}
+	if err := s.store.SaveJob(ctx, j); err != nil {
+		// The lease runs out and it fires again
+		s.logger.Printf("reminders: saving job %s failed: %v\n", j.ID, err)
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/EupravaProjekat/court/Models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseOffsets(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []time.Duration
+		ok   bool
+	}{
+		{"7d,1d,2h", []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, 2 * time.Hour}, true},
+		{" 30m , 1d ", []time.Duration{30 * time.Minute, 24 * time.Hour}, true},
+		{"90s", []time.Duration{90 * time.Second}, true},
+		{"", nil, false},
+		{"1d,", nil, false},
+		{"xd", nil, false},
+		{"1.5d", nil, false},
+		{"tomorrow", nil, false},
+		{"0h", nil, false},
+		{"-1d", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseOffsets(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseOffsets(%q) error = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseOffsets(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseOffsets(%q) = %v, want %v", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDurationEncoding(t *testing.T) {
+	j := Job{ID: "j1", Offset: Duration(7 * 24 * time.Hour)}
+	raw, err := json.Marshal(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shown struct {
+		Offset string `json:"offset"`
+	}
+	if json.Unmarshal(raw, &shown); shown.Offset != "168h0m0s" {
+		t.Fatalf("JSON offset = %q, want 168h0m0s", shown.Offset)
+	}
+
+	doc, err := bson.Marshal(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := bson.Raw(doc).Lookup("offset"); v.StringValue() != "168h0m0s" {
+		t.Fatalf("BSON offset = %v, want a duration string", v)
+	}
+	var back Job
+	if err := bson.Unmarshal(doc, &back); err != nil || back.Offset != j.Offset {
+		t.Fatalf("BSON round trip = %v, %v", back.Offset, err)
+	}
+
+	// Jobs stored before kept nanoseconds
+	legacy, _ := bson.Marshal(bson.M{"id": "j0", "offset": int64(2 * time.Hour)})
+	var old Job
+	if err := bson.Unmarshal(legacy, &old); err != nil || time.Duration(old.Offset) != 2*time.Hour {
+		t.Fatalf("legacy offset = %v, %v", old.Offset, err)
+	}
+}
+
+// memStore keeps jobs in memory, by Key as the repo does.
+type memStore struct {
+	cases []*Models.Case
+	jobs  map[string]*Job
+}
+
+func (s *memStore) AddJobs(ctx context.Context, jobs []*Job) error {
+	for _, j := range jobs {
+		if _, ok := s.jobs[j.Key]; !ok {
+			s.jobs[j.Key] = j
+		}
+	}
+	return nil
+}
+func (s *memStore) CancelJobs(ctx context.Context, target, targetID string, keep time.Time) error {
+	return nil
+}
+func (s *memStore) ClaimJob(ctx context.Context, now time.Time, lease time.Duration) (*Job, error) {
+	return nil, nil
+}
+func (s *memStore) SaveJob(ctx context.Context, j *Job) error { return nil }
+func (s *memStore) UpcomingCases(ctx context.Context, since time.Time) ([]*Models.Case, error) {
+	return s.cases, nil
+}
+
+func TestBackfill(t *testing.T) {
+	in := func(d time.Duration) string { return time.Now().Add(d).UTC().Format(time.RFC3339) }
+	store := &memStore{jobs: map[string]*Job{}, cases: []*Models.Case{{
+		ID: "c1",
+		Hearings: []Models.Hearing{
+			{ID: "soon", Date: in(36 * time.Hour), Status: "scheduled"}, // 1d and 2h ahead
+			{ID: "cancelled", Date: in(10 * 24 * time.Hour), Status: "cancelled"},
+			{ID: "past", Date: in(-time.Hour), Status: "finished"},
+		},
+		Deadlines: []Models.Deadline{
+			{ID: "open", Due: in(10 * 24 * time.Hour), Status: "open"}, // 7d, 1d and 2h ahead
+			{ID: "met", Due: in(10 * 24 * time.Hour), Status: "met"},
+		},
+	}}}
+	cfg, _ := ConfigFromEnv()
+	s := New(store, cfg, nil, log.New(io.Discard, "", 0))
+
+	if err := s.Backfill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	byTarget := map[string]int{}
+	for _, j := range store.jobs {
+		byTarget[j.TargetID]++
+	}
+	if len(byTarget) != 2 || byTarget["soon"] != 2 || byTarget["open"] != 3 {
+		t.Fatalf("jobs per target = %v, want 2 for the hearing and 3 for the open deadline", byTarget)
+	}
+	// Running it again plans nothing new
+	if err := s.Backfill(context.Background()); err != nil || len(store.jobs) != 5 {
+		t.Fatalf("second Backfill() left %d jobs, %v", len(store.jobs), err)
+	}
+}
@@ -0,0 +1,121 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/audit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// AuditStore keeps the audit log in an insert-only collection.
+type AuditStore struct {
+	ar *Repo
+}
+
+func (ar *Repo) AuditStore() *AuditStore {
+	return &AuditStore{ar: ar}
+}
+
+func (s *AuditStore) Last(ctx context.Context) (*audit.Entry, error) {
+	var e audit.Entry
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+	err := s.ar.getCollectionAudit().FindOne(ctx, bson.M{}, opts).Decode(&e)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		s.ar.logger.Println(err)
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Append chains e and drops its pending event in one transaction.
+func (s *AuditStore) Append(ctx context.Context, e *audit.Entry, pendingID string) error {
+	err := s.ar.withTransaction(func(sc mongo.SessionContext) error {
+		res, err := s.ar.getCollectionAuditPending().DeleteOne(sc, bson.M{"id": pendingID})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return audit.ErrChained
+		}
+		_, err = s.ar.getCollectionAudit().InsertOne(sc, e)
+		if IsDuplicate(err) {
+			return audit.ErrConflict
+		}
+		return err
+	})
+	return err
+}
+func (s *AuditStore) Enqueue(ctx context.Context, p *audit.Pending) error {
+	_, err := s.ar.getCollectionAuditPending().InsertOne(ctx, p)
+	if err != nil {
+		s.ar.logger.Println(err)
+	}
+	return err
+}
+func (s *AuditStore) Pending(ctx context.Context, limit int) ([]*audit.Pending, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "queuedAt", Value: 1}, {Key: "id", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := s.ar.getCollectionAuditPending().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		s.ar.logger.Println(err)
+		return nil, err
+	}
+	pending := []*audit.Pending{}
+	if err := cursor.All(ctx, &pending); err != nil {
+		s.ar.logger.Println(err)
+		return nil, err
+	}
+	return pending, nil
+}
+
+// FindAuditEntries returns entries matching filter, newest first.
+func (ar *Repo) FindAuditEntries(filter bson.M, limit, skip int64) ([]*audit.Entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: -1}}).SetLimit(limit).SetSkip(skip)
+	cursor, err := ar.getCollectionAudit().Find(ctx, filter, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	entries := []*audit.Entry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// EachAuditEntry streams the whole log in sequence order to fn, stopping at
+// the first error fn returns.
+func (ar *Repo) EachAuditEntry(ctx context.Context, fn func(*audit.Entry) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := ar.getCollectionAudit().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var e audit.Entry
+		if err := cursor.Decode(&e); err != nil {
+			return err
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (ar *Repo) getCollectionAudit() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-audit")
+}
+func (ar *Repo) getCollectionAuditPending() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-audit-pending")
+}
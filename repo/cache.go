@@ -0,0 +1,56 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/lookupcache"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CacheBackend stores lookup cache entries in Mongo so every replica of the
+// court shares them.
+type CacheBackend struct {
+	ar *Repo
+}
+
+func (ar *Repo) CacheBackend() *CacheBackend {
+	return &CacheBackend{ar: ar}
+}
+
+type cacheDocument struct {
+	Key               string `bson:"key"`
+	lookupcache.Entry `bson:",inline"`
+}
+
+func (b *CacheBackend) Get(ctx context.Context, key string) (*lookupcache.Entry, error) {
+	var doc cacheDocument
+	err := b.ar.getCollectionCache().FindOne(ctx, bson.M{"key": key}).Decode(&doc)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		b.ar.logger.Println(err)
+		return nil, err
+	}
+	return &doc.Entry, nil
+}
+func (b *CacheBackend) Set(ctx context.Context, key string, e *lookupcache.Entry) error {
+	filter := bson.M{"key": key}
+	_, err := b.ar.getCollectionCache().ReplaceOne(ctx, filter, cacheDocument{Key: key, Entry: *e}, options.Replace().SetUpsert(true))
+	if err != nil {
+		b.ar.logger.Println(err)
+	}
+	return err
+}
+func (b *CacheBackend) DeleteTag(ctx context.Context, tag string) error {
+	_, err := b.ar.getCollectionCache().DeleteMany(ctx, bson.M{"tags": tag})
+	if err != nil {
+		b.ar.logger.Println(err)
+	}
+	return err
+}
+
+func (ar *Repo) getCollectionCache() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-prosecution-cache")
+}
@@ -0,0 +1,111 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/Models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"time"
+)
+
+// UploadCaseFile streams content into GridFS and returns the file's ID.
+func (ar *Repo) UploadCaseFile(filename string, content io.Reader, metadata bson.M) (string, error) {
+	bucket, err := ar.getCaseFilesBucket()
+	if err != nil {
+		return "", err
+	}
+	id, err := bucket.UploadFromStream(filename, content, options.GridFSUpload().SetMetadata(metadata))
+	if err != nil {
+		ar.logger.Println(err)
+		return "", err
+	}
+	return id.Hex(), nil
+}
+
+// OpenCaseFile opens a GridFS file for streaming; the caller closes it.
+func (ar *Repo) OpenCaseFile(fileID string) (*gridfs.DownloadStream, error) {
+	id, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := ar.getCaseFilesBucket()
+	if err != nil {
+		return nil, err
+	}
+	return bucket.OpenDownloadStream(id)
+}
+func (ar *Repo) DeleteCaseFile(fileID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return err
+	}
+	bucket, err := ar.getCaseFilesBucket()
+	if err != nil {
+		return err
+	}
+	return bucket.DeleteContext(ctx, id)
+}
+func (ar *Repo) NewCaseDocument(doc *Models.CaseDocument) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := ar.getCollectionCaseDocuments().InsertOne(ctx, doc)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	ar.logger.Printf("Documents ID: %v\n", result.InsertedID)
+	return nil
+}
+
+// GetCaseDocuments returns every version of every document on the case,
+// ordered by upload time and then version.
+func (ar *Repo) GetCaseDocuments(caseID string) ([]*Models.CaseDocument, error) {
+	return ar.findCaseDocuments(bson.M{"caseId": caseID}, bson.D{{Key: "uploadedAt", Value: 1}, {Key: "version", Value: 1}})
+}
+func (ar *Repo) GetCaseDocumentVersions(caseID, id string) ([]*Models.CaseDocument, error) {
+	return ar.findCaseDocuments(bson.M{"caseId": caseID, "id": id}, bson.D{{Key: "version", Value: 1}})
+}
+func (ar *Repo) findCaseDocuments(filter bson.M, sort bson.D) ([]*Models.CaseDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := ar.getCollectionCaseDocuments().Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	docs := []*Models.CaseDocument{}
+	if err := cursor.All(ctx, &docs); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return docs, nil
+}
+
+// GetCaseDocument returns the latest version of a document.
+func (ar *Repo) GetCaseDocument(caseID, id string) (*Models.CaseDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc Models.CaseDocument
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := ar.getCollectionCaseDocuments().FindOne(ctx, bson.M{"caseId": caseID, "id": id}, opts).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+func (ar *Repo) getCaseFilesBucket() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(ar.cli.Database("mongoCourt"), options.GridFSBucket().SetName("court-case-files"))
+}
+func (ar *Repo) getCollectionCaseDocuments() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-case-documents")
+}
@@ -0,0 +1,64 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/caseevents"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+func (ar *Repo) GetCaseEvents(caseID string) ([]*caseevents.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := ar.getCollectionCaseEvents().Find(ctx, bson.M{"caseId": caseID}, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	events := []*caseevents.Event{}
+	if err := cursor.All(ctx, &events); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// saveCaseProjection replaces the stored case with a newer projection. A
+// writer that lost a race never overwrites a later version.
+func (ar *Repo) saveCaseProjection(ctx context.Context, c *Models.Case) error {
+	filter := bson.M{"ID": c.ID, "$or": bson.A{
+		bson.M{"version": bson.M{"$lt": c.Version}},
+		bson.M{"version": bson.M{"$exists": false}}, // Cases stored before events
+	}}
+	_, err := ar.getCollectionCases().ReplaceOne(ctx, filter, c)
+	return err
+}
+
+func (ar *Repo) getCollectionCaseEvents() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-case-events")
+}
+
+// GetCasesWithHearingsBetween returns the cases with a hearing dated from
+// from (inclusive) to to (exclusive), both compared as RFC 3339 strings.
+func (ar *Repo) GetCasesWithHearingsBetween(from, to string) ([]*Models.Case, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"hearings": bson.M{"$elemMatch": bson.M{"date": bson.M{"$gte": from, "$lt": to}}}}
+	cursor, err := ar.getCollectionCases().Find(ctx, filter)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	cases := []*Models.Case{}
+	if err = cursor.All(ctx, &cases); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return cases, nil
+}
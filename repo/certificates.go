@@ -0,0 +1,146 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/Models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// nextSequence increments a named counter; inside a transaction ctx is the
+// session context.
+func (ar *Repo) nextSequence(ctx context.Context, name string) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := ar.getCollectionCounters().FindOneAndUpdate(ctx, bson.M{"_id": name}, bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&counter)
+	if err != nil {
+		ar.logger.Println(err)
+		return 0, err
+	}
+	return counter.Seq, nil
+}
+func (ar *Repo) NewCertificate(certificate *Models.Certificate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := ar.getCollectionCertificates().InsertOne(ctx, certificate)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	ar.logger.Printf("Documents ID: %v\n", result.InsertedID)
+	return nil
+}
+func (ar *Repo) GetCertificate(number string) (*Models.Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var certificate Models.Certificate
+	err := ar.getCollectionCertificates().FindOne(ctx, bson.M{"number": number}).Decode(&certificate)
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+func (ar *Repo) GetCertificatesByHolder(email string) ([]*Models.Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "issueDate", Value: -1}})
+	cursor, err := ar.getCollectionCertificates().Find(ctx, bson.M{"holderEmail": email}, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	certificates := []*Models.Certificate{}
+	if err := cursor.All(ctx, &certificates); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return certificates, nil
+}
+
+func (ar *Repo) getCollectionCertificates() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-certificates")
+}
+func (ar *Repo) getCollectionCounters() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-counters")
+}
+func (ar *Repo) GetCertificateByShortCode(code string) (*Models.Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var certificate Models.Certificate
+	err := ar.getCollectionCertificates().FindOne(ctx, bson.M{"shortCode": code}).Decode(&certificate)
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// GetRevocation returns the revocation of a document, or nil if it stands.
+func (ar *Repo) GetRevocation(number string) (*Models.Revocation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var revocation Models.Revocation
+	err := ar.getCollectionRevocations().FindOne(ctx, bson.M{"documentNumber": number}).Decode(&revocation)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return &revocation, nil
+}
+
+func (ar *Repo) getCollectionRevocations() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-revocations")
+}
+func (ar *Repo) NewRevocation(revocation *Models.Revocation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := ar.getCollectionRevocations().InsertOne(ctx, revocation)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// SetRevocationReplacement links a revocation to the document replacing
+// it. It returns mongo.ErrNoDocuments when it already has one.
+func (ar *Repo) SetRevocationReplacement(number, replacedBy string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"documentNumber": number, "replacedBy": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"replacedBy": replacedBy}}
+	result, err := ar.getCollectionRevocations().UpdateOne(ctx, filter, update)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteCertificate removes a certificate that was never handed out.
+func (ar *Repo) DeleteCertificate(number string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := ar.getCollectionCertificates().DeleteOne(ctx, bson.M{"number": number})
+	if err != nil {
+		ar.logger.Println(err)
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/docsign"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+func (ar *Repo) NewEvidence(e *Models.Evidence) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := ar.getCollectionEvidence().InsertOne(ctx, e)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	ar.logger.Printf("Documents ID: %v\n", result.InsertedID)
+	return nil
+}
+func (ar *Repo) GetEvidence(caseID, id string) (*Models.Evidence, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var e Models.Evidence
+	err := ar.getCollectionEvidence().FindOne(ctx, bson.M{"caseId": caseID, "id": id}).Decode(&e)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+func (ar *Repo) GetCaseEvidence(caseID string) ([]*Models.Evidence, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "registeredAt", Value: 1}})
+	cursor, err := ar.getCollectionEvidence().Find(ctx, bson.M{"caseId": caseID}, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	items := []*Models.Evidence{}
+	if err := cursor.All(ctx, &items); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// AppendCustodyEntry inserts the next entry of an evidence item's log and
+// moves the item to where the entry leaves it, in one transaction. The
+// unique (evidenceId, seq) index turns a concurrent append into a
+// duplicate key error.
+func (ar *Repo) AppendCustodyEntry(entry *Models.CustodyEntry, holder, location, seal, status string) error {
+	return ar.withTransaction(func(ctx mongo.SessionContext) error {
+		if _, err := ar.getCollectionCustodyLog().InsertOne(ctx, entry); err != nil {
+			return err
+		}
+		update := bson.M{"$set": bson.M{
+			"currentHolder":   holder,
+			"storageLocation": location,
+			"sealNumber":      seal,
+			"status":          status,
+		}}
+		_, err := ar.getCollectionEvidence().UpdateOne(ctx, bson.M{"id": entry.EvidenceID}, update)
+		return err
+	})
+}
+func (ar *Repo) GetCustodyLog(evidenceID string) ([]*Models.CustodyEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := ar.getCollectionCustodyLog().Find(ctx, bson.M{"evidenceId": evidenceID}, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	entries := []*Models.CustodyEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// SetUserSigningKeys replaces the keys a user signs custody entries with.
+func (ar *Repo) SetUserSigningKeys(uuid string, keys []docsign.PublicKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := ar.getCollection().UpdateOne(ctx, bson.M{"uuid": uuid}, bson.M{"$set": bson.M{"signingKeys": keys}})
+	if err != nil {
+		ar.logger.Println(err)
+	}
+	return err
+}
+
+// NewKeyChallenge replaces any challenge the user was issued earlier.
+func (ar *Repo) NewKeyChallenge(c *Models.KeyChallenge) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := ar.getCollectionKeyChallenges().ReplaceOne(ctx, bson.M{"email": c.Email}, c, options.Replace().SetUpsert(true))
+	if err != nil {
+		ar.logger.Println(err)
+	}
+	return err
+}
+
+// TakeKeyChallenge deletes the user's challenge if it matches and is still
+// valid, so each one proves possession only once.
+func (ar *Repo) TakeKeyChallenge(email, challenge string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"email": email, "challenge": challenge, "expiresAt": bson.M{"$gt": time.Now()}}
+	return ar.getCollectionKeyChallenges().FindOneAndDelete(ctx, filter).Err()
+}
+
+func (ar *Repo) getCollectionEvidence() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-evidence")
+}
+func (ar *Repo) getCollectionCustodyLog() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-custody-log")
+}
+func (ar *Repo) getCollectionKeyChallenges() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-key-challenges")
+}
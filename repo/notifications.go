@@ -0,0 +1,189 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/notify"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// NotificationStore backs the notification service.
+type NotificationStore struct {
+	ar *Repo
+}
+
+func (ar *Repo) NotificationStore() *NotificationStore {
+	return &NotificationStore{ar: ar}
+}
+
+func (s *NotificationStore) Recipient(ctx context.Context, email string) (*notify.Recipient, error) {
+	var user Models.User
+	err := s.ar.getCollection().FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if IsNotFound(err) {
+		return &notify.Recipient{Email: email}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &notify.Recipient{Email: email, Known: true, Preferences: user.Notifications}, nil
+}
+func (s *NotificationStore) GetCase(ctx context.Context, id string) (*Models.Case, error) {
+	var c Models.Case
+	err := s.ar.getCollectionCases().FindOne(ctx, bson.M{"ID": id}).Decode(&c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+func (s *NotificationStore) SaveNotifications(ctx context.Context, ns []*notify.Notification) error {
+	docs := make([]interface{}, len(ns))
+	for i, n := range ns {
+		docs[i] = n
+	}
+	// Unordered, so notifications saved by an earlier attempt are skipped
+	// as duplicates while the rest still go in.
+	_, err := s.ar.getCollectionNotifications().InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !IsDuplicate(err) {
+		return err
+	}
+	return nil
+}
+func (s *NotificationStore) ClaimDelivery(ctx context.Context, channel string, now time.Time, lease time.Duration) (*notify.Notification, error) {
+	field := "deliveries." + channel
+	filter := bson.M{
+		field + ".status":        notify.StatusPending,
+		field + ".nextAttemptAt": bson.M{"$lte": now},
+		field + ".leaseUntil":    bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{field + ".leaseUntil": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: field + ".nextAttemptAt", Value: 1}}).SetReturnDocument(options.After)
+	var n notify.Notification
+	err := s.ar.getCollectionNotifications().FindOneAndUpdate(ctx, filter, update, opts).Decode(&n)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+func (s *NotificationStore) SaveDelivery(ctx context.Context, id, channel string, d *notify.Delivery) error {
+	_, err := s.ar.getCollectionNotifications().UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"deliveries." + channel: d}})
+	return err
+}
+
+// GetNotifications returns the user's inbox, newest first.
+func (ar *Repo) GetNotifications(email string, unreadOnly bool, limit int64) ([]*notify.Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"email": email, "inApp": true}
+	if unreadOnly {
+		filter["read"] = false
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cursor, err := ar.getCollectionNotifications().Find(ctx, filter, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	notifications := []*notify.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return notifications, nil
+}
+func (ar *Repo) CountUnreadNotifications(email string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return ar.getCollectionNotifications().CountDocuments(ctx, bson.M{"email": email, "inApp": true, "read": false})
+}
+
+// MarkNotificationsRead marks the user's notification with id read, or all
+// of them when id is empty, and returns how many changed.
+func (ar *Repo) MarkNotificationsRead(email, id string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"email": email, "inApp": true, "read": false}
+	if id != "" {
+		filter["id"] = id
+	}
+	update := bson.M{"$set": bson.M{"read": true, "readAt": time.Now().UTC().Format(time.RFC3339)}}
+	result, err := ar.getCollectionNotifications().UpdateMany(ctx, filter, update)
+	if err != nil {
+		ar.logger.Println(err)
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// GetNotificationDeliveries lists notifications whose delivery over
+// channel has status, newest first.
+func (ar *Repo) GetNotificationDeliveries(channel, status string, limit int64) ([]*notify.Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deliveries." + channel + ".status": status}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cursor, err := ar.getCollectionNotifications().Find(ctx, filter, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	notifications := []*notify.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// RetryNotification queues a failed delivery again with a fresh attempt
+// budget.
+func (ar *Repo) RetryNotification(id, channel string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	field := "deliveries." + channel
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{
+		field + ".status":        notify.StatusPending,
+		field + ".attempts":      0,
+		field + ".nextAttemptAt": now,
+		field + ".leaseUntil":    now,
+	}}
+	result, err := ar.getCollectionNotifications().UpdateOne(ctx, bson.M{"id": id, field + ".status": notify.StatusFailed}, update)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (ar *Repo) SetNotificationPreferences(email string, prefs Models.NotificationPreferences) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := ar.getCollection().UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"notifications": prefs}})
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (ar *Repo) getCollectionNotifications() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-notifications")
+}
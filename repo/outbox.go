@@ -0,0 +1,323 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/caseevents"
+	"github.com/EupravaProjekat/court/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// CommitCaseEvents stores a case's new events, its projection and the
+// outbox messages announcing them in one transaction, so other services
+// hear of exactly the changes that were made. Transactions need Mongo to
+// run as a replica set.
+func (ar *Repo) CommitCaseEvents(events []*caseevents.Event, c *Models.Case, isNew bool, messages []*outbox.Message) error {
+	return ar.withTransaction(func(ctx mongo.SessionContext) error {
+		docs := make([]interface{}, len(events))
+		for i, e := range events {
+			docs[i] = e
+		}
+		if _, err := ar.getCollectionCaseEvents().InsertMany(ctx, docs); err != nil {
+			return err
+		}
+		if isNew {
+			if _, err := ar.getCollectionCases().InsertOne(ctx, c); err != nil {
+				return err
+			}
+		} else if err := ar.saveCaseProjection(ctx, c); err != nil {
+			return err
+		}
+		return ar.insertOutboxMessages(ctx, messages)
+	})
+}
+
+// AddUserRequest appends a request to the user's requests together with
+// the outbox message announcing it. It pushes rather than rewriting the
+// array, so concurrent changes to the user's other requests survive.
+func (ar *Repo) AddUserRequest(uuid string, request Models.Request, messages []*outbox.Message) error {
+	return ar.withTransaction(func(ctx mongo.SessionContext) error {
+		filter := bson.M{"uuid": uuid}
+		result, err := ar.getCollection().UpdateOne(ctx, filter, bson.M{"$push": bson.M{"requests": request}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return ar.insertOutboxMessages(ctx, messages)
+	})
+}
+
+// UpdateUserRequest replaces one of the user's requests, provided it is
+// still in one of the from statuses, together with the outbox messages
+// announcing the change. It returns mongo.ErrNoDocuments when the request
+// is gone or has already moved on.
+func (ar *Repo) UpdateUserRequest(email string, request Models.Request, from []string, messages []*outbox.Message) error {
+	return ar.withTransaction(func(ctx mongo.SessionContext) error {
+		filter := bson.M{
+			"email":    email,
+			"requests": bson.M{"$elemMatch": bson.M{"id": request.ID, "status": bson.M{"$in": from}}},
+		}
+		result, err := ar.getCollection().UpdateOne(ctx, filter, bson.M{"$set": bson.M{"requests.$": request}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return ar.insertOutboxMessages(ctx, messages)
+	})
+}
+
+// withTransaction runs fn in a transaction, retried by the driver on
+// transient errors.
+func (ar *Repo) withTransaction(fn func(ctx mongo.SessionContext) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := ar.cli.StartSession()
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	if err != nil {
+		ar.logger.Println(err)
+	}
+	return err
+}
+
+// insertOutboxMessages numbers messages from the outbox counter. Within a
+// transaction the counter update serialises committers, so Seq follows
+// commit order.
+func (ar *Repo) insertOutboxMessages(ctx context.Context, messages []*outbox.Message) error {
+	for _, m := range messages {
+		seq, err := ar.nextSequence(ctx, "outbox")
+		if err != nil {
+			return err
+		}
+		m.Seq = seq
+		if _, err := ar.getCollectionOutbox().InsertOne(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OutboxStore lets the dispatcher claim and settle deliveries.
+type OutboxStore struct {
+	ar *Repo
+}
+
+func (ar *Repo) OutboxStore() *OutboxStore {
+	return &OutboxStore{ar: ar}
+}
+
+// claimScan bounds how many due deliveries one claim looks at to find one
+// whose aggregate isn't waiting on an earlier delivery.
+const claimScan = 50
+
+// Claim leases the oldest due delivery for sink whose aggregate has no
+// earlier delivery still pending, so a retry holds back the later events
+// of its case instead of being overtaken by them. Dead deliveries don't
+// block.
+func (s *OutboxStore) Claim(ctx context.Context, sink string, now time.Time, lease time.Duration) (*outbox.Message, error) {
+	field := "deliveries." + sink
+	due := bson.M{
+		field + ".status":        outbox.StatusPending,
+		field + ".nextAttemptAt": bson.M{"$lte": now},
+		field + ".leaseUntil":    bson.M{"$lte": now},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "seq", Value: 1}}).
+		SetLimit(claimScan).
+		SetProjection(bson.M{"id": 1, "seq": 1, "aggregateType": 1, "aggregateId": 1})
+	cursor, err := s.ar.getCollectionOutbox().Find(ctx, due, opts)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []*outbox.Message{}
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+	blocked := map[string]bool{}
+	for _, c := range candidates {
+		aggregate := c.AggregateType + "/" + c.AggregateID
+		if blocked[aggregate] {
+			continue
+		}
+		earlier := bson.M{
+			"aggregateType":   c.AggregateType,
+			"aggregateId":     c.AggregateID,
+			"seq":             bson.M{"$lt": c.Seq},
+			field + ".status": outbox.StatusPending,
+		}
+		n, err := s.ar.getCollectionOutbox().CountDocuments(ctx, earlier, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			blocked[aggregate] = true
+			continue
+		}
+		filter := bson.M{"id": c.ID}
+		for k, v := range due {
+			filter[k] = v
+		}
+		update := bson.M{"$set": bson.M{field + ".leaseUntil": now.Add(lease)}}
+		var m outbox.Message
+		err = s.ar.getCollectionOutbox().FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&m)
+		if IsNotFound(err) {
+			// Another dispatcher claimed it first
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &m, nil
+	}
+	return nil, nil
+}
+func (s *OutboxStore) Settle(ctx context.Context, id, sink string, d *outbox.Delivery) error {
+	_, err := s.ar.getCollectionOutbox().UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": bson.M{"deliveries." + sink: d}})
+	return err
+}
+
+// Prune deletes messages every sink received before cutoff. Dead and
+// pending deliveries keep their message.
+func (s *OutboxStore) Prune(ctx context.Context, sinks []string, cutoff time.Time) (int64, error) {
+	if len(sinks) == 0 {
+		return 0, nil
+	}
+	filter := bson.M{}
+	for _, sink := range sinks {
+		field := "deliveries." + sink
+		filter[field+".status"] = outbox.StatusDelivered
+		filter[field+".deliveredAt"] = bson.M{"$lt": cutoff}
+	}
+	result, err := s.ar.getCollectionOutbox().DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// EnsureOutboxIndexes indexes the delivery state of each sink, which
+// claims and the dead-letter views filter on. Sinks are configured at
+// startup, so their indexes can't be in EnsureIndexes.
+func (ar *Repo) EnsureOutboxIndexes(sinks []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	models := make([]mongo.IndexModel, len(sinks))
+	for i, sink := range sinks {
+		field := "deliveries." + sink
+		models[i] = mongo.IndexModel{Keys: bson.D{{Key: field + ".status", Value: 1}, {Key: "seq", Value: 1}}}
+	}
+	if len(models) == 0 {
+		return
+	}
+	if _, err := ar.getCollectionOutbox().Indexes().CreateMany(ctx, models); err != nil {
+		ar.logger.Println(err)
+	}
+}
+
+// StreamStore lets the event stream tail the outbox.
+type StreamStore struct {
+	ar *Repo
+}
+
+func (ar *Repo) StreamStore() *StreamStore {
+	return &StreamStore{ar: ar}
+}
+
+func (s *StreamStore) MessagesAfter(ctx context.Context, seq int64, limit int64) ([]*outbox.Message, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "seq", Value: 1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"deliveries": 0})
+	cursor, err := s.ar.getCollectionOutbox().Find(ctx, bson.M{"seq": bson.M{"$gt": seq}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	messages := []*outbox.Message{}
+	err = cursor.All(ctx, &messages)
+	return messages, err
+}
+
+func (s *StreamStore) LastSeq(ctx context.Context) (int64, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}}).SetProjection(bson.M{"seq": 1})
+	var m outbox.Message
+	err := s.ar.getCollectionOutbox().FindOne(ctx, bson.M{}, opts).Decode(&m)
+	if IsNotFound(err) {
+		return 0, nil
+	}
+	return m.Seq, err
+}
+
+// GetOutboxMessages lists messages, newest first, optionally only those
+// whose delivery to sink has status.
+func (ar *Repo) GetOutboxMessages(sink, status string, limit int64) ([]*outbox.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if sink != "" && status != "" {
+		filter["deliveries."+sink+".status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: -1}}).SetLimit(limit)
+	cursor, err := ar.getCollectionOutbox().Find(ctx, filter, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	messages := []*outbox.Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return messages, nil
+}
+func (ar *Repo) CountOutboxMessages(sink, status string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return ar.getCollectionOutbox().CountDocuments(ctx, bson.M{"deliveries." + sink + ".status": status})
+}
+
+// RetryOutboxMessage puts a dead or failing delivery back in line with a
+// fresh attempt budget.
+func (ar *Repo) RetryOutboxMessage(id, sink string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	field := "deliveries." + sink
+	filter := bson.M{"id": id, field + ".status": bson.M{"$in": bson.A{outbox.StatusPending, outbox.StatusDead}}}
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{
+		field + ".status":        outbox.StatusPending,
+		field + ".attempts":      0,
+		field + ".nextAttemptAt": now,
+		field + ".leaseUntil":    now,
+	}}
+	result, err := ar.getCollectionOutbox().UpdateOne(ctx, filter, update)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (ar *Repo) getCollectionOutbox() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-outbox")
+}
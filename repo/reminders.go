@@ -0,0 +1,124 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/reminders"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// ReminderStore backs the reminder scheduler.
+type ReminderStore struct {
+	ar *Repo
+}
+
+func (ar *Repo) ReminderStore() *ReminderStore {
+	return &ReminderStore{ar: ar}
+}
+
+func (s *ReminderStore) AddJobs(ctx context.Context, jobs []*reminders.Job) error {
+	keys := make([]string, len(jobs))
+	docs := make([]interface{}, len(jobs))
+	for i, j := range jobs {
+		keys[i] = j.Key
+		docs[i] = j
+	}
+	// A hearing moved back to an earlier date gets its cancelled jobs back
+	now := time.Now().UTC()
+	revive := bson.M{"$set": bson.M{"status": reminders.StatusPending, "attempts": 0, "leaseUntil": now, "lastError": ""}}
+	filter := bson.M{"key": bson.M{"$in": keys}, "status": reminders.StatusCancelled}
+	if _, err := s.ar.getCollectionReminders().UpdateMany(ctx, filter, revive); err != nil {
+		return err
+	}
+	// Unordered, so jobs already stored are skipped as duplicates while the
+	// rest still go in.
+	_, err := s.ar.getCollectionReminders().InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !IsDuplicate(err) {
+		return err
+	}
+	return nil
+}
+func (s *ReminderStore) CancelJobs(ctx context.Context, target, targetID string, keep time.Time) error {
+	filter := bson.M{
+		"target":   target,
+		"targetId": targetID,
+		"status":   reminders.StatusPending,
+		"dueAt":    bson.M{"$ne": keep},
+	}
+	_, err := s.ar.getCollectionReminders().UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": reminders.StatusCancelled}})
+	return err
+}
+func (s *ReminderStore) ClaimJob(ctx context.Context, now time.Time, lease time.Duration) (*reminders.Job, error) {
+	filter := bson.M{
+		"status":     reminders.StatusPending,
+		"fireAt":     bson.M{"$lte": now},
+		"leaseUntil": bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"leaseUntil": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "fireAt", Value: 1}}).SetReturnDocument(options.After)
+	var j reminders.Job
+	err := s.ar.getCollectionReminders().FindOneAndUpdate(ctx, filter, update, opts).Decode(&j)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+func (s *ReminderStore) SaveJob(ctx context.Context, j *reminders.Job) error {
+	// Only a job still pending is saved, so one cancelled while it fired
+	// stays cancelled
+	_, err := s.ar.getCollectionReminders().ReplaceOne(ctx, bson.M{"id": j.ID, "status": reminders.StatusPending}, j)
+	return err
+}
+func (s *ReminderStore) UpcomingCases(ctx context.Context, since time.Time) ([]*Models.Case, error) {
+	from := since.UTC().Format(time.RFC3339)
+	filter := bson.M{"$or": bson.A{
+		bson.M{"hearings.date": bson.M{"$gte": from}},
+		bson.M{"deadlines.due": bson.M{"$gte": from}},
+	}}
+	cursor, err := s.ar.getCollectionCases().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	cases := []*Models.Case{}
+	if err := cursor.All(ctx, &cases); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// GetReminders lists the reminders of a case, or of all cases when caseID
+// is empty, soonest first.
+func (ar *Repo) GetReminders(caseID, status string, limit int64) ([]*reminders.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if caseID != "" {
+		filter["caseId"] = caseID
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "fireAt", Value: 1}}).SetLimit(limit)
+	cursor, err := ar.getCollectionReminders().Find(ctx, filter, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	jobs := []*reminders.Job{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (ar *Repo) getCollectionReminders() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-reminders")
+}
@@ -2,6 +2,7 @@ package Repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/EupravaProjekat/court/Models"
 	"go.mongodb.org/mongo-driver/bson"
@@ -59,6 +60,148 @@ func (ar *Repo) Ping() {
 	}
 	fmt.Println(databases)
 }
+
+// RequireReplicaSet fails unless Mongo runs as a replica set or behind
+// mongos. The court commits every case change together with its events
+// and outbox messages in one transaction, and standalone servers have no
+// transactions.
+func (ar *Repo) RequireReplicaSet() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := ar.cli.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return fmt.Errorf("checking the Mongo deployment: %w", err)
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return errors.New("the Mongo server is standalone, but the court needs transactions: start mongod with --replSet and run rs.initiate()")
+	}
+	return nil
+}
+
+// EnsureIndexes creates the unique and TTL indexes the collections rely on
+func (ar *Repo) EnsureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for collection, models := range ar.indexes() {
+		if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+			ar.logger.Println(err)
+		}
+	}
+}
+
+// indexes lists the indexes EnsureIndexes creates, by collection.
+func (ar *Repo) indexes() map[*mongo.Collection][]mongo.IndexModel {
+	return map[*mongo.Collection][]mongo.IndexModel{
+		ar.getCollection(): {
+			{Keys: bson.D{{Key: "requests.id", Value: 1}}},
+			{Keys: bson.D{{Key: "requests.status", Value: 1}, {Key: "requests.created_at", Value: 1}}},
+		},
+		ar.getCollectionCases(): {
+			{Keys: bson.D{{Key: "ID", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "defendantEmail", Value: 1}}},
+			{Keys: bson.D{{Key: "plaintiffEmail", Value: 1}}},
+			{Keys: bson.D{{Key: "defendantNationalId", Value: 1}}},
+			{Keys: bson.D{{Key: "hearings.date", Value: 1}}},
+		},
+		ar.getCollectionCaseEvents(): {
+			{Keys: bson.D{{Key: "caseId", Value: 1}, {Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		ar.getCollectionOutbox(): {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "aggregateType", Value: 1}, {Key: "aggregateId", Value: 1}, {Key: "seq", Value: 1}}},
+		},
+		ar.getCollectionWebhooks(): {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		ar.getCollectionWebhookDeliveries(): {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "subscriptionId", Value: 1}, {Key: "messageId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+		},
+		ar.getCollectionNotifications(): {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "sourceId", Value: 1}, {Key: "email", Value: 1}, {Key: "kind", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "email", Value: 1}, {Key: "createdAt", Value: -1}}},
+			{Keys: bson.D{{Key: "deliveries.email.status", Value: 1}, {Key: "deliveries.email.nextAttemptAt", Value: 1}}},
+		},
+		ar.getCollectionReminders(): {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "fireAt", Value: 1}}},
+			{Keys: bson.D{{Key: "target", Value: 1}, {Key: "targetId", Value: 1}}},
+			{Keys: bson.D{{Key: "caseId", Value: 1}, {Key: "fireAt", Value: 1}}},
+		},
+		ar.getCollectionCache(): {
+			{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "tags", Value: 1}}},
+			{Keys: bson.D{{Key: "staleUntil", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		ar.getCollectionCertificates(): {
+			{Keys: bson.D{{Key: "number", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "holderEmail", Value: 1}}},
+			{Keys: bson.D{{Key: "shortCode", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+		},
+		ar.getCollectionSigningKeys(): {
+			{Keys: bson.D{{Key: "keyId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		ar.getCollectionRevocations(): {
+			{Keys: bson.D{{Key: "documentNumber", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		ar.getCollectionCaseDocuments(): {
+			{Keys: bson.D{{Key: "caseId", Value: 1}, {Key: "id", Value: 1}, {Key: "version", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		ar.getCollectionAudit(): {
+			{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "actor", Value: 1}}},
+			{Keys: bson.D{{Key: "target", Value: 1}}},
+		},
+		ar.getCollectionAuditPending(): {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "queuedAt", Value: 1}, {Key: "id", Value: 1}}},
+		},
+		ar.getCollectionEvidence(): {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "caseId", Value: 1}}},
+		},
+		ar.getCollectionCustodyLog(): {
+			{Keys: bson.D{{Key: "evidenceId", Value: 1}, {Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		ar.getCollectionKeyChallenges(): {
+			{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		ar.getCollectionServiceClients(): {
+			{Keys: bson.D{{Key: "clientId", Value: 1}}, Options: options.Index().SetUnique(true)},
+			// One live client per certificate subject; revoked ones keep theirs
+			{Keys: bson.D{{Key: "certSubject", Value: 1}}, Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"certSubject": bson.M{"$exists": true}, "revoked": false})},
+		},
+		ar.getCollectionReplays(): {
+			{Keys: bson.D{{Key: "signature", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		ar.getCollectionStreamTickets(): {
+			{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		ar.getCollectionSessions(): {
+			{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "email", Value: 1}}},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		ar.getCollectionRevokedTokens(): {
+			{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+	}
+}
 func (ar *Repo) GetAll() ([]*Models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -239,6 +382,23 @@ func (ar *Repo) Update(User *Models.User) error {
 	return nil
 }
 
+// SetUserIdentity stores the identity the identity provider vouched for.
+func (ar *Repo) SetUserIdentity(email, fullName, nationalID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"fullName": fullName, "nationalId": nationalID}}
+	result, err := ar.getCollection().UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
 func (ar *Repo) Create(user *Models.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -281,3 +441,70 @@ func (ar *Repo) getCollectionCases() *mongo.Collection {
 	accommodationCollection := accommodationDatabase.Collection("court-cases")
 	return accommodationCollection
 }
+func (ar *Repo) GetCase(id string) (*Models.Case, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var c Models.Case
+	err := ar.getCollectionCases().FindOne(ctx, bson.M{"ID": id}).Decode(&c)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCasesOfParty returns the cases the email is plaintiff, defendant or
+// lawyer in.
+func (ar *Repo) GetCasesOfParty(email string) ([]*Models.Case, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"plaintiffEmail": email},
+		bson.M{"defendantEmail": email},
+		bson.M{"lawyerEmails": email},
+	}}
+	cursor, err := ar.getCollectionCases().Find(ctx, filter)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	var cases []*Models.Case
+	if err := cursor.All(ctx, &cases); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return cases, nil
+}
+
+// FindCasesByDefendant returns the cases where the person, identified by
+// email and/or national ID, is the defendant. It leaves out filings court
+// staff haven't verified, so nobody gets a record from a citizen naming
+// them.
+func (ar *Repo) FindCasesByDefendant(email, nationalID string) ([]*Models.Case, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var or bson.A
+	if email != "" {
+		or = append(or, bson.M{"defendantEmail": email})
+	}
+	if nationalID != "" {
+		or = append(or, bson.M{"defendantNationalId": nationalID})
+	}
+	if len(or) == 0 {
+		return nil, nil
+	}
+	cursor, err := ar.getCollectionCases().Find(ctx, bson.M{"$or": or, "unverified": bson.M{"$ne": true}})
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	var cases []*Models.Case
+	if err := cursor.All(ctx, &cases); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return cases, nil
+}
@@ -0,0 +1,55 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/Models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// GetUserByRequestID finds the user who filed the request.
+func (ar *Repo) GetUserByRequestID(id string) (*Models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user Models.User
+	err := ar.getCollection().FindOne(ctx, bson.M{"requests.id": id}).Decode(&user)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetStaleRequests returns up to limit requests in the given status
+// created before the RFC 3339 time before, oldest first, with the email of
+// the user who filed each. Requests whose ID is in skip are left out.
+func (ar *Repo) GetStaleRequests(status, before string, skip []string, limit int64) ([]*Models.UserRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := ar.getCollection().Aggregate(ctx, staleRequestsPipeline(status, before, skip, limit))
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	requests := []*Models.UserRequest{}
+	if err = cursor.All(ctx, &requests); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return requests, nil
+}
+func staleRequestsPipeline(status, before string, skip []string, limit int64) mongo.Pipeline {
+	stale := bson.M{"requests.status": status, "requests.created_at": bson.M{"$lt": before}}
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"requests": bson.M{"$elemMatch": bson.M{"status": status, "created_at": bson.M{"$lt": before}}}}}},
+		{{Key: "$unwind", Value: "$requests"}},
+		{{Key: "$match", Value: stale}},
+		{{Key: "$match", Value: bson.M{"requests.id": bson.M{"$nin": skip}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "requests.created_at", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "email": 1, "request": "$requests"}}},
+	}
+}
@@ -0,0 +1,45 @@
+package Repo
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestStaleRequestsPipeline(t *testing.T) {
+	pipeline := staleRequestsPipeline("pending", "2024-03-01T10:00:00Z", []string{"r7"}, 100)
+	stage := func(name string) (int, interface{}) {
+		for i, s := range pipeline {
+			if s[0].Key == name {
+				return i, s[0].Value
+			}
+		}
+		return -1, nil
+	}
+
+	sortAt, sortBy := stage("$sort")
+	limitAt, limit := stage("$limit")
+	if sortAt < 0 || limitAt < sortAt {
+		t.Fatalf("pipeline must sort before it limits: %v", pipeline)
+	}
+	// Oldest first, so a backlog drains in the order it built up
+	if by, ok := sortBy.(bson.D); !ok || len(by) != 1 || by[0].Key != "requests.created_at" || by[0].Value != 1 {
+		t.Errorf("$sort = %v, want requests.created_at ascending", sortBy)
+	}
+	if limit != int64(100) {
+		t.Errorf("$limit = %v, want 100", limit)
+	}
+
+	skipped := false
+	for _, s := range pipeline[:limitAt] {
+		if m, ok := s[0].Value.(bson.M); ok && s[0].Key == "$match" {
+			if nin, ok := m["requests.id"].(bson.M); ok {
+				ids, _ := nin["$nin"].([]string)
+				skipped = len(ids) == 1 && ids[0] == "r7"
+			}
+		}
+	}
+	if !skipped {
+		t.Errorf("pipeline doesn't leave out skipped requests before limiting: %v", pipeline)
+	}
+}
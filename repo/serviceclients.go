@@ -0,0 +1,121 @@
+package Repo
+
+import (
+	"context"
+	"errors"
+	"github.com/EupravaProjekat/court/Models"
+	"github.com/EupravaProjekat/court/serviceauth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+func (ar *Repo) NewServiceClient(client *Models.ServiceClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := ar.getCollectionServiceClients().InsertOne(ctx, client)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	ar.logger.Printf("Documents ID: %v\n", result.InsertedID)
+	return nil
+}
+func (ar *Repo) GetServiceClient(clientID string) (*Models.ServiceClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var client Models.ServiceClient
+	err := ar.getCollectionServiceClients().FindOne(ctx, bson.M{"clientId": clientID}).Decode(&client)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+func (ar *Repo) GetServiceClientByCertSubject(subject string) (*Models.ServiceClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var client Models.ServiceClient
+	err := ar.getCollectionServiceClients().FindOne(ctx, bson.M{"certSubject": subject, "revoked": false}).Decode(&client)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+func (ar *Repo) GetAllServiceClients() ([]*Models.ServiceClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := ar.getCollectionServiceClients().Find(ctx, bson.M{})
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var clients []*Models.ServiceClient
+	if err := cursor.All(ctx, &clients); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return clients, nil
+}
+func (ar *Repo) RevokeServiceClient(clientID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"clientId": clientID}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked":   true,
+			"revokedAt": time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	result, err := ar.getCollectionServiceClients().UpdateOne(ctx, filter, update)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// ReplayStore keeps seen request signatures in Mongo so a request replayed
+// to another replica is caught too. Expired signatures are dropped by a TTL
+// index.
+type ReplayStore struct {
+	ar *Repo
+}
+
+func (ar *Repo) ReplayStore() *ReplayStore {
+	return &ReplayStore{ar: ar}
+}
+
+func (s *ReplayStore) Remember(ctx context.Context, signature string, expires time.Time) error {
+	_, err := s.ar.getCollectionReplays().InsertOne(ctx, bson.M{"signature": signature, "expiresAt": expires})
+	if IsDuplicate(err) {
+		return serviceauth.ErrReplayed
+	}
+	return err
+}
+
+// IsNotFound reports whether a lookup failed only because nothing matched.
+func IsNotFound(err error) bool {
+	return errors.Is(err, mongo.ErrNoDocuments)
+}
+
+// IsDuplicate reports whether an insert hit a unique index.
+func IsDuplicate(err error) bool {
+	return mongo.IsDuplicateKeyError(err)
+}
+
+func (ar *Repo) getCollectionServiceClients() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-service-clients")
+}
+func (ar *Repo) getCollectionReplays() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-service-replays")
+}
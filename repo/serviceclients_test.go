@@ -0,0 +1,69 @@
+package Repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestServiceClientSubjectsAreUnique(t *testing.T) {
+	ctx := context.Background()
+	// Connect doesn't dial; building the index list needs only collection handles
+	cli, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Disconnect(ctx)
+	ar := &Repo{cli: cli, logger: log.New(io.Discard, "", 0)}
+
+	var found bool
+	for collection, models := range ar.indexes() {
+		if collection.Name() != "court-service-clients" {
+			continue
+		}
+		for _, m := range models {
+			keys, ok := m.Keys.(bson.D)
+			if !ok || len(keys) != 1 || keys[0].Key != "certSubject" {
+				continue
+			}
+			found = true
+			if m.Options == nil || m.Options.Unique == nil || !*m.Options.Unique {
+				t.Error("certSubject index isn't unique")
+			}
+			// Revoked clients mustn't block a new client with their subject
+			filter, _ := m.Options.PartialFilterExpression.(bson.M)
+			if filter["revoked"] != false {
+				t.Errorf("certSubject index filter = %v, want live clients only", m.Options.PartialFilterExpression)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("no index on service client certSubject")
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	duplicate := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{duplicate, true},
+		{fmt.Errorf("insert: %w", duplicate), true},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121}}}, false},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsDuplicate(tt.err); got != tt.want {
+			t.Errorf("IsDuplicate(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/Models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+func (ar *Repo) NewSession(session *Models.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := ar.getCollectionSessions().InsertOne(ctx, session)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	return nil
+}
+func (ar *Repo) GetSession(id string) (*Models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session Models.Session
+	err := ar.getCollectionSessions().FindOne(ctx, bson.M{"id": id}).Decode(&session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RotateSession swaps the refresh token hash only if the presented one is
+// still current, so each refresh token can be used exactly once.
+func (ar *Repo) RotateSession(id, oldHash, newHash, jti string, accessExp time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"id": id, "refreshHash": oldHash, "revoked": false}
+	update := bson.M{
+		"$set": bson.M{
+			"refreshHash": newHash,
+			"accessJti":   jti,
+			"accessExp":   accessExp,
+		},
+	}
+	result, err := ar.getCollectionSessions().UpdateOne(ctx, filter, update)
+	if err != nil {
+		ar.logger.Println(err)
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// RevokeSessions marks the matching active sessions revoked and returns them
+// so their outstanding access tokens can be denylisted.
+func (ar *Repo) RevokeSessions(filter bson.M) ([]*Models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter["revoked"] = false
+	cursor, err := ar.getCollectionSessions().Find(ctx, filter)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	var sessions []*Models.Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked":   true,
+			"revokedAt": time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	result, err := ar.getCollectionSessions().UpdateMany(ctx, filter, update)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	ar.logger.Printf("Sessions revoked: %v\n", result.ModifiedCount)
+	return sessions, nil
+}
+func (ar *Repo) RevokeSession(id string) ([]*Models.Session, error) {
+	return ar.RevokeSessions(bson.M{"id": id})
+}
+func (ar *Repo) RevokeSessionsByEmail(email string) ([]*Models.Session, error) {
+	return ar.RevokeSessions(bson.M{"email": email})
+}
+func (ar *Repo) RevokeToken(jti string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"jti": jti}
+	update := bson.M{"$set": Models.RevokedToken{Jti: jti, ExpiresAt: expiresAt}}
+	_, err := ar.getCollectionRevokedTokens().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	return nil
+}
+
+// ConsumeToken denylists jti and reports whether this call did so, letting
+// a token be exchanged only once even by concurrent requests.
+func (ar *Repo) ConsumeToken(jti string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := ar.getCollectionRevokedTokens().InsertOne(ctx, Models.RevokedToken{Jti: jti, ExpiresAt: expiresAt})
+	if IsDuplicate(err) {
+		return false, nil
+	}
+	if err != nil {
+		ar.logger.Println(err)
+		return false, err
+	}
+	return true, nil
+}
+
+// IsTokenRevoked fails closed: if the denylist can't be read the token is
+// treated as revoked.
+func (ar *Repo) IsTokenRevoked(jti string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := ar.getCollectionRevokedTokens().FindOne(ctx, bson.M{"jti": jti}).Err()
+	if IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		ar.logger.Println(err)
+	}
+	return true
+}
+
+// NewStreamTicket stores a ticket for TakeStreamTicket to redeem.
+func (ar *Repo) NewStreamTicket(t *Models.StreamTicket) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := ar.getCollectionStreamTickets().InsertOne(ctx, t)
+	if err != nil {
+		ar.logger.Println(err)
+	}
+	return err
+}
+
+// TakeStreamTicket deletes and returns the unexpired ticket with the given
+// hash, so each ticket opens one stream.
+func (ar *Repo) TakeStreamTicket(hash string) (*Models.StreamTicket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var t Models.StreamTicket
+	filter := bson.M{"hash": hash, "expiresAt": bson.M{"$gt": time.Now()}}
+	err := ar.getCollectionStreamTickets().FindOneAndDelete(ctx, filter).Decode(&t)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (ar *Repo) getCollectionSessions() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-sessions")
+}
+func (ar *Repo) getCollectionRevokedTokens() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-revoked-tokens")
+}
+func (ar *Repo) getCollectionStreamTickets() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-stream-tickets")
+}
@@ -0,0 +1,120 @@
+package Repo
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"github.com/EupravaProjekat/court/docsign"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// signingKeyDocument is the public half of a court signing key. The
+// private half lives in the key directory, never here.
+type signingKeyDocument struct {
+	docsign.PublicKey `bson:",inline"`
+	Active            bool `bson:"active"`
+}
+
+// GetActiveSigningKey returns the public half of the key documents are
+// signed with now.
+func (ar *Repo) GetActiveSigningKey() (*docsign.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var doc signingKeyDocument
+	err := ar.getCollectionSigningKeys().FindOne(ctx, bson.M{"active": true}).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc.PublicKey, nil
+}
+
+// GetSigningPublicKeys returns every key ever used, retired ones included.
+func (ar *Repo) GetSigningPublicKeys() ([]docsign.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetProjection(bson.M{"privateKey": 0})
+	cursor, err := ar.getCollectionSigningKeys().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	var docs []signingKeyDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	keys := make([]docsign.PublicKey, 0, len(docs))
+	for _, d := range docs {
+		keys = append(keys, d.PublicKey)
+	}
+	return keys, nil
+}
+
+// RotateSigningKey retires the active key and publishes key as the new
+// active one. A key that was ever used can't be activated again.
+func (ar *Repo) RotateSigningKey(key docsign.PublicKey) error {
+	return ar.withTransaction(func(ctx mongo.SessionContext) error {
+		collection := ar.getCollectionSigningKeys()
+		retire := bson.M{"$set": bson.M{"active": false, "retiredAt": time.Now().UTC().Format(time.RFC3339)}}
+		if _, err := collection.UpdateMany(ctx, bson.M{"active": true}, retire); err != nil {
+			return err
+		}
+		if _, err := collection.InsertOne(ctx, signingKeyDocument{PublicKey: key, Active: true}); err != nil {
+			return err
+		}
+		ar.logger.Printf("Signing key rotated to %v\n", key.KeyID)
+		return nil
+	})
+}
+
+// GetStoredSigningPrivateKeys returns the private keys earlier versions
+// kept next to the public ones, so they can be moved to the key directory.
+func (ar *Repo) GetStoredSigningPrivateKeys() ([]*docsign.Key, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := ar.getCollectionSigningKeys().Find(ctx, bson.M{"privateKey": bson.M{"$exists": true}})
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	var docs []struct {
+		docsign.PublicKey `bson:",inline"`
+		PrivateKey        string `bson:"privateKey"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	keys := make([]*docsign.Key, 0, len(docs))
+	for _, d := range docs {
+		private, err := base64.StdEncoding.DecodeString(d.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &docsign.Key{PublicKey: d.PublicKey, Private: ed25519.PrivateKey(private)})
+	}
+	return keys, nil
+}
+
+// DeleteStoredSigningPrivateKey drops a private key earlier versions kept
+// in the database.
+func (ar *Repo) DeleteStoredSigningPrivateKey(keyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := ar.getCollectionSigningKeys().UpdateOne(ctx, bson.M{"keyId": keyID}, bson.M{"$unset": bson.M{"privateKey": ""}})
+	if err != nil {
+		ar.logger.Println(err)
+	}
+	return err
+}
+
+func (ar *Repo) getCollectionSigningKeys() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-signing-keys")
+}
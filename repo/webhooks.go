@@ -0,0 +1,213 @@
+package Repo
+
+import (
+	"context"
+	"github.com/EupravaProjekat/court/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// WebhookStore backs the webhook worker.
+type WebhookStore struct {
+	ar *Repo
+}
+
+func (ar *Repo) WebhookStore() *WebhookStore {
+	return &WebhookStore{ar: ar}
+}
+
+func (s *WebhookStore) ActiveSubscriptions(ctx context.Context) ([]*webhooks.Subscription, error) {
+	cursor, err := s.ar.getCollectionWebhooks().Find(ctx, bson.M{"active": true})
+	if err != nil {
+		return nil, err
+	}
+	subs := []*webhooks.Subscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+func (s *WebhookStore) GetSubscription(ctx context.Context, id string) (*webhooks.Subscription, error) {
+	var sub webhooks.Subscription
+	err := s.ar.getCollectionWebhooks().FindOne(ctx, bson.M{"id": id}).Decode(&sub)
+	if IsNotFound(err) {
+		return nil, webhooks.ErrNoSubscription
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+func (s *WebhookStore) EnqueueDeliveries(ctx context.Context, deliveries []*webhooks.Delivery) error {
+	docs := make([]interface{}, len(deliveries))
+	for i, d := range deliveries {
+		docs[i] = d
+	}
+	// Unordered, so deliveries enqueued by an earlier attempt are skipped
+	// as duplicates while the rest still go in.
+	_, err := s.ar.getCollectionWebhookDeliveries().InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !IsDuplicate(err) {
+		return err
+	}
+	return nil
+}
+func (s *WebhookStore) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*webhooks.Delivery, error) {
+	filter := bson.M{
+		"status":        webhooks.StatusPending,
+		"nextAttemptAt": bson.M{"$lte": now},
+		"leaseUntil":    bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"leaseUntil": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).SetReturnDocument(options.After)
+	var d webhooks.Delivery
+	err := s.ar.getCollectionWebhookDeliveries().FindOneAndUpdate(ctx, filter, update, opts).Decode(&d)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+func (s *WebhookStore) SaveDelivery(ctx context.Context, d *webhooks.Delivery) error {
+	_, err := s.ar.getCollectionWebhookDeliveries().ReplaceOne(ctx, bson.M{"id": d.ID}, d)
+	return err
+}
+func (s *WebhookStore) RecordResult(ctx context.Context, subscriptionID string, ok bool) (int, error) {
+	update := bson.M{"$inc": bson.M{"consecutiveFailures": 1}}
+	if ok {
+		update = bson.M{"$set": bson.M{"consecutiveFailures": 0}}
+	}
+	var sub webhooks.Subscription
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := s.ar.getCollectionWebhooks().FindOneAndUpdate(ctx, bson.M{"id": subscriptionID}, update, opts).Decode(&sub)
+	if err != nil {
+		return 0, err
+	}
+	return sub.ConsecutiveFailures, nil
+}
+func (s *WebhookStore) DisableSubscription(ctx context.Context, id, reason string) error {
+	update := bson.M{"$set": bson.M{"active": false, "disabledReason": reason}}
+	_, err := s.ar.getCollectionWebhooks().UpdateOne(ctx, bson.M{"id": id, "active": true}, update)
+	return err
+}
+
+func (ar *Repo) NewWebhook(sub *webhooks.Subscription) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := ar.getCollectionWebhooks().InsertOne(ctx, sub)
+	if err != nil {
+		ar.logger.Println(err)
+	}
+	return err
+}
+func (ar *Repo) GetWebhook(id string) (*webhooks.Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return ar.WebhookStore().GetSubscription(ctx, id)
+}
+func (ar *Repo) GetAllWebhooks() ([]*webhooks.Subscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := ar.getCollectionWebhooks().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	subs := []*webhooks.Subscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return subs, nil
+}
+
+// UpdateWebhook saves a changed subscription; re-enabling it clears the
+// failure streak.
+func (ar *Repo) UpdateWebhook(sub *webhooks.Subscription) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := ar.getCollectionWebhooks().ReplaceOne(ctx, bson.M{"id": sub.ID}, sub)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+func (ar *Repo) DeleteWebhook(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := ar.getCollectionWebhooks().DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the subscription's deliveries, newest first.
+func (ar *Repo) GetWebhookDeliveries(subscriptionID, status string, limit int64) ([]*webhooks.Delivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"subscriptionId": subscriptionID}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cursor, err := ar.getCollectionWebhookDeliveries().Find(ctx, filter, opts)
+	if err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	deliveries := []*webhooks.Delivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		ar.logger.Println(err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RedeliverWebhook queues a delivery again, whatever its state, with a
+// fresh attempt budget. Its attempt log is kept.
+func (ar *Repo) RedeliverWebhook(subscriptionID, deliveryID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{
+		"status":        webhooks.StatusPending,
+		"attemptCount":  0,
+		"nextAttemptAt": now,
+		"leaseUntil":    now,
+	}}
+	result, err := ar.getCollectionWebhookDeliveries().UpdateOne(ctx, bson.M{"id": deliveryID, "subscriptionId": subscriptionID}, update)
+	if err != nil {
+		ar.logger.Println(err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (ar *Repo) getCollectionWebhooks() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-webhooks")
+}
+func (ar *Repo) getCollectionWebhookDeliveries() *mongo.Collection {
+	return ar.cli.Database("mongoCourt").Collection("court-webhook-deliveries")
+}
@@ -0,0 +1,194 @@
+package serviceauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers carried by every signed service-to-service call.
+const (
+	HeaderClientID  = "X-Client-Id"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderSignature = "X-Signature"
+)
+
+// Scopes that can be granted to a service client.
+const (
+	ScopeProsecutionCheck = "prosecution:check"
+	ScopeRequestsRead     = "requests:read"
+	ScopeCasesRead        = "cases:read"
+	// Granted to the prosecution service to answer case status requests
+	ScopeProsecutionCallback = "prosecution:callback"
+)
+
+// ReplayWindow is how far a request timestamp may drift from the server clock.
+const ReplayWindow = 5 * time.Minute
+
+// MaxBodySize caps how large a signed body may be.
+const MaxBodySize = 1 << 20
+
+var (
+	ErrBodyTooLarge   = errors.New("request body too large")
+	ErrMissingHeaders = errors.New("missing service authentication headers")
+	ErrBadTimestamp   = errors.New("request timestamp outside of allowed window")
+	ErrBadSignature   = errors.New("invalid request signature")
+	ErrReplayed       = errors.New("request signature already used")
+)
+
+// NewSecret generates a random client secret, returned once at issuance.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// BodyDigest returns the hex encoded SHA-256 digest of a request body.
+func BodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// StringToSign builds the canonical string both sides sign.
+func StringToSign(method, requestURI, timestamp string, body []byte) string {
+	return method + "\n" + requestURI + "\n" + timestamp + "\n" + BodyDigest(body)
+}
+
+// Signature computes the hex HMAC-SHA256 of the canonical string.
+func Signature(secret, method, requestURI, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(StringToSign(method, requestURI, timestamp, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign adds the authentication headers to an outgoing request.
+func Sign(req *http.Request, clientID, secret string, body []byte) {
+	ts := strconv.FormatInt(time.Now().UTC().Unix(), 10)
+	req.Header.Set(HeaderClientID, clientID)
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, Signature(secret, req.Method, req.URL.RequestURI(), ts, body))
+}
+
+// ReadBody reads the request body for verification and puts it back so the
+// handler can decode it again. A body over MaxBodySize is refused with
+// ErrBodyTooLarge rather than verified in part.
+func ReadBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// Verify checks the timestamp window and signature of an incoming request
+// against the client's secret.
+func Verify(r *http.Request, secret string, body []byte, now time.Time) error {
+	ts := r.Header.Get(HeaderTimestamp)
+	sig := r.Header.Get(HeaderSignature)
+	if ts == "" || sig == "" {
+		return ErrMissingHeaders
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrBadTimestamp
+	}
+	drift := now.Sub(time.Unix(unix, 0))
+	if drift > ReplayWindow || drift < -ReplayWindow {
+		return ErrBadTimestamp
+	}
+	expected := Signature(secret, r.Method, r.URL.RequestURI(), ts, body)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// ReplayStore remembers signatures seen inside the replay window so a
+// captured request cannot be sent a second time. Every replica must share
+// it, or a request replayed to another replica goes through.
+type ReplayStore interface {
+	// Remember records the signature until expires and returns ErrReplayed
+	// if it is already recorded.
+	Remember(ctx context.Context, signature string, expires time.Time) error
+}
+
+// CheckReplay records the signature in store for twice the replay window,
+// which covers the drift allowed either way.
+func CheckReplay(ctx context.Context, store ReplayStore, signature string, now time.Time) error {
+	return store.Remember(ctx, signature, now.Add(2*ReplayWindow))
+}
+
+// ReplayCache is a ReplayStore for a single process, such as a test or a
+// lone replica.
+type ReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: make(map[string]time.Time)}
+}
+
+func (c *ReplayCache) Remember(ctx context.Context, signature string, expires time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for sig, exp := range c.seen {
+		if now.After(exp) {
+			delete(c.seen, sig)
+		}
+	}
+	if _, ok := c.seen[signature]; ok {
+		return ErrReplayed
+	}
+	c.seen[signature] = expires
+	return nil
+}
+
+type identityKey struct{}
+
+// Identity describes the authenticated calling service.
+type Identity struct {
+	ClientID string
+	Name     string
+	Scopes   []string
+}
+
+// HasScope reports whether the identity was granted the scope.
+func (i *Identity) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFrom returns the calling service identity, or nil for user calls.
+func IdentityFrom(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
@@ -0,0 +1,99 @@
+package serviceauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"email":"a@b.rs"}`)
+	tests := []struct {
+		name   string
+		secret string
+		at     time.Time
+		body   []byte
+		want   error
+	}{
+		{"valid", "secret", now, body, nil},
+		{"other secret", "other", now, body, ErrBadSignature},
+		{"tampered body", "secret", now, []byte(`{"email":"c@d.rs"}`), ErrBadSignature},
+		{"too old", "secret", now.Add(-ReplayWindow - time.Second), body, ErrBadTimestamp},
+		{"from the future", "secret", now.Add(ReplayWindow + time.Second), body, ErrBadTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := strconv.FormatInt(tt.at.Unix(), 10)
+			r := httptest.NewRequest("POST", "/checkifprosecuted?x=1", bytes.NewReader(tt.body))
+			r.Header.Set(HeaderTimestamp, ts)
+			r.Header.Set(HeaderSignature, Signature(tt.secret, "POST", "/checkifprosecuted?x=1", ts, body))
+			if err := Verify(r, "secret", tt.body, now); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	r := httptest.NewRequest("POST", "/", nil)
+	if err := Verify(r, "secret", nil, now); !errors.Is(err, ErrMissingHeaders) {
+		t.Fatalf("Verify() without headers = %v, want ErrMissingHeaders", err)
+	}
+}
+
+func TestSignRoundTrip(t *testing.T) {
+	body := []byte("payload")
+	r := httptest.NewRequest("PUT", "/prosecution/callback", bytes.NewReader(body))
+	Sign(r, "client", "secret", body)
+	if got := r.Header.Get(HeaderClientID); got != "client" {
+		t.Fatalf("client id header = %q", got)
+	}
+	if err := Verify(r, "secret", body, time.Now()); err != nil {
+		t.Fatalf("Verify() of a signed request = %v", err)
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+	body, err := ReadBody(r)
+	if err != nil || string(body) != "hello" {
+		t.Fatalf("ReadBody() = %q, %v", body, err)
+	}
+	again, _ := ReadBody(r)
+	if string(again) != "hello" {
+		t.Fatalf("body not put back, read %q", again)
+	}
+
+	r = httptest.NewRequest("POST", "/", bytes.NewReader(make([]byte, MaxBodySize+1)))
+	if _, err := ReadBody(r); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("ReadBody() of an oversized body = %v, want ErrBodyTooLarge", err)
+	}
+	r = httptest.NewRequest("POST", "/", bytes.NewReader(make([]byte, MaxBodySize)))
+	if _, err := ReadBody(r); err != nil {
+		t.Fatalf("ReadBody() of a body at the limit = %v", err)
+	}
+}
+
+func TestCheckReplay(t *testing.T) {
+	store := NewReplayCache()
+	now := time.Now()
+	if err := CheckReplay(context.Background(), store, "sig", now); err != nil {
+		t.Fatalf("first use = %v", err)
+	}
+	if err := CheckReplay(context.Background(), store, "sig", now); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("second use = %v, want ErrReplayed", err)
+	}
+	if err := CheckReplay(context.Background(), store, "other", now); err != nil {
+		t.Fatalf("other signature = %v", err)
+	}
+	// Expired signatures are forgotten
+	if err := store.Remember(context.Background(), "old", now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Remember(context.Background(), "old", now.Add(time.Minute)); err != nil {
+		t.Fatalf("expired signature still remembered: %v", err)
+	}
+}
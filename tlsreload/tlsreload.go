@@ -0,0 +1,137 @@
+package tlsreload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Config points at the PEM files used to serve TLS.
+type Config struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+}
+
+// ConfigFromEnv reads TLS_CERT_FILE, TLS_KEY_FILE, TLS_CLIENT_CA_FILE and
+// TLS_CLIENT_AUTH. ok is false when no certificate is configured and the
+// server should keep serving plain HTTP.
+func ConfigFromEnv() (cfg Config, ok bool, err error) {
+	cfg = Config{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+	}
+	if cfg.CertFile == "" && cfg.KeyFile == "" {
+		return cfg, false, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return cfg, false, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	cfg.ClientAuth, err = parseClientAuth(os.Getenv("TLS_CLIENT_AUTH"), cfg.ClientCAFile != "")
+	if err != nil {
+		return cfg, false, err
+	}
+	return cfg, true, nil
+}
+
+func parseClientAuth(mode string, haveCA bool) (tls.ClientAuthType, error) {
+	switch strings.ToLower(mode) {
+	case "":
+		if haveCA {
+			// Browsers keep working; services may present a certificate.
+			return tls.VerifyClientCertIfGiven, nil
+		}
+		return tls.NoClientCert, nil
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "verify_if_given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		if !haveCA {
+			return 0, errors.New("TLS_CLIENT_AUTH=require needs TLS_CLIENT_CA_FILE")
+		}
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return 0, fmt.Errorf("unknown TLS_CLIENT_AUTH %q", mode)
+}
+
+// Reloader serves the current certificate and client CA bundle and can swap
+// them at runtime. Established connections keep the material they negotiated
+// with; only new handshakes see a reload.
+type Reloader struct {
+	cfg    Config
+	logger *log.Logger
+	cert   atomic.Pointer[tls.Certificate]
+	pool   atomic.Pointer[x509.CertPool]
+}
+
+func New(cfg Config, logger *log.Logger) (*Reloader, error) {
+	rl := &Reloader{cfg: cfg, logger: logger}
+	if err := rl.Reload(); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+// Reload re-reads the certificate, key and client CA files. On error the
+// previously loaded material stays in use.
+func (rl *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(rl.cfg.CertFile, rl.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if rl.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(rl.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + rl.cfg.ClientCAFile)
+		}
+	}
+	rl.cert.Store(&cert)
+	rl.pool.Store(pool)
+	rl.logger.Println("tls certificates loaded")
+	return nil
+}
+
+// nextProtos are offered through ALPN. The per-client config replaces the
+// server's own, so it must offer them too or HTTP/2 is never negotiated.
+var nextProtos = []string{"h2", "http/1.1"}
+
+// TLSConfig returns the config to put on http.Server.
+func (rl *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   nextProtos,
+				Certificates: []tls.Certificate{*rl.cert.Load()},
+				ClientAuth:   rl.cfg.ClientAuth,
+				ClientCAs:    rl.pool.Load(),
+			}, nil
+		},
+	}
+}
+
+// PeerSubject returns the common name of a verified client certificate, or
+// an empty string when the connection carried none.
+func PeerSubject(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
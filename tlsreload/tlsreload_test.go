@@ -0,0 +1,109 @@
+package tlsreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for name to dir.
+func writeCert(t *testing.T, dir, name string) Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	if err := os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// handshake connects to a server using config and returns what was
+// negotiated.
+func handshake(t *testing.T, config *tls.Config) tls.ConnectionState {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		defer serverConn.Close()
+		tls.Server(serverConn, config).Handshake()
+	}()
+	client := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2", "http/1.1"}})
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	return client.ConnectionState()
+}
+
+func TestReloadedConfigsOfferHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	cfg := writeCert(t, dir, "first.sud.rs")
+	rl, err := New(cfg, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := rl.TLSConfig()
+
+	state := handshake(t, config)
+	if state.NegotiatedProtocol != "h2" {
+		t.Errorf("negotiated %q, want h2", state.NegotiatedProtocol)
+	}
+	if cn := state.PeerCertificates[0].Subject.CommonName; cn != "first.sud.rs" {
+		t.Errorf("served %q, want first.sud.rs", cn)
+	}
+
+	writeCert(t, dir, "second.sud.rs")
+	if err := rl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	state = handshake(t, config)
+	if state.NegotiatedProtocol != "h2" {
+		t.Errorf("after reload negotiated %q, want h2", state.NegotiatedProtocol)
+	}
+	if cn := state.PeerCertificates[0].Subject.CommonName; cn != "second.sud.rs" {
+		t.Errorf("after reload served %q, want second.sud.rs", cn)
+	}
+
+	// A broken file leaves the loaded certificate in place
+	if err := os.WriteFile(cfg.KeyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.Reload(); err == nil {
+		t.Error("Reload() accepted a broken key")
+	}
+	if cn := handshake(t, config).PeerCertificates[0].Subject.CommonName; cn != "second.sud.rs" {
+		t.Errorf("after a failed reload served %q, want second.sud.rs", cn)
+	}
+}
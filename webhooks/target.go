@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// ErrPrivateTarget rejects endpoints inside the court's own network.
+var ErrPrivateTarget = errors.New("webhook endpoints must be on public addresses")
+
+// publicIP tells whether ip is routable on the internet: not loopback,
+// private, link-local (which includes cloud metadata services),
+// multicast or unspecified.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// CheckURL validates a subscription endpoint: an http or https URL whose
+// host resolves to public addresses only, unless Config.AllowPrivate is
+// set.
+func (w *Worker) CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if w.cfg.AllowPrivate {
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("url host doesn't resolve: %w", err)
+	}
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return ErrPrivateTarget
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to non-public addresses. It runs after
+// name resolution, so a host that resolved to a public address when the
+// subscription was made can't be pointed inside later.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return ErrPrivateTarget
+	}
+	return nil
+}
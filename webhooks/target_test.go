@@ -0,0 +1,53 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	w := NewWorker(nil, Config{}, nil, nil)
+	tests := []struct {
+		url     string
+		private bool
+		ok      bool
+	}{
+		{"https://93.184.216.34/hook", false, true},
+		{"http://[2606:2800:220:1:248:1893:25c8:1946]:8080/hook", false, true},
+		{"https://127.0.0.1/hook", true, false},
+		{"https://[::1]/hook", true, false},
+		{"https://10.1.2.3/hook", true, false},
+		{"https://172.16.0.1/hook", true, false},
+		{"https://192.168.1.10/hook", true, false},
+		{"http://169.254.169.254/latest/meta-data", true, false},
+		{"https://[fe80::1]/hook", true, false},
+		{"https://[::ffff:127.0.0.1]/hook", true, false},
+		{"https://0.0.0.0/hook", true, false},
+		{"ftp://93.184.216.34/hook", false, false},
+		{"/relative", false, false},
+	}
+	for _, tt := range tests {
+		err := w.CheckURL(context.Background(), tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckURL(%s) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+		if tt.private && !errors.Is(err, ErrPrivateTarget) {
+			t.Errorf("CheckURL(%s) = %v, want ErrPrivateTarget", tt.url, err)
+		}
+	}
+
+	dev := NewWorker(nil, Config{AllowPrivate: true}, nil, nil)
+	if err := dev.CheckURL(context.Background(), "http://127.0.0.1:9000/hook"); err != nil {
+		t.Errorf("CheckURL() with AllowPrivate = %v", err)
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	if err := dialControl("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("dialControl(public) = %v", err)
+	}
+	if err := dialControl("tcp", "10.0.0.5:443", nil); !errors.Is(err, ErrPrivateTarget) {
+		t.Errorf("dialControl(private) = %v, want ErrPrivateTarget", err)
+	}
+}
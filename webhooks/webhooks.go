@@ -0,0 +1,348 @@
+// Package webhooks pushes court events to partner systems. It is fed by
+// the outbox: its sink fans each message out into one delivery per
+// matching subscription, and a worker sends those with HMAC signatures,
+// exponential backoff and a delivery log, disabling endpoints that keep
+// failing.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/EupravaProjekat/court/outbox"
+	"github.com/EupravaProjekat/court/queue"
+	"github.com/google/uuid"
+)
+
+// Headers of every delivery.
+const (
+	HeaderSignature = "X-Court-Signature" // t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+	HeaderEvent     = "X-Court-Event"
+	HeaderDelivery  = "X-Court-Delivery"
+)
+
+// Delivery states.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+	StatusCancelled = "cancelled" // Subscription was disabled or deleted
+)
+
+// AllEvents subscribes to every event type.
+const AllEvents = "*"
+
+// maxAttemptLog bounds how many attempts a delivery remembers.
+const maxAttemptLog = 20
+
+type Subscription struct {
+	ID                  string   `bson:"id" json:"id"`
+	URL                 string   `bson:"url" json:"url"`
+	EventTypes          []string `bson:"eventTypes" json:"event_types"`
+	Secret              string   `bson:"secret" json:"-"`
+	Active              bool     `bson:"active" json:"active"`
+	ConsecutiveFailures int      `bson:"consecutiveFailures" json:"consecutive_failures"`
+	DisabledReason      string   `bson:"disabledReason,omitempty" json:"disabled_reason,omitempty"`
+	CreatedBy           string   `bson:"createdBy" json:"created_by"`
+	CreatedAt           string   `bson:"createdAt" json:"created_at"`
+}
+
+// Wants reports whether the subscription receives events of msgType.
+func (s *Subscription) Wants(msgType string) bool {
+	for _, t := range s.EventTypes {
+		if t == AllEvents || t == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+type Attempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"statusCode,omitempty" json:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	Response   string    `bson:"response,omitempty" json:"response,omitempty"` // Start of the response body
+	DurationMs int64     `bson:"durationMs" json:"duration_ms"`
+}
+
+type Delivery struct {
+	ID             string          `bson:"id" json:"id"`
+	SubscriptionID string          `bson:"subscriptionId" json:"subscription_id"`
+	MessageID      string          `bson:"messageId" json:"message_id"`
+	EventType      string          `bson:"eventType" json:"event_type"`
+	Body           json.RawMessage `bson:"body" json:"body"`
+	Status         string          `bson:"status" json:"status"`
+	Attempts       []Attempt       `bson:"attempts" json:"attempts"`
+	AttemptCount   int             `bson:"attemptCount" json:"attempt_count"`
+	NextAttemptAt  time.Time       `bson:"nextAttemptAt" json:"next_attempt_at"`
+	LeaseUntil     time.Time       `bson:"leaseUntil" json:"-"`
+	CreatedAt      time.Time       `bson:"createdAt" json:"created_at"`
+}
+
+// Body is what a partner receives.
+type Body struct {
+	ID            string          `json:"id"` // Outbox message ID; the same on every redelivery
+	Type          string          `json:"type"`
+	OccurredAt    string          `json:"occurred_at"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// ErrNoSubscription is returned by a Store for a subscription that was
+// deleted.
+var ErrNoSubscription = errors.New("webhook subscription not found")
+
+type Store interface {
+	ActiveSubscriptions(ctx context.Context) ([]*Subscription, error)
+	GetSubscription(ctx context.Context, id string) (*Subscription, error) // ErrNoSubscription if deleted
+	// EnqueueDeliveries ignores deliveries already enqueued for the same
+	// subscription and message, so a repeated outbox delivery is harmless.
+	EnqueueDeliveries(ctx context.Context, deliveries []*Delivery) error
+	ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*Delivery, error)
+	SaveDelivery(ctx context.Context, d *Delivery) error
+	// RecordResult resets or increments the subscription's failure streak
+	// and returns the new streak.
+	RecordResult(ctx context.Context, subscriptionID string, ok bool) (int, error)
+	DisableSubscription(ctx context.Context, id, reason string) error
+}
+
+type Config struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	DisableAfter int // Consecutive failed attempts before an endpoint is disabled
+	Lease        time.Duration
+	AllowPrivate bool // Let endpoints be on private or loopback addresses, for development
+}
+
+// ConfigFromEnv reads WEBHOOK_TIMEOUT, WEBHOOK_MAX_ATTEMPTS,
+// WEBHOOK_DISABLE_AFTER and WEBHOOK_ALLOW_PRIVATE, defaulting the rest.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		PollInterval: 2 * time.Second,
+		Timeout:      10 * time.Second,
+		MaxAttempts:  8,
+		BaseBackoff:  10 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+		DisableAfter: 20,
+		Lease:        time.Minute,
+		AllowPrivate: os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true",
+	}
+	if d, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		cfg.MaxAttempts = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_DISABLE_AFTER")); err == nil && n > 0 {
+		cfg.DisableAfter = n
+	}
+	return cfg
+}
+
+// PayloadFunc turns an outbox message into the data partners receive, or
+// nil when partners get nothing of it. Outbox payloads are internal and
+// may carry personal data, so they are never forwarded as they are.
+type PayloadFunc func(m *outbox.Message) (json.RawMessage, error)
+
+type Worker struct {
+	store   Store
+	cfg     Config
+	payload PayloadFunc
+	http    *http.Client
+	logger  *log.Logger
+	loop    *queue.Loop
+}
+
+func NewWorker(store Store, cfg Config, payload PayloadFunc, logger *log.Logger) *Worker {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowPrivate {
+		transport.DialContext = (&net.Dialer{Timeout: cfg.Timeout, Control: dialControl}).DialContext
+	}
+	w := &Worker{
+		store:   store,
+		cfg:     cfg,
+		payload: payload,
+		http:    &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		logger:  logger,
+	}
+	w.loop = queue.NewLoop(cfg.PollInterval, w.sendOne)
+	return w
+}
+
+// Sign computes the signature header value for body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify wakes the worker, e.g. after deliveries were enqueued.
+func (w *Worker) Notify() {
+	w.loop.Notify()
+}
+
+// Sink is the outbox sink feeding the worker.
+func (w *Worker) Sink() outbox.Sink {
+	return &sink{w: w}
+}
+
+type sink struct {
+	w *Worker
+}
+
+func (s *sink) Name() string { return "webhooks" }
+
+func (s *sink) Deliver(ctx context.Context, m *outbox.Message) error {
+	data, err := s.w.payload(m)
+	if err != nil || data == nil {
+		return err
+	}
+	subs, err := s.w.store.ActiveSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(Body{
+		ID:            m.ID,
+		Type:          m.Type,
+		OccurredAt:    m.OccurredAt,
+		AggregateType: m.AggregateType,
+		AggregateID:   m.AggregateID,
+		Data:          data,
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	var deliveries []*Delivery
+	for _, sub := range subs {
+		if !sub.Wants(m.Type) {
+			continue
+		}
+		deliveries = append(deliveries, &Delivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: sub.ID,
+			MessageID:      m.ID,
+			EventType:      m.Type,
+			Body:           body,
+			Status:         StatusPending,
+			Attempts:       []Attempt{},
+			NextAttemptAt:  now,
+			LeaseUntil:     now,
+			CreatedAt:      now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := s.w.store.EnqueueDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+	s.w.Notify()
+	return nil
+}
+
+// Run sends due deliveries until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	w.loop.Run(ctx)
+}
+
+// sendOne sends the next due delivery, reporting whether there may be more.
+func (w *Worker) sendOne(ctx context.Context) bool {
+	d, err := w.store.ClaimDelivery(ctx, time.Now().UTC(), w.cfg.Lease)
+	if err != nil || d == nil {
+		if err != nil && ctx.Err() == nil {
+			w.logger.Printf("webhooks: claim failed: %v\n", err)
+		}
+		return false
+	}
+	sub, err := w.store.GetSubscription(ctx, d.SubscriptionID)
+	if err != nil && !errors.Is(err, ErrNoSubscription) {
+		// The lease runs out and the delivery is attempted again
+		w.logger.Printf("webhooks: loading subscription %s failed: %v\n", d.SubscriptionID, err)
+		return false
+	}
+	if err != nil || !sub.Active {
+		d.Status = StatusCancelled
+		w.save(ctx, d)
+		return true
+	}
+
+	attempt := w.send(ctx, sub, d)
+	ok := attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode <= 299
+	d.AttemptCount++
+	d.Attempts = append(d.Attempts, attempt)
+	if len(d.Attempts) > maxAttemptLog {
+		d.Attempts = d.Attempts[len(d.Attempts)-maxAttemptLog:]
+	}
+	d.LeaseUntil = time.Time{}
+	switch {
+	case ok:
+		d.Status = StatusDelivered
+	case d.AttemptCount >= w.cfg.MaxAttempts:
+		d.Status = StatusDead
+	default:
+		d.NextAttemptAt = time.Now().UTC().Add(queue.Backoff{Base: w.cfg.BaseBackoff, Max: w.cfg.MaxBackoff}.Delay(d.AttemptCount))
+	}
+	w.save(ctx, d)
+
+	streak, err := w.store.RecordResult(ctx, sub.ID, ok)
+	if err == nil && !ok && streak >= w.cfg.DisableAfter {
+		reason := fmt.Sprintf("disabled after %d consecutive failed deliveries", streak)
+		if err := w.store.DisableSubscription(ctx, sub.ID, reason); err == nil {
+			w.logger.Printf("webhooks: %s %s\n", sub.URL, reason)
+		}
+	}
+	return true
+}
+func (w *Worker) save(ctx context.Context, d *Delivery) {
+	if err := w.store.SaveDelivery(ctx, d); err != nil {
+		// The lease runs out and the delivery is attempted again
+		w.logger.Printf("webhooks: saving delivery %s failed: %v\n", d.ID, err)
+	}
+}
+
+// send makes one attempt at a delivery.
+func (w *Worker) send(ctx context.Context, sub *Subscription, d *Delivery) Attempt {
+	start := time.Now().UTC()
+	attempt := Attempt{At: start}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set("Idempotency-Key", d.MessageID)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, start, d.Body))
+	resp, err := w.http.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	attempt.StatusCode = resp.StatusCode
+	attempt.Response = string(snippet)
+	return attempt
+}